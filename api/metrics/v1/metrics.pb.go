@@ -0,0 +1,758 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: api/metrics/v1/metrics.proto
+
+package metricsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Metric метрика устройства
+type Metric struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// timestamp время измерения; если не задано, используется время приема
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Cpu           float64                `protobuf:"fixed64,3,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Rps           float64                `protobuf:"fixed64,4,opt,name=rps,proto3" json:"rps,omitempty"`
+	Memory        float64                `protobuf:"fixed64,5,opt,name=memory,proto3" json:"memory,omitempty"`
+	Tags          map[string]string      `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metric) Reset() {
+	*x = Metric{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metric) ProtoMessage() {}
+
+func (x *Metric) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metric.ProtoReflect.Descriptor instead.
+func (*Metric) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Metric) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Metric) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Metric) GetCpu() float64 {
+	if x != nil {
+		return x.Cpu
+	}
+	return 0
+}
+
+func (x *Metric) GetRps() float64 {
+	if x != nil {
+		return x.Rps
+	}
+	return 0
+}
+
+func (x *Metric) GetMemory() float64 {
+	if x != nil {
+		return x.Memory
+	}
+	return 0
+}
+
+func (x *Metric) GetTags() map[string]string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+type SubmitMetricsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// received всего метрик в потоке
+	Received int64 `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	// accepted метрик принято, включая пересланные
+	Accepted int64 `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	// rejected метрик отклонено валидацией, из-за заполненной очереди анализа или ошибки пересылки
+	Rejected int64 `protobuf:"varint,3,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	// forwarded метрик переслано репликам-владельцам
+	Forwarded     int64 `protobuf:"varint,4,opt,name=forwarded,proto3" json:"forwarded,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitMetricsResponse) Reset() {
+	*x = SubmitMetricsResponse{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitMetricsResponse) ProtoMessage() {}
+
+func (x *SubmitMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitMetricsResponse.ProtoReflect.Descriptor instead.
+func (*SubmitMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitMetricsResponse) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *SubmitMetricsResponse) GetAccepted() int64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *SubmitMetricsResponse) GetRejected() int64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *SubmitMetricsResponse) GetForwarded() int64 {
+	if x != nil {
+		return x.Forwarded
+	}
+	return 0
+}
+
+type GetAnalyticsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAnalyticsRequest) Reset() {
+	*x = GetAnalyticsRequest{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAnalyticsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAnalyticsRequest) ProtoMessage() {}
+
+func (x *GetAnalyticsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAnalyticsRequest.ProtoReflect.Descriptor instead.
+func (*GetAnalyticsRequest) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetAnalyticsRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+type GetAnalyticsResponse struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId     string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	AnomalyCount int32                  `protobuf:"varint,2,opt,name=anomaly_count,json=anomalyCount,proto3" json:"anomaly_count,omitempty"`
+	// anomalies ключи последних аномалий
+	Anomalies     []string `protobuf:"bytes,3,rep,name=anomalies,proto3" json:"anomalies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAnalyticsResponse) Reset() {
+	*x = GetAnalyticsResponse{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAnalyticsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAnalyticsResponse) ProtoMessage() {}
+
+func (x *GetAnalyticsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAnalyticsResponse.ProtoReflect.Descriptor instead.
+func (*GetAnalyticsResponse) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetAnalyticsResponse) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *GetAnalyticsResponse) GetAnomalyCount() int32 {
+	if x != nil {
+		return x.AnomalyCount
+	}
+	return 0
+}
+
+func (x *GetAnalyticsResponse) GetAnomalies() []string {
+	if x != nil {
+		return x.Anomalies
+	}
+	return nil
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+type GetStatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Analyzer      *AnalyzerStats         `protobuf:"bytes,1,opt,name=analyzer,proto3" json:"analyzer,omitempty"`
+	Redis         *RedisStats            `protobuf:"bytes,2,opt,name=redis,proto3" json:"redis,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsResponse) Reset() {
+	*x = GetStatsResponse{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsResponse) ProtoMessage() {}
+
+func (x *GetStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetStatsResponse) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetStatsResponse) GetAnalyzer() *AnalyzerStats {
+	if x != nil {
+		return x.Analyzer
+	}
+	return nil
+}
+
+func (x *GetStatsResponse) GetRedis() *RedisStats {
+	if x != nil {
+		return x.Redis
+	}
+	return nil
+}
+
+func (x *GetStatsResponse) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+type AnalyzerStats struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	DevicesTracked int64                  `protobuf:"varint,1,opt,name=devices_tracked,json=devicesTracked,proto3" json:"devices_tracked,omitempty"`
+	WindowSize     int64                  `protobuf:"varint,2,opt,name=window_size,json=windowSize,proto3" json:"window_size,omitempty"`
+	Threshold      float64                `protobuf:"fixed64,3,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	QueueSize      int64                  `protobuf:"varint,4,opt,name=queue_size,json=queueSize,proto3" json:"queue_size,omitempty"`
+	Subscribers    []*SubscriberStats     `protobuf:"bytes,5,rep,name=subscribers,proto3" json:"subscribers,omitempty"`
+	// Опоздавшие метрики, вставленные в окно по времени
+	LateReordered int64 `protobuf:"varint,6,opt,name=late_reordered,json=lateReordered,proto3" json:"late_reordered,omitempty"`
+	// Метрики, опоздавшие больше допустимого
+	LateDropped   int64 `protobuf:"varint,7,opt,name=late_dropped,json=lateDropped,proto3" json:"late_dropped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzerStats) Reset() {
+	*x = AnalyzerStats{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzerStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzerStats) ProtoMessage() {}
+
+func (x *AnalyzerStats) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzerStats.ProtoReflect.Descriptor instead.
+func (*AnalyzerStats) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AnalyzerStats) GetDevicesTracked() int64 {
+	if x != nil {
+		return x.DevicesTracked
+	}
+	return 0
+}
+
+func (x *AnalyzerStats) GetWindowSize() int64 {
+	if x != nil {
+		return x.WindowSize
+	}
+	return 0
+}
+
+func (x *AnalyzerStats) GetThreshold() float64 {
+	if x != nil {
+		return x.Threshold
+	}
+	return 0
+}
+
+func (x *AnalyzerStats) GetQueueSize() int64 {
+	if x != nil {
+		return x.QueueSize
+	}
+	return 0
+}
+
+func (x *AnalyzerStats) GetSubscribers() []*SubscriberStats {
+	if x != nil {
+		return x.Subscribers
+	}
+	return nil
+}
+
+func (x *AnalyzerStats) GetLateReordered() int64 {
+	if x != nil {
+		return x.LateReordered
+	}
+	return 0
+}
+
+func (x *AnalyzerStats) GetLateDropped() int64 {
+	if x != nil {
+		return x.LateDropped
+	}
+	return 0
+}
+
+type SubscriberStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Policy        string                 `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	Buffered      int64                  `protobuf:"varint,3,opt,name=buffered,proto3" json:"buffered,omitempty"`
+	Capacity      int64                  `protobuf:"varint,4,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Delivered     int64                  `protobuf:"varint,5,opt,name=delivered,proto3" json:"delivered,omitempty"`
+	Dropped       int64                  `protobuf:"varint,6,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscriberStats) Reset() {
+	*x = SubscriberStats{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscriberStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscriberStats) ProtoMessage() {}
+
+func (x *SubscriberStats) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscriberStats.ProtoReflect.Descriptor instead.
+func (*SubscriberStats) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SubscriberStats) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SubscriberStats) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *SubscriberStats) GetBuffered() int64 {
+	if x != nil {
+		return x.Buffered
+	}
+	return 0
+}
+
+func (x *SubscriberStats) GetCapacity() int64 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *SubscriberStats) GetDelivered() int64 {
+	if x != nil {
+		return x.Delivered
+	}
+	return 0
+}
+
+func (x *SubscriberStats) GetDropped() int64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+type RedisStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connected     bool                   `protobuf:"varint,1,opt,name=connected,proto3" json:"connected,omitempty"`
+	Spooled       int64                  `protobuf:"varint,2,opt,name=spooled,proto3" json:"spooled,omitempty"`
+	SpoolDropped  int64                  `protobuf:"varint,3,opt,name=spool_dropped,json=spoolDropped,proto3" json:"spool_dropped,omitempty"`
+	BreakerState  string                 `protobuf:"bytes,4,opt,name=breaker_state,json=breakerState,proto3" json:"breaker_state,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedisStats) Reset() {
+	*x = RedisStats{}
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedisStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedisStats) ProtoMessage() {}
+
+func (x *RedisStats) ProtoReflect() protoreflect.Message {
+	mi := &file_api_metrics_v1_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedisStats.ProtoReflect.Descriptor instead.
+func (*RedisStats) Descriptor() ([]byte, []int) {
+	return file_api_metrics_v1_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RedisStats) GetConnected() bool {
+	if x != nil {
+		return x.Connected
+	}
+	return false
+}
+
+func (x *RedisStats) GetSpooled() int64 {
+	if x != nil {
+		return x.Spooled
+	}
+	return 0
+}
+
+func (x *RedisStats) GetSpoolDropped() int64 {
+	if x != nil {
+		return x.SpoolDropped
+	}
+	return 0
+}
+
+func (x *RedisStats) GetBreakerState() string {
+	if x != nil {
+		return x.BreakerState
+	}
+	return ""
+}
+
+var File_api_metrics_v1_metrics_proto protoreflect.FileDescriptor
+
+const file_api_metrics_v1_metrics_proto_rawDesc = "" +
+	"\n" +
+	"\x1capi/metrics/v1/metrics.proto\x12\n" +
+	"metrics.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x86\x02\n" +
+	"\x06Metric\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x10\n" +
+	"\x03cpu\x18\x03 \x01(\x01R\x03cpu\x12\x10\n" +
+	"\x03rps\x18\x04 \x01(\x01R\x03rps\x12\x16\n" +
+	"\x06memory\x18\x05 \x01(\x01R\x06memory\x120\n" +
+	"\x04tags\x18\x06 \x03(\v2\x1c.metrics.v1.Metric.TagsEntryR\x04tags\x1a7\n" +
+	"\tTagsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x89\x01\n" +
+	"\x15SubmitMetricsResponse\x12\x1a\n" +
+	"\breceived\x18\x01 \x01(\x03R\breceived\x12\x1a\n" +
+	"\baccepted\x18\x02 \x01(\x03R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x03 \x01(\x03R\brejected\x12\x1c\n" +
+	"\tforwarded\x18\x04 \x01(\x03R\tforwarded\"2\n" +
+	"\x13GetAnalyticsRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\"v\n" +
+	"\x14GetAnalyticsResponse\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12#\n" +
+	"\ranomaly_count\x18\x02 \x01(\x05R\fanomalyCount\x12\x1c\n" +
+	"\tanomalies\x18\x03 \x03(\tR\tanomalies\"\x11\n" +
+	"\x0fGetStatsRequest\"\xb1\x01\n" +
+	"\x10GetStatsResponse\x125\n" +
+	"\banalyzer\x18\x01 \x01(\v2\x19.metrics.v1.AnalyzerStatsR\banalyzer\x12,\n" +
+	"\x05redis\x18\x02 \x01(\v2\x16.metrics.v1.RedisStatsR\x05redis\x128\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\x9f\x02\n" +
+	"\rAnalyzerStats\x12'\n" +
+	"\x0fdevices_tracked\x18\x01 \x01(\x03R\x0edevicesTracked\x12\x1f\n" +
+	"\vwindow_size\x18\x02 \x01(\x03R\n" +
+	"windowSize\x12\x1c\n" +
+	"\tthreshold\x18\x03 \x01(\x01R\tthreshold\x12\x1d\n" +
+	"\n" +
+	"queue_size\x18\x04 \x01(\x03R\tqueueSize\x12=\n" +
+	"\vsubscribers\x18\x05 \x03(\v2\x1b.metrics.v1.SubscriberStatsR\vsubscribers\x12%\n" +
+	"\x0elate_reordered\x18\x06 \x01(\x03R\rlateReordered\x12!\n" +
+	"\flate_dropped\x18\a \x01(\x03R\vlateDropped\"\xad\x01\n" +
+	"\x0fSubscriberStats\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\x12\x1a\n" +
+	"\bbuffered\x18\x03 \x01(\x03R\bbuffered\x12\x1a\n" +
+	"\bcapacity\x18\x04 \x01(\x03R\bcapacity\x12\x1c\n" +
+	"\tdelivered\x18\x05 \x01(\x03R\tdelivered\x12\x18\n" +
+	"\adropped\x18\x06 \x01(\x03R\adropped\"\x8e\x01\n" +
+	"\n" +
+	"RedisStats\x12\x1c\n" +
+	"\tconnected\x18\x01 \x01(\bR\tconnected\x12\x18\n" +
+	"\aspooled\x18\x02 \x01(\x03R\aspooled\x12#\n" +
+	"\rspool_dropped\x18\x03 \x01(\x03R\fspoolDropped\x12#\n" +
+	"\rbreaker_state\x18\x04 \x01(\tR\fbreakerState2\xf4\x01\n" +
+	"\x0eMetricsService\x12H\n" +
+	"\rSubmitMetrics\x12\x12.metrics.v1.Metric\x1a!.metrics.v1.SubmitMetricsResponse(\x01\x12Q\n" +
+	"\fGetAnalytics\x12\x1f.metrics.v1.GetAnalyticsRequest\x1a .metrics.v1.GetAnalyticsResponse\x12E\n" +
+	"\bGetStats\x12\x1b.metrics.v1.GetStatsRequest\x1a\x1c.metrics.v1.GetStatsResponseB)Z'highload-final/api/metrics/v1;metricsv1b\x06proto3"
+
+var (
+	file_api_metrics_v1_metrics_proto_rawDescOnce sync.Once
+	file_api_metrics_v1_metrics_proto_rawDescData []byte
+)
+
+func file_api_metrics_v1_metrics_proto_rawDescGZIP() []byte {
+	file_api_metrics_v1_metrics_proto_rawDescOnce.Do(func() {
+		file_api_metrics_v1_metrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_metrics_v1_metrics_proto_rawDesc), len(file_api_metrics_v1_metrics_proto_rawDesc)))
+	})
+	return file_api_metrics_v1_metrics_proto_rawDescData
+}
+
+var file_api_metrics_v1_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_api_metrics_v1_metrics_proto_goTypes = []any{
+	(*Metric)(nil),                // 0: metrics.v1.Metric
+	(*SubmitMetricsResponse)(nil), // 1: metrics.v1.SubmitMetricsResponse
+	(*GetAnalyticsRequest)(nil),   // 2: metrics.v1.GetAnalyticsRequest
+	(*GetAnalyticsResponse)(nil),  // 3: metrics.v1.GetAnalyticsResponse
+	(*GetStatsRequest)(nil),       // 4: metrics.v1.GetStatsRequest
+	(*GetStatsResponse)(nil),      // 5: metrics.v1.GetStatsResponse
+	(*AnalyzerStats)(nil),         // 6: metrics.v1.AnalyzerStats
+	(*SubscriberStats)(nil),       // 7: metrics.v1.SubscriberStats
+	(*RedisStats)(nil),            // 8: metrics.v1.RedisStats
+	nil,                           // 9: metrics.v1.Metric.TagsEntry
+	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
+}
+var file_api_metrics_v1_metrics_proto_depIdxs = []int32{
+	10, // 0: metrics.v1.Metric.timestamp:type_name -> google.protobuf.Timestamp
+	9,  // 1: metrics.v1.Metric.tags:type_name -> metrics.v1.Metric.TagsEntry
+	6,  // 2: metrics.v1.GetStatsResponse.analyzer:type_name -> metrics.v1.AnalyzerStats
+	8,  // 3: metrics.v1.GetStatsResponse.redis:type_name -> metrics.v1.RedisStats
+	10, // 4: metrics.v1.GetStatsResponse.timestamp:type_name -> google.protobuf.Timestamp
+	7,  // 5: metrics.v1.AnalyzerStats.subscribers:type_name -> metrics.v1.SubscriberStats
+	0,  // 6: metrics.v1.MetricsService.SubmitMetrics:input_type -> metrics.v1.Metric
+	2,  // 7: metrics.v1.MetricsService.GetAnalytics:input_type -> metrics.v1.GetAnalyticsRequest
+	4,  // 8: metrics.v1.MetricsService.GetStats:input_type -> metrics.v1.GetStatsRequest
+	1,  // 9: metrics.v1.MetricsService.SubmitMetrics:output_type -> metrics.v1.SubmitMetricsResponse
+	3,  // 10: metrics.v1.MetricsService.GetAnalytics:output_type -> metrics.v1.GetAnalyticsResponse
+	5,  // 11: metrics.v1.MetricsService.GetStats:output_type -> metrics.v1.GetStatsResponse
+	9,  // [9:12] is the sub-list for method output_type
+	6,  // [6:9] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_api_metrics_v1_metrics_proto_init() }
+func file_api_metrics_v1_metrics_proto_init() {
+	if File_api_metrics_v1_metrics_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_metrics_v1_metrics_proto_rawDesc), len(file_api_metrics_v1_metrics_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_metrics_v1_metrics_proto_goTypes,
+		DependencyIndexes: file_api_metrics_v1_metrics_proto_depIdxs,
+		MessageInfos:      file_api_metrics_v1_metrics_proto_msgTypes,
+	}.Build()
+	File_api_metrics_v1_metrics_proto = out.File
+	file_api_metrics_v1_metrics_proto_goTypes = nil
+	file_api_metrics_v1_metrics_proto_depIdxs = nil
+}
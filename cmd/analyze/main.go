@@ -0,0 +1,216 @@
+// Команда analyze прогоняет метрики из файла через анализатор без Redis и HTTP.
+//
+//	analyze -window 50 -threshold 2.0 -detector zscore metrics.csv
+//	cat metrics.ndjson | analyze -output table
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// Форматы вывода
+const (
+	outputNDJSON = "ndjson"
+	outputTable  = "table"
+)
+
+func main() {
+	var (
+		format        = flag.String("format", "auto", "input format: ndjson, csv or auto (by file extension)")
+		output        = flag.String("output", outputNDJSON, "output format: ndjson (analysis results) or table (summary per device)")
+		windowSize    = flag.Int("window", 50, "rolling window size")
+		threshold     = flag.Float64("threshold", 2.0, "anomaly score threshold")
+		detector      = flag.String("detector", analytics.DetectorZScore, "anomaly detector: zscore or mad")
+		anomaliesOnly = flag.Bool("anomalies-only", false, "write only anomalous results (ndjson output)")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file]\n\nReads metrics from file or stdin, analyzes them in timestamp order.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	input, name, err := openInput(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open input: %v", err)
+	}
+	defer input.Close()
+
+	if *format == "auto" {
+		*format = ingest.FormatFromPath(name)
+	}
+
+	batch, err := readMetrics(input, *format)
+	if err != nil {
+		log.Fatalf("Failed to read metrics: %v", err)
+	}
+
+	analyzer := analytics.NewAnalyzer(*windowSize, *threshold)
+	if err := analyzer.SetDetector(*detector); err != nil {
+		log.Fatal(err)
+	}
+
+	switch *output {
+	case outputNDJSON:
+		err = writeResults(os.Stdout, analyzer, batch, *anomaliesOnly)
+	case outputTable:
+		err = writeSummary(os.Stdout, analyzer, batch)
+	default:
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+}
+
+// openInput открывает файл или stdin, если путь пуст или равен "-"
+func openInput(path string) (io.ReadCloser, string, error) {
+	if path == "" || path == "-" {
+		return io.NopCloser(os.Stdin), "", nil
+	}
+	f, err := os.Open(path)
+	return f, path, err
+}
+
+// readMetrics читает метрики, отсортированные по времени.
+// Некорректные записи пропускаются с сообщением в stderr.
+func readMetrics(input io.Reader, format string) ([]models.Metric, error) {
+	skipped := 0
+	batch, err := ingest.ReadHistory(input, format, func(line int, err error) {
+		skipped++
+		log.Printf("line %d: %v", line, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d invalid records", skipped)
+	}
+	return batch, nil
+}
+
+// analyze прогоняет метрики через анализатор и передает результаты в fn
+func analyze(analyzer *analytics.Analyzer, batch []models.Metric, fn func(analytics.AnalysisResult) error) error {
+	for _, metric := range batch {
+		result, ok := analyzer.Analyze(analytics.MetricData{
+			DeviceID:  metric.DeviceID,
+			Timestamp: metric.Timestamp,
+			CPU:       metric.CPU,
+			RPS:       metric.RPS,
+			Tags:      metric.Tags,
+		})
+		if !ok {
+			continue
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResults выводит результаты анализа в NDJSON в формате API
+func writeResults(w io.Writer, analyzer *analytics.Analyzer, batch []models.Metric, anomaliesOnly bool) error {
+	enc := json.NewEncoder(w)
+	return analyze(analyzer, batch, func(r analytics.AnalysisResult) error {
+		if anomaliesOnly && !r.IsAnomaly {
+			return nil
+		}
+		return enc.Encode(models.AnalyticsResult{
+			DeviceID:      r.DeviceID,
+			Timestamp:     r.Timestamp,
+			RollingAvgCPU: r.RollingAvgCPU,
+			RollingAvgRPS: r.RollingAvgRPS,
+			IsAnomaly:     r.IsAnomaly,
+			AnomalyScore:  r.AnomalyScore,
+			AnomalyType:   r.AnomalyType,
+			StandardDev:   r.StandardDev,
+			Tags:          r.Tags,
+		})
+	})
+}
+
+// deviceSummary итог анализа устройства
+type deviceSummary struct {
+	samples   int
+	anomalies int
+	maxScore  float64
+	byType    map[string]int
+}
+
+// writeSummary выводит таблицу итогов по устройствам
+func writeSummary(w io.Writer, analyzer *analytics.Analyzer, batch []models.Metric) error {
+	summaries := make(map[string]*deviceSummary)
+	err := analyze(analyzer, batch, func(r analytics.AnalysisResult) error {
+		s, ok := summaries[r.DeviceID]
+		if !ok {
+			s = &deviceSummary{byType: make(map[string]int)}
+			summaries[r.DeviceID] = s
+		}
+		s.samples++
+		if r.IsAnomaly {
+			s.anomalies++
+			s.byType[r.AnomalyType]++
+		}
+		s.maxScore = math.Max(s.maxScore, r.AnomalyScore)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	devices := make([]string, 0, len(summaries))
+	for id := range summaries {
+		devices = append(devices, id)
+	}
+	sort.Strings(devices)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tSAMPLES\tANOMALIES\tRATE\tMAX SCORE\tTYPES")
+	var total, totalAnomalies int
+	for _, id := range devices {
+		s := summaries[id]
+		total += s.samples
+		totalAnomalies += s.anomalies
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%.2f\t%s\n",
+			id, s.samples, s.anomalies, rate(s.anomalies, s.samples), s.maxScore, formatTypes(s.byType))
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%.2f%%\t\t\n", total, totalAnomalies, rate(totalAnomalies, total))
+	return tw.Flush()
+}
+
+// rate доля аномалий в процентах
+func rate(anomalies, samples int) float64 {
+	if samples == 0 {
+		return 0
+	}
+	return float64(anomalies) / float64(samples) * 100
+}
+
+// formatTypes выводит число аномалий по типам: "CPU_SPIKE=3,RPS_DROP=1"
+func formatTypes(byType map[string]int) string {
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%s=%d", t, byType[t])
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,169 @@
+// Команда evaluate подбирает параметры анализатора по размеченным данным:
+// для каждой комбинации окна, порога и детектора считает precision, recall, F1
+// и задержку обнаружения.
+//
+//	evaluate -labels labels.json -windows 20,50,100 -thresholds 1.5,2,2.5,3 metrics.csv
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/evaluation"
+	"highload-final/internal/ingest"
+)
+
+func main() {
+	var (
+		labelsPath = flag.String("labels", "", "JSON array of labeled anomaly intervals: [{\"device_id\",\"start\",\"end\"}] (required)")
+		format     = flag.String("format", "auto", "metrics format: ndjson, csv or auto (by file extension)")
+		windows    = flag.String("windows", "20,50,100", "comma-separated window sizes")
+		thresholds = flag.String("thresholds", "1.5,2,2.5,3", "comma-separated anomaly thresholds")
+		detectors  = flag.String("detectors", analytics.DetectorZScore+","+analytics.DetectorMAD, "comma-separated detectors")
+		tolerance  = flag.Duration("tolerance", 0, "how long after an interval end a detection still counts as a hit")
+		output     = flag.String("output", "table", "output format: table or json")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -labels FILE [flags] [metrics file]\n\nReads metrics from file or stdin and evaluates analyzer settings against labeled anomalies.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *labelsPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	labels, err := loadLabels(*labelsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	windowSizes, err := parseInts(*windows)
+	if err != nil {
+		log.Fatalf("Invalid -windows: %v", err)
+	}
+	thresholdValues, err := parseFloats(*thresholds)
+	if err != nil {
+		log.Fatalf("Invalid -thresholds: %v", err)
+	}
+
+	input, name := os.Stdin, ""
+	if path := flag.Arg(0); path != "" && path != "-" {
+		if input, err = os.Open(path); err != nil {
+			log.Fatalf("Failed to open metrics: %v", err)
+		}
+		defer input.Close()
+		name = path
+	}
+	if *format == "auto" {
+		*format = ingest.FormatFromPath(name)
+	}
+
+	skipped := 0
+	series, err := ingest.ReadHistory(input, *format, func(line int, err error) {
+		skipped++
+		log.Printf("line %d: %v", line, err)
+	})
+	if err != nil {
+		log.Fatalf("Failed to read metrics: %v", err)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d invalid records", skipped)
+	}
+	log.Printf("Evaluating %d metrics against %d labeled intervals", len(series), len(labels))
+
+	configs := evaluation.Grid(windowSizes, thresholdValues, splitList(*detectors))
+	reports := make([]evaluation.Report, 0, len(configs))
+	for _, config := range configs {
+		report, err := evaluation.Evaluate(series, labels, config, *tolerance)
+		if err != nil {
+			log.Fatalf("%s: %v", config, err)
+		}
+		reports = append(reports, report)
+	}
+	evaluation.Rank(reports)
+
+	switch *output {
+	case "table":
+		err = writeTable(os.Stdout, reports)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(reports)
+	default:
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+}
+
+// loadLabels читает файл разметки
+func loadLabels(path string) ([]evaluation.Interval, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open labels: %w", err)
+	}
+	defer f.Close()
+	return evaluation.LoadLabels(f)
+}
+
+// writeTable выводит отчеты таблицей, лучшая конфигурация первой
+func writeTable(w io.Writer, reports []evaluation.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DETECTOR\tWINDOW\tTHRESHOLD\tPRECISION\tRECALL\tF1\tDETECTED\tFALSE POS\tMEAN DELAY\tMAX DELAY")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d\t%g\t%.3f\t%.3f\t%.3f\t%d/%d\t%d\t%s\t%s\n",
+			r.Detector, r.WindowSize, r.Threshold, r.Precision, r.Recall, r.F1,
+			r.Detected, r.Events, r.FalsePositives,
+			r.MeanDelay.Round(time.Second), r.MaxDelay.Round(time.Second))
+	}
+	return tw.Flush()
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseInts разбирает список целых чисел через запятую
+func parseInts(value string) ([]int, error) {
+	var values []int
+	for _, item := range splitList(value) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// parseFloats разбирает список чисел через запятую
+func parseFloats(value string) ([]float64, error) {
+	var values []float64
+	for _, item := range splitList(value) {
+		f, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, f)
+	}
+	return values, nil
+}
@@ -4,18 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"highload-final/internal/alerting"
 	"highload-final/internal/analytics"
+	"highload-final/internal/backfill"
 	"highload-final/internal/cache"
+	"highload-final/internal/cluster"
+	"highload-final/internal/grpcserver"
 	"highload-final/internal/handlers"
+	"highload-final/internal/ingest"
 	"highload-final/internal/metrics"
+	"highload-final/internal/mqttinput"
+	"highload-final/internal/otlp"
+	"highload-final/internal/remotewrite"
+	"highload-final/internal/stream"
+	"highload-final/internal/udpinput"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -25,30 +41,167 @@ func main() {
 	config := loadConfig()
 
 	// Инициализация Redis
-	redisCache, err := cache.NewRedisCache(
-		config.RedisAddr,
-		config.RedisPassword,
-		config.RedisDB,
-		config.MetricsRetention,
-	)
+	redisCache, err := cache.NewRedisCache(cache.Options{
+		Mode:             config.RedisMode,
+		Addrs:            strings.Split(config.RedisAddr, ","),
+		Password:         config.RedisPassword,
+		DB:               config.RedisDB,
+		MasterName:       config.RedisMasterName,
+		SentinelPassword: config.RedisSentinelPassword,
+		TTL:              config.MetricsRetention,
+
+		SpoolSize:           config.RedisSpoolSize,
+		ReconnectMaxBackoff: config.RedisReconnectMaxBackoff,
+
+		MaxRetries:        config.RedisMaxRetries,
+		OperationTimeout:  config.RedisOperationTimeout,
+		OperationTimeouts: config.RedisOperationTimeouts,
+		Breaker: cache.BreakerConfig{
+			WindowSize:            config.RedisBreakerWindow,
+			ErrorRateThreshold:    config.RedisBreakerErrorRate,
+			SlowCallDuration:      config.RedisBreakerSlowCall,
+			SlowCallRateThreshold: config.RedisBreakerSlowCallRate,
+			OpenTimeout:           config.RedisBreakerOpenTimeout,
+		},
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		log.Fatalf("Invalid Redis configuration: %v", err)
 	}
 	defer redisCache.Close()
-	log.Println("Connected to Redis")
+	if redisCache.Connected() {
+		log.Printf("Connected to Redis (mode: %s)\n", config.RedisMode)
+	}
 
 	// Инициализация анализатора
 	analyzer := analytics.NewAnalyzer(config.WindowSize, config.AnomalyThreshold)
+	analyzer.SetAllowedLateness(config.AllowedLateness)
+	if err := analyzer.SetDetector(config.AnomalyDetector); err != nil {
+		log.Fatalf("Invalid analyzer configuration: %v", err)
+	}
 	analyzer.Start(4) // 4 worker goroutines
 	defer analyzer.Stop()
-	log.Printf("Analyzer started with window size: %d, threshold: %.2f\n",
-		config.WindowSize, config.AnomalyThreshold)
+	log.Printf("Analyzer started with window size: %d, threshold: %.2f, detector: %s\n",
+		config.WindowSize, config.AnomalyThreshold, config.AnomalyDetector)
+
+	// Инициализация оповещений
+	receivers, err := alerting.ParseReceivers(config.AlertReceivers)
+	if err != nil {
+		log.Fatalf("Invalid alert receivers: %v", err)
+	}
+	notifier := alerting.NewNotifier(receivers, config.AlertQueueSize)
+	notifier.Start(2)
+	defer notifier.Stop()
+	log.Printf("Alerting configured with %d receivers\n", len(receivers))
+
+	trackerConfig := alerting.TrackerConfig{
+		Cooldown:       config.AlertCooldown,
+		ResolveAfter:   config.AlertResolveAfter,
+		ResolveTimeout: config.AlertResolveTimeout,
+	}
+	tracker := alerting.NewTracker(trackerConfig)
+	go sweepIncidents(tracker, redisCache, notifier)
+
+	silencer := alerting.NewSilencer(redisCache)
+	go silencer.Run(config.SilenceRefresh)
 
-	// Запускаем goroutine для обработки результатов анализа
-	go processAnalysisResults(analyzer, redisCache)
+	// Брокер потоковой выдачи результатов (SSE)
+	broker := stream.NewBroker(config.StreamBufferSize, config.StreamHistorySize)
+
+	// Каждый получатель подписывается на результаты анализа независимо
+	go recordResults(analyzer)
+	go storeResults(analyzer, redisCache)
+	go alertResults(analyzer, redisCache, silencer, tracker, notifier)
+	go streamResults(analyzer, broker)
+
+	// Общий конвейер приема метрик для HTTP и gRPC
+	pipeline := ingest.NewPipeline(analyzer, redisCache)
+	rules, err := validationRules(config)
+	if err != nil {
+		log.Fatalf("Invalid validation rules: %v", err)
+	}
+	pipeline.SetRules(rules)
+	// LRU нулевого размера вытесняет каждую отметку и молча выключает отбрасывание повторов
+	if config.DedupStore != ingest.DedupNone && config.DedupMemorySize <= 0 {
+		log.Fatalf("Invalid dedup configuration: DEDUP_MEMORY_SIZE must be positive, got %d", config.DedupMemorySize)
+	}
+	switch config.DedupStore {
+	case ingest.DedupRedis:
+		pipeline.SetDeduplicator(ingest.NewRedisDeduplicator(redisCache, config.DedupWindow, config.DedupMemorySize))
+	case ingest.DedupMemory:
+		pipeline.SetDeduplicator(ingest.NewMemoryDeduplicator(config.DedupMemorySize, config.DedupWindow))
+	case ingest.DedupNone:
+		// Отбрасывание повторов выключено
+	default:
+		log.Fatalf("Unknown dedup store %q", config.DedupStore)
+	}
 
 	// Инициализация HTTP handlers
-	handler := handlers.NewHandler(analyzer, redisCache)
+	handler := handlers.NewHandler(analyzer, redisCache, pipeline)
+	handler.SetSilencer(silencer)
+	handler.SetBroker(broker)
+	handler.SetAllowedOrigins(config.StreamAllowedOrigins)
+	handler.SetMaxBatchBody(config.BatchMaxBody)
+
+	// Загрузка истории анализируется отдельно от живых окон
+	backfillRunner := backfill.NewRunner(backfill.Config{
+		WindowSize:       config.WindowSize,
+		AnomalyThreshold: config.AnomalyThreshold,
+		Detector:         config.AnomalyDetector,
+		Tracker:          trackerConfig,
+		MaxRunning:       config.BackfillMaxRunning,
+		MaxJobs:          config.BackfillMaxJobs,
+		AllowedLateness:  config.AllowedLateness,
+	}, redisCache)
+	defer backfillRunner.Stop()
+	handler.SetBackfill(backfillRunner)
+
+	// Прием Prometheus remote_write
+	if config.RemoteWriteEnabled {
+		mappings, err := ingest.ParseFieldMappings(config.RemoteWriteMapping)
+		if err != nil {
+			log.Fatalf("Invalid remote write mapping: %v", err)
+		}
+		handler.SetRemoteWrite(remotewrite.NewMapper(remotewrite.Config{
+			DeviceLabel: config.RemoteWriteDeviceLabel,
+			Mappings:    mappings,
+		}))
+		log.Printf("Prometheus remote_write enabled: device label=%s, mapping=%s\n",
+			config.RemoteWriteDeviceLabel, config.RemoteWriteMapping)
+	}
+
+	// Прием метрик OpenTelemetry (OTLP/HTTP)
+	if config.OTLPEnabled {
+		mappings, err := ingest.ParseFieldMappings(config.OTLPMapping)
+		if err != nil {
+			log.Fatalf("Invalid OTLP mapping: %v", err)
+		}
+		handler.SetOTLP(otlp.NewMapper(otlp.Config{
+			DeviceAttributes: config.OTLPDeviceAttributes,
+			Mappings:         mappings,
+		}))
+		log.Printf("OTLP ingestion enabled: device attributes=%v, mapping=%s\n",
+			config.OTLPDeviceAttributes, config.OTLPMapping)
+	}
+
+	// Распределение устройств между репликами
+	var clusterNode *cluster.Node
+	if config.ClusterEnabled {
+		if config.ClusterSecret == "" {
+			log.Fatalf("Invalid cluster configuration: CLUSTER_SECRET is required")
+		}
+		clusterNode = cluster.NewNode(cluster.Config{
+			NodeID:            config.ClusterNodeID,
+			AdvertiseAddr:     config.ClusterAdvertiseAddr,
+			HeartbeatInterval: config.ClusterHeartbeat,
+			MemberTTL:         config.ClusterMemberTTL,
+			VirtualNodes:      config.ClusterVirtualNodes,
+			Secret:            config.ClusterSecret,
+		}, redisCache, analyzer)
+		handler.SetCluster(clusterNode)
+		pipeline.SetCluster(clusterNode)
+		log.Printf("Cluster mode enabled: node=%s, addr=%s\n",
+			config.ClusterNodeID, config.ClusterAdvertiseAddr)
+	}
 
 	// Настройка HTTP router
 	mux := http.NewServeMux()
@@ -59,6 +212,21 @@ func main() {
 	mux.HandleFunc("/analytics", handler.GetAnalytics)
 	mux.HandleFunc("/health", handler.HealthCheck)
 	mux.HandleFunc("/stats", handler.GetStats)
+	mux.HandleFunc("/stream/anomalies", handler.StreamAnomalies)
+	mux.HandleFunc("/stream/results", handler.StreamResults)
+	mux.HandleFunc("/ws/results", handler.StreamWebSocket)
+	mux.HandleFunc("/silences", handler.Silences)
+	mux.HandleFunc("/backfill", handler.Backfill)
+	mux.HandleFunc("/anomalies/status", handler.UpdateAnomalyStatus)
+	mux.HandleFunc("/anomalies/unacknowledged", handler.UnacknowledgedAnomalies)
+	mux.HandleFunc("/anomalies/export", handler.ExportAnomalies)
+	mux.HandleFunc(cluster.HandoffPath, handler.ClusterHandoff)
+	if config.RemoteWriteEnabled {
+		mux.HandleFunc("/api/v1/write", handler.RemoteWrite)
+	}
+	if config.OTLPEnabled {
+		mux.HandleFunc("/v1/metrics", handler.OTLPMetrics)
+	}
 
 	// Prometheus metrics endpoint
 	mux.Handle("/prometheus", promhttp.Handler())
@@ -71,6 +239,12 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Shutdown не ждет завершения потоков SSE и не отслеживает WebSocket-соединения,
+	// поэтому закрываем их явно
+	server.RegisterOnShutdown(func() {
+		broker.Close()
+		handler.CloseWebSockets()
+	})
 
 	// Graceful shutdown
 	go func() {
@@ -80,6 +254,59 @@ func main() {
 		}
 	}()
 
+	// Прием метрик из MQTT
+	var mqttSubscriber *mqttinput.Subscriber
+	if config.MQTTEnabled {
+		mqttSubscriber, err = mqttinput.NewSubscriber(mqttinput.Config{
+			Broker:        config.MQTTBroker,
+			ClientID:      config.MQTTClientID,
+			Username:      config.MQTTUsername,
+			Password:      config.MQTTPassword,
+			Topic:         config.MQTTTopic,
+			QoS:           byte(config.MQTTQoS),
+			IngestTimeout: config.MQTTIngestTimeout,
+		}, pipeline)
+		if err != nil {
+			log.Fatalf("Invalid MQTT configuration: %v", err)
+		}
+		mqttSubscriber.Start()
+		log.Printf("MQTT ingestion enabled: broker=%s, topic=%s\n", config.MQTTBroker, config.MQTTTopic)
+	}
+
+	// Прием StatsD и InfluxDB line protocol по UDP
+	var udpListener *udpinput.Listener
+	if config.UDPEnabled {
+		udpListener = udpinput.NewListener(udpinput.Config{
+			Addr:             config.UDPAddr,
+			Format:           config.UDPFormat,
+			DeviceTag:        config.UDPDeviceTag,
+			ForwardQueueSize: config.UDPForwardQueueSize,
+		}, pipeline)
+		if err := udpListener.Start(); err != nil {
+			log.Fatalf("UDP listen error: %v", err)
+		}
+		log.Printf("UDP ingestion listening on %s (format: %s)\n", config.UDPAddr, config.UDPFormat)
+	}
+
+	// gRPC сервер для высокочастотных агентов
+	grpcServer := grpc.NewServer()
+	grpcserver.NewServer(analyzer, redisCache, pipeline).Register(grpcServer)
+	go func() {
+		lis, err := net.Listen("tcp", ":"+config.GRPCPort)
+		if err != nil {
+			log.Fatalf("gRPC listen error: %v", err)
+		}
+		log.Printf("gRPC server listening on port %s\n", config.GRPCPort)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+
+	// Регистрация в кластере после старта сервера, чтобы принимать handoff
+	if clusterNode != nil {
+		clusterNode.Start()
+	}
+
 	// Периодическое обновление метрик
 	go updateMetrics(analyzer)
 
@@ -90,11 +317,37 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	// Прекращаем прием из MQTT; неподтвержденные сообщения останутся у брокера
+	if mqttSubscriber != nil {
+		mqttSubscriber.Stop()
+	}
+	if udpListener != nil {
+		udpListener.Stop()
+	}
+
+	// Передаем окна устройств оставшимся репликам
+	if clusterNode != nil {
+		clusterNode.Stop()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Ошибка не прерывает остановку: отложенные Stop и Close должны выполниться
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Долгие клиентские потоки не должны задерживать остановку дольше общего таймаута
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
 	}
 
 	log.Println("Server stopped gracefully")
@@ -102,26 +355,233 @@ func main() {
 
 // Config конфигурация приложения
 type Config struct {
-	ServerPort       string
+	ServerPort string
+	GRPCPort   string
+	// BatchMaxBody ограничение тела /metrics/batch после распаковки
+	BatchMaxBody     int64
+	RedisMode        string
 	RedisAddr        string
 	RedisPassword    string
 	RedisDB          int
 	WindowSize       int
 	AnomalyThreshold float64
+	// AnomalyDetector zscore или mad
+	AnomalyDetector  string
 	MetricsRetention time.Duration
+	// AllowedLateness допустимое опоздание метрики относительно самой поздней метрики устройства
+	AllowedLateness time.Duration
+
+	RedisMasterName       string
+	RedisSentinelPassword string
+
+	RedisSpoolSize           int
+	RedisReconnectMaxBackoff time.Duration
+
+	RedisMaxRetries          int
+	RedisOperationTimeout    time.Duration
+	RedisOperationTimeouts   map[string]time.Duration
+	RedisBreakerWindow       int
+	RedisBreakerErrorRate    float64
+	RedisBreakerSlowCall     time.Duration
+	RedisBreakerSlowCallRate float64
+	RedisBreakerOpenTimeout  time.Duration
+
+	AlertReceivers string
+	AlertQueueSize int
+
+	AlertCooldown       time.Duration
+	AlertResolveAfter   int
+	AlertResolveTimeout time.Duration
+	SilenceRefresh      time.Duration
+
+	StreamBufferSize  int
+	StreamHistorySize int
+	// StreamAllowedOrigins origin, с которых разрешены WebSocket-подключения
+	StreamAllowedOrigins []string
+
+	MQTTEnabled  bool
+	MQTTBroker   string
+	MQTTClientID string
+	MQTTUsername string
+	MQTTPassword string
+	MQTTTopic    string
+	MQTTQoS      int
+	// MQTTIngestTimeout ожидание места в очереди анализа перед повторной доставкой сообщения
+	MQTTIngestTimeout time.Duration
+
+	RemoteWriteEnabled     bool
+	RemoteWriteDeviceLabel string
+	// RemoteWriteMapping отображение рядов в поля метрики: "cpu=series*scale,rps=series"
+	RemoteWriteMapping string
+
+	OTLPEnabled bool
+	// OTLPDeviceAttributes атрибуты ресурса для device_id в порядке приоритета
+	OTLPDeviceAttributes []string
+	OTLPMapping          string
+
+	UDPEnabled bool
+	UDPAddr    string
+	// UDPFormat statsd, influx или auto
+	UDPFormat    string
+	UDPDeviceTag string
+	// UDPForwardQueueSize сколько пачек чужих устройств может ждать пересылки владельцу
+	UDPForwardQueueSize int
+
+	// ValidationMode reject или clamp для значений вне диапазона
+	ValidationMode         string
+	ValidationCPUMin       float64
+	ValidationCPUMax       float64
+	ValidationRPSMax       float64
+	ValidationMemoryMax    float64
+	ValidationMaxClockSkew time.Duration
+	ValidationMaxAge       time.Duration
+	DeviceIDMaxLength      int
+	DeviceIDPattern        string
+
+	BackfillMaxRunning int
+	BackfillMaxJobs    int
+
+	// DedupStore redis, memory или none, чтобы не отбрасывать повторы по message_id
+	DedupStore      string
+	DedupWindow     time.Duration
+	DedupMemorySize int
+
+	ClusterEnabled       bool
+	ClusterNodeID        string
+	ClusterAdvertiseAddr string
+	ClusterHeartbeat     time.Duration
+	ClusterMemberTTL     time.Duration
+	ClusterVirtualNodes  int
+	// ClusterSecret общий секрет реплик, обязателен при включенном кластере
+	ClusterSecret string
 }
 
 // loadConfig загружает конфигурацию из environment
 func loadConfig() Config {
+	hostname, _ := os.Hostname()
+	serverPort := getEnv("SERVER_PORT", "8080")
+
 	return Config{
-		ServerPort:       getEnv("SERVER_PORT", "8080"),
+		ServerPort:       serverPort,
+		GRPCPort:         getEnv("GRPC_PORT", "50051"),
+		BatchMaxBody:     int64(getEnvAsInt("BATCH_MAX_BODY_MB", 256)) << 20,
+		RedisMode:        getEnv("REDIS_MODE", cache.ModeSingle),
 		RedisAddr:        getEnv("REDIS_ADDR", "localhost:6379"),
 		RedisPassword:    getEnv("REDIS_PASSWORD", ""),
 		RedisDB:          getEnvAsInt("REDIS_DB", 0),
 		WindowSize:       getEnvAsInt("WINDOW_SIZE", 50),
 		AnomalyThreshold: getEnvAsFloat("ANOMALY_THRESHOLD", 2.0),
+		AnomalyDetector:  getEnv("ANOMALY_DETECTOR", analytics.DetectorZScore),
 		MetricsRetention: time.Duration(getEnvAsInt("METRICS_RETENTION_HOURS", 1)) * time.Hour,
+		AllowedLateness:  time.Duration(getEnvAsInt("ALLOWED_LATENESS_SECONDS", 300)) * time.Second,
+
+		RedisMasterName:       getEnv("REDIS_MASTER_NAME", "mymaster"),
+		RedisSentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+
+		RedisSpoolSize:           getEnvAsInt("REDIS_SPOOL_SIZE", 10000),
+		RedisReconnectMaxBackoff: time.Duration(getEnvAsInt("REDIS_RECONNECT_MAX_BACKOFF_SECONDS", 30)) * time.Second,
+
+		RedisMaxRetries:          getEnvAsInt("REDIS_MAX_RETRIES", 1),
+		RedisOperationTimeout:    time.Duration(getEnvAsInt("REDIS_OPERATION_TIMEOUT_MS", 500)) * time.Millisecond,
+		RedisOperationTimeouts:   getEnvAsDurations("REDIS_OPERATION_TIMEOUTS"),
+		RedisBreakerWindow:       getEnvAsInt("REDIS_BREAKER_WINDOW", 100),
+		RedisBreakerErrorRate:    getEnvAsFloat("REDIS_BREAKER_ERROR_RATE", 0.5),
+		RedisBreakerSlowCall:     time.Duration(getEnvAsInt("REDIS_BREAKER_SLOW_CALL_MS", 200)) * time.Millisecond,
+		RedisBreakerSlowCallRate: getEnvAsFloat("REDIS_BREAKER_SLOW_CALL_RATE", 0.5),
+		RedisBreakerOpenTimeout:  time.Duration(getEnvAsInt("REDIS_BREAKER_OPEN_SECONDS", 10)) * time.Second,
+
+		AlertReceivers: getEnv("ALERT_RECEIVERS", ""),
+		AlertQueueSize: getEnvAsInt("ALERT_QUEUE_SIZE", 1000),
+
+		AlertCooldown:       time.Duration(getEnvAsInt("ALERT_COOLDOWN_SECONDS", 300)) * time.Second,
+		AlertResolveAfter:   getEnvAsInt("ALERT_RESOLVE_AFTER", 5),
+		AlertResolveTimeout: time.Duration(getEnvAsInt("ALERT_RESOLVE_TIMEOUT_SECONDS", 600)) * time.Second,
+		SilenceRefresh:      time.Duration(getEnvAsInt("SILENCE_REFRESH_SECONDS", 10)) * time.Second,
+
+		StreamBufferSize:     getEnvAsInt("STREAM_BUFFER_SIZE", 256),
+		StreamHistorySize:    getEnvAsInt("STREAM_HISTORY_SIZE", 1000),
+		StreamAllowedOrigins: getEnvAsList("STREAM_ALLOWED_ORIGINS", nil),
+
+		MQTTEnabled:  getEnvAsBool("MQTT_ENABLED", false),
+		MQTTBroker:   getEnv("MQTT_BROKER", "tcp://localhost:1883"),
+		MQTTClientID: getEnv("MQTT_CLIENT_ID", "highload-service-"+hostname),
+		MQTTUsername: getEnv("MQTT_USERNAME", ""),
+		MQTTPassword: getEnv("MQTT_PASSWORD", ""),
+		MQTTTopic:    getEnv("MQTT_TOPIC", "devices/"+mqttinput.DeviceIDPlaceholder+"/metrics"),
+		MQTTQoS:      getEnvAsInt("MQTT_QOS", 1),
+
+		MQTTIngestTimeout: time.Duration(getEnvAsInt("MQTT_INGEST_TIMEOUT_MS", 5000)) * time.Millisecond,
+
+		RemoteWriteEnabled:     getEnvAsBool("REMOTE_WRITE_ENABLED", false),
+		RemoteWriteDeviceLabel: getEnv("REMOTE_WRITE_DEVICE_LABEL", "instance"),
+		RemoteWriteMapping: getEnv("REMOTE_WRITE_MAPPING",
+			"cpu=instance:node_cpu_utilisation:rate5m*100,rps=instance:http_requests:rate1m"),
+
+		OTLPEnabled:          getEnvAsBool("OTLP_ENABLED", false),
+		OTLPDeviceAttributes: getEnvAsList("OTLP_DEVICE_ATTRIBUTES", []string{"host.name", "service.instance.id"}),
+		OTLPMapping: getEnv("OTLP_MAPPING",
+			"cpu=system.cpu.utilization*100,rps=http.server.request.duration"),
+
+		UDPEnabled:   getEnvAsBool("UDP_ENABLED", false),
+		UDPAddr:      getEnv("UDP_ADDR", ":8125"),
+		UDPFormat:    getEnv("UDP_FORMAT", udpinput.FormatAuto),
+		UDPDeviceTag: getEnv("UDP_DEVICE_TAG", "device_id"),
+
+		UDPForwardQueueSize: getEnvAsInt("UDP_FORWARD_QUEUE_SIZE", 64),
+
+		ValidationMode:         getEnv("VALIDATION_MODE", ingest.ModeReject),
+		ValidationCPUMin:       getEnvAsFloat("VALIDATION_CPU_MIN", 0),
+		ValidationCPUMax:       getEnvAsFloat("VALIDATION_CPU_MAX", 100),
+		ValidationRPSMax:       getEnvAsFloat("VALIDATION_RPS_MAX", math.Inf(1)),
+		ValidationMemoryMax:    getEnvAsFloat("VALIDATION_MEMORY_MAX", math.Inf(1)),
+		ValidationMaxClockSkew: time.Duration(getEnvAsInt("VALIDATION_MAX_CLOCK_SKEW_SECONDS", 300)) * time.Second,
+		ValidationMaxAge:       time.Duration(getEnvAsInt("VALIDATION_MAX_AGE_HOURS", 24)) * time.Hour,
+		DeviceIDMaxLength:      getEnvAsInt("DEVICE_ID_MAX_LENGTH", 128),
+		DeviceIDPattern:        getEnv("DEVICE_ID_PATTERN", `^[A-Za-z0-9._:-]+$`),
+
+		BackfillMaxRunning: getEnvAsInt("BACKFILL_MAX_RUNNING", 1),
+		BackfillMaxJobs:    getEnvAsInt("BACKFILL_MAX_JOBS", 100),
+
+		DedupStore:      getEnv("DEDUP_STORE", ingest.DedupRedis),
+		DedupWindow:     time.Duration(getEnvAsInt("DEDUP_WINDOW_SECONDS", 600)) * time.Second,
+		DedupMemorySize: getEnvAsInt("DEDUP_MEMORY_SIZE", 100000),
+
+		ClusterEnabled:       getEnvAsBool("CLUSTER_ENABLED", false),
+		ClusterNodeID:        getEnv("CLUSTER_NODE_ID", hostname),
+		ClusterAdvertiseAddr: getEnv("CLUSTER_ADVERTISE_ADDR", hostname+":"+serverPort),
+		ClusterHeartbeat:     time.Duration(getEnvAsInt("CLUSTER_HEARTBEAT_SECONDS", 5)) * time.Second,
+		ClusterMemberTTL:     time.Duration(getEnvAsInt("CLUSTER_MEMBER_TTL_SECONDS", 15)) * time.Second,
+		ClusterVirtualNodes:  getEnvAsInt("CLUSTER_VIRTUAL_NODES", 128),
+		ClusterSecret:        getEnv("CLUSTER_SECRET", ""),
+	}
+}
+
+// validationRules собирает правила проверки входящих метрик из конфигурации
+func validationRules(config Config) (ingest.Rules, error) {
+	rules := ingest.DefaultRules()
+	switch config.ValidationMode {
+	case ingest.ModeReject, ingest.ModeClamp:
+		rules.Mode = config.ValidationMode
+	default:
+		return rules, fmt.Errorf("unknown validation mode %q", config.ValidationMode)
+	}
+
+	rules.CPU = ingest.Range{Min: config.ValidationCPUMin, Max: config.ValidationCPUMax}
+	rules.RPS.Max = config.ValidationRPSMax
+	rules.Memory.Max = config.ValidationMemoryMax
+	rules.MaxClockSkew = config.ValidationMaxClockSkew
+	rules.MaxAge = config.ValidationMaxAge
+	rules.DeviceIDMaxLength = config.DeviceIDMaxLength
+
+	rules.DeviceIDPattern = nil
+	if config.DeviceIDPattern != "" {
+		pattern, err := regexp.Compile(config.DeviceIDPattern)
+		if err != nil {
+			return rules, fmt.Errorf("device id pattern: %w", err)
+		}
+		rules.DeviceIDPattern = pattern
 	}
+	return rules, nil
 }
 
 // getEnv получает environment variable или возвращает default
@@ -146,6 +606,51 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvAsBool получает environment variable как bool
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsList получает environment variable как список значений через запятую
+func getEnvAsList(key string, defaultValue []string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
+
+// getEnvAsDurations получает environment variable вида "name=500ms,other=1s"
+func getEnvAsDurations(key string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Ignoring invalid duration %q for %s in %s\n", value, name, key)
+			continue
+		}
+		result[name] = d
+	}
+	return result
+}
+
 // getEnvAsFloat получает environment variable как float64
 func getEnvAsFloat(key string, defaultValue float64) float64 {
 	valueStr := os.Getenv(key)
@@ -159,41 +664,77 @@ func getEnvAsFloat(key string, defaultValue float64) float64 {
 	return value
 }
 
-// processAnalysisResults обрабатывает результаты анализа
-func processAnalysisResults(analyzer *analytics.Analyzer, redisCache *cache.RedisCache) {
-	resultsChan := analyzer.GetResultsChan()
-
-	for result := range resultsChan {
-		start := time.Now()
+// recordResults обновляет Prometheus метрики по результатам анализа
+func recordResults(analyzer *analytics.Analyzer) {
+	results, _ := analyzer.Subscribe(nil, analytics.SubscribeOptions{
+		Name:       "metrics",
+		BufferSize: 1000,
+		Policy:     analytics.DropOldest,
+	})
 
-		// Обновляем Prometheus метрики
+	for result := range results {
 		metrics.RollingAverage.WithLabelValues(result.DeviceID, "cpu").Set(result.RollingAvgCPU)
 		metrics.RollingAverage.WithLabelValues(result.DeviceID, "rps").Set(result.RollingAvgRPS)
 		metrics.CurrentZScore.WithLabelValues(result.DeviceID, "combined").Set(result.AnomalyScore)
+	}
+}
+
+// storeResults сохраняет результаты анализа в Redis
+func storeResults(analyzer *analytics.Analyzer, redisCache *cache.RedisCache) {
+	results, _ := analyzer.Subscribe(nil, analytics.SubscribeOptions{
+		Name:       "storage",
+		BufferSize: 1000,
+		Policy:     analytics.DropNewest,
+	})
 
-		// Сохраняем результат анализа в Redis
+	for result := range results {
 		go func(r analytics.AnalysisResult) {
-			if err := redisCache.StoreAnalysis(r.DeviceID, r.Timestamp, r); err == nil {
-				metrics.RedisOperations.WithLabelValues("store_analysis", "success").Inc()
-			} else {
-				metrics.RedisOperations.WithLabelValues("store_analysis", "error").Inc()
-			}
+			err := redisCache.StoreAnalysis(context.Background(), r.DeviceID, r.Timestamp, r)
+			metrics.RedisOperations.WithLabelValues("store_analysis", cache.Status(err)).Inc()
 		}(result)
+	}
+}
+
+// streamResults рассылает результаты анализа подписчикам SSE и WebSocket
+func streamResults(analyzer *analytics.Analyzer, broker *stream.Broker) {
+	results, _ := analyzer.Subscribe(nil, analytics.SubscribeOptions{
+		Name:       "stream",
+		BufferSize: 1000,
+		Policy:     analytics.DropOldest,
+	})
+
+	for result := range results {
+		broker.Publish(result)
+	}
+}
+
+// alertResults группирует аномалии в инциденты и оповещает получателей.
+// Медленная запись в Redis не должна задерживать анализ, поэтому при заполненном
+// буфере вытесняются самые старые результаты; потери видны в result_subscriber_dropped_total.
+func alertResults(analyzer *analytics.Analyzer, redisCache *cache.RedisCache, silencer *alerting.Silencer, tracker *alerting.Tracker, notifier *alerting.Notifier) {
+	results, _ := analyzer.Subscribe(nil, analytics.SubscribeOptions{
+		Name:       "alerting",
+		BufferSize: 1000,
+		Policy:     analytics.DropOldest,
+	})
+
+	for result := range results {
+		start := time.Now()
 
-		// Если обнаружена аномалия
 		if result.IsAnomaly {
+			// Заглушенные аномалии не сохраняются и не оповещаются, но учитываются отдельно
+			if _, silenced := silencer.Silenced(result, start); silenced {
+				metrics.AnomaliesSuppressed.WithLabelValues(result.AnomalyType, result.DeviceID).Inc()
+				metrics.AnalysisLatency.Observe(time.Since(start).Seconds())
+				continue
+			}
 			metrics.AnomaliesDetected.WithLabelValues(result.AnomalyType, result.DeviceID).Inc()
+		}
 
-			// Сохраняем аномалию
-			go func(r analytics.AnalysisResult) {
-				if err := redisCache.StoreAnomaly(r.DeviceID, r.Timestamp, r); err == nil {
-					metrics.RedisOperations.WithLabelValues("store_anomaly", "success").Inc()
-					log.Printf("ANOMALY DETECTED: Device=%s, Type=%s, Score=%.2f, CPU=%.2f, RPS=%.2f\n",
-						r.DeviceID, r.AnomalyType, r.AnomalyScore, r.RollingAvgCPU, r.RollingAvgRPS)
-				} else {
-					metrics.RedisOperations.WithLabelValues("store_anomaly", "error").Inc()
-				}
-			}(result)
+		// Последовательные аномалии группируются в инциденты:
+		// сохраняем и оповещаем только при открытии, повторе и закрытии
+		for _, event := range tracker.Process(result, time.Now()) {
+			handleIncidentEvent(event, redisCache, notifier)
 		}
 
 		// Записываем задержку анализа
@@ -201,6 +742,44 @@ func processAnalysisResults(analyzer *analytics.Analyzer, redisCache *cache.Redi
 	}
 }
 
+// handleIncidentEvent сохраняет инцидент и оповещает получателей
+func handleIncidentEvent(event alerting.Event, redisCache *cache.RedisCache, notifier *alerting.Notifier) {
+	incident := event.Incident
+	metrics.IncidentEvents.WithLabelValues(event.Kind).Inc()
+
+	switch event.Kind {
+	case alerting.EventOpened:
+		log.Printf("ANOMALY DETECTED: Device=%s, Type=%s, Score=%.2f, CPU=%.2f, RPS=%.2f\n",
+			incident.DeviceID, incident.AnomalyType, incident.LastScore, incident.RollingAvgCPU, incident.RollingAvgRPS)
+	case alerting.EventResolved:
+		log.Printf("ANOMALY RESOLVED: Device=%s, Type=%s, Count=%d, MaxScore=%.2f, Duration=%s\n",
+			incident.DeviceID, incident.AnomalyType, incident.Count, incident.MaxScore, incident.EndsAt.Sub(incident.StartsAt))
+	}
+
+	// Инцидент хранится под ключом типа и времени открытия, поэтому закрытие обновляет ту же запись
+	if event.Kind != alerting.EventRepeated {
+		go func() {
+			err := redisCache.StoreAnomaly(context.Background(), incident.DeviceID, incident.AnomalyType, incident.StartsAt, incident)
+			metrics.RedisOperations.WithLabelValues("store_anomaly", cache.Status(err)).Inc()
+		}()
+	}
+
+	notifier.Notify(incident.Alert())
+}
+
+// sweepIncidents периодически закрывает инциденты устройств, переставших присылать аномалии
+func sweepIncidents(tracker *alerting.Tracker, redisCache *cache.RedisCache, notifier *alerting.Notifier) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, event := range tracker.Sweep(now) {
+			handleIncidentEvent(event, redisCache, notifier)
+		}
+		metrics.OpenIncidents.Set(float64(tracker.OpenIncidents()))
+	}
+}
+
 // updateMetrics периодически обновляет метрики
 func updateMetrics(analyzer *analytics.Analyzer) {
 	ticker := time.NewTicker(5 * time.Second)
@@ -216,5 +795,9 @@ func updateMetrics(analyzer *analytics.Analyzer) {
 		if queueSize, ok := stats["queue_size"].(int); ok {
 			metrics.QueueSize.Set(float64(queueSize))
 		}
+
+		for _, sub := range analyzer.SubscriberStats() {
+			metrics.ResultSubscriberBuffered.WithLabelValues(sub.Name).Set(float64(sub.Buffered))
+		}
 	}
 }
@@ -0,0 +1,51 @@
+package alerting
+
+import (
+	"fmt"
+	"time"
+)
+
+// Статусы оповещения
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert оповещение об аномалии устройства
+type Alert struct {
+	Fingerprint   string            `json:"fingerprint"`
+	Status        string            `json:"status"`
+	DeviceID      string            `json:"device_id"`
+	AnomalyType   string            `json:"anomaly_type"`
+	AnomalyScore  float64           `json:"anomaly_score"`
+	RollingAvgCPU float64           `json:"rolling_avg_cpu"`
+	RollingAvgRPS float64           `json:"rolling_avg_rps"`
+	StartsAt      time.Time         `json:"starts_at"`
+	EndsAt        *time.Time        `json:"ends_at,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// Fingerprint идентификатор оповещения для дедупликации на стороне получателя
+func Fingerprint(deviceID, anomalyType string) string {
+	return deviceID + "/" + anomalyType
+}
+
+// Summary краткое описание оповещения
+func (a Alert) Summary() string {
+	if a.Status == StatusResolved {
+		return fmt.Sprintf("[RESOLVED] %s on device %s", a.AnomalyType, a.DeviceID)
+	}
+	return fmt.Sprintf("[FIRING] %s on device %s (score %.2f)", a.AnomalyType, a.DeviceID, a.AnomalyScore)
+}
+
+// Severity уровень важности оповещения
+func (a Alert) Severity() string {
+	switch {
+	case a.AnomalyType == "MULTIPLE_ANOMALY":
+		return "critical"
+	case a.AnomalyScore >= 4:
+		return "error"
+	default:
+		return "warning"
+	}
+}
@@ -0,0 +1,176 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"highload-final/internal/metrics"
+)
+
+// Notifier доставляет оповещения получателям через webhook
+type Notifier struct {
+	receivers []ReceiverConfig
+	client    *http.Client
+	queue     chan Alert
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+
+	// retryBackoff задержка перед первой повторной попыткой, далее удваивается
+	retryBackoff time.Duration
+}
+
+// NewNotifier создает notifier с очередью заданного размера
+func NewNotifier(receivers []ReceiverConfig, queueSize int) *Notifier {
+	return &Notifier{
+		receivers:    receivers,
+		client:       &http.Client{},
+		queue:        make(chan Alert, queueSize),
+		stopChan:     make(chan struct{}),
+		retryBackoff: 500 * time.Millisecond,
+	}
+}
+
+// Start запускает обработчики доставки
+func (n *Notifier) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		n.wg.Add(1)
+		go n.run()
+	}
+}
+
+// Stop останавливает доставку, дожидаясь отправки уже взятых оповещений
+func (n *Notifier) Stop() {
+	close(n.stopChan)
+	n.wg.Wait()
+}
+
+// Notify ставит оповещение в очередь; при переполнении оповещение отбрасывается
+func (n *Notifier) Notify(alert Alert) {
+	if len(n.receivers) == 0 {
+		return
+	}
+
+	select {
+	case n.queue <- alert:
+	default:
+		metrics.AlertsDropped.Inc()
+		log.Printf("Alert queue is full, dropping alert %s\n", alert.Fingerprint)
+	}
+}
+
+// run обрабатывает очередь оповещений
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.stopChan:
+			return
+		case alert := <-n.queue:
+			for _, receiver := range n.receivers {
+				n.deliver(receiver, alert)
+			}
+		}
+	}
+}
+
+// deliver отправляет оповещение получателю с повторами
+func (n *Notifier) deliver(receiver ReceiverConfig, alert Alert) {
+	payload, err := buildPayload(receiver, alert)
+	if err != nil {
+		metrics.AlertNotifications.WithLabelValues(receiver.Name, "error").Inc()
+		log.Printf("Alert %s: failed to build payload for %s: %v\n", alert.Fingerprint, receiver.Name, err)
+		return
+	}
+
+	maxRetries := receiver.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	backoff := n.retryBackoff
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-n.stopChan:
+				metrics.AlertNotifications.WithLabelValues(receiver.Name, "error").Inc()
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			metrics.AlertNotifications.WithLabelValues(receiver.Name, "retry").Inc()
+		}
+
+		start := time.Now()
+		err = n.send(receiver, payload)
+		metrics.AlertDeliveryDuration.WithLabelValues(receiver.Name).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			metrics.AlertNotifications.WithLabelValues(receiver.Name, "success").Inc()
+			return
+		}
+		if !isRetryable(err) {
+			break
+		}
+	}
+
+	metrics.AlertNotifications.WithLabelValues(receiver.Name, "error").Inc()
+	log.Printf("Alert %s: delivery to %s failed: %v\n", alert.Fingerprint, receiver.Name, err)
+}
+
+// deliveryError ошибка доставки с признаком возможности повтора
+type deliveryError struct {
+	err       error
+	retryable bool
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// isRetryable проверяет, имеет ли смысл повторить доставку
+func isRetryable(err error) bool {
+	if de, ok := err.(*deliveryError); ok {
+		return de.retryable
+	}
+	return true
+}
+
+// send выполняет одну попытку доставки
+func (n *Notifier) send(receiver ReceiverConfig, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), receiver.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, receiver.URL, bytes.NewReader(payload))
+	if err != nil {
+		return &deliveryError{err: err, retryable: false}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range receiver.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// 4xx (кроме 429) означает ошибку в запросе, повтор не поможет
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return &deliveryError{
+		err:       fmt.Errorf("receiver responded with status %d", resp.StatusCode),
+		retryable: retryable,
+	}
+}
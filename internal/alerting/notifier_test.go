@@ -0,0 +1,185 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAlert оповещение для проверки формата запросов
+func testAlert() Alert {
+	return Alert{
+		Fingerprint:   Fingerprint("web-1", "CPU_SPIKE"),
+		Status:        StatusFiring,
+		DeviceID:      "web-1",
+		AnomalyType:   "CPU_SPIKE",
+		AnomalyScore:  4.5,
+		RollingAvgCPU: 90,
+		RollingAvgRPS: 100,
+		StartsAt:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// newTestNotifier создает notifier с короткой задержкой повторов
+func newTestNotifier() *Notifier {
+	n := NewNotifier(nil, 1)
+	n.retryBackoff = time.Millisecond
+	return n
+}
+
+func TestDeliverPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		receiver ReceiverConfig
+		check    func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name:     "webhook",
+			receiver: ReceiverConfig{Name: "hook", Type: ReceiverWebhook, Headers: map[string]string{"Authorization": "Bearer token"}},
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["version"] != "1" {
+					t.Errorf("version = %v, want 1", body["version"])
+				}
+				alert, _ := body["alert"].(map[string]interface{})
+				if alert["fingerprint"] != "web-1/CPU_SPIKE" || alert["status"] != StatusFiring || alert["device_id"] != "web-1" {
+					t.Errorf("alert = %v", alert)
+				}
+			},
+		},
+		{
+			name:     "slack",
+			receiver: ReceiverConfig{Name: "slack", Type: ReceiverSlack},
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["text"] != "[FIRING] CPU_SPIKE on device web-1 (score 4.50)" {
+					t.Errorf("text = %v", body["text"])
+				}
+				attachments, _ := body["attachments"].([]interface{})
+				if len(attachments) != 1 {
+					t.Fatalf("attachments = %v", body["attachments"])
+				}
+				attachment := attachments[0].(map[string]interface{})
+				if attachment["color"] != "danger" {
+					t.Errorf("color = %v, want danger", attachment["color"])
+				}
+				if fields, _ := attachment["fields"].([]interface{}); len(fields) != 4 {
+					t.Errorf("fields = %v, want 4 fields", attachment["fields"])
+				}
+			},
+		},
+		{
+			name:     "pagerduty",
+			receiver: ReceiverConfig{Name: "pd", Type: ReceiverPagerDuty, RoutingKey: "key-1"},
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["routing_key"] != "key-1" || body["event_action"] != "trigger" || body["dedup_key"] != "web-1/CPU_SPIKE" {
+					t.Errorf("event = %v", body)
+				}
+				payload, _ := body["payload"].(map[string]interface{})
+				if payload["severity"] != "error" || payload["source"] != "web-1" || payload["timestamp"] != "2024-01-02T03:04:05Z" {
+					t.Errorf("payload = %v", payload)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				body    []byte
+				headers http.Header
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				body, _ = io.ReadAll(r.Body)
+				headers = r.Header.Clone()
+			}))
+			defer server.Close()
+
+			tt.receiver.URL = server.URL
+			newTestNotifier().deliver(tt.receiver, testAlert())
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ct := headers.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			for k, v := range tt.receiver.Headers {
+				if headers.Get(k) != v {
+					t.Errorf("header %s = %q, want %q", k, headers.Get(k), v)
+				}
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("invalid payload %q: %v", body, err)
+			}
+			tt.check(t, decoded)
+		})
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantAttempts int32
+	}{
+		{"success", []int{200}, 3, 1},
+		{"retry on 5xx", []int{503, 500, 200}, 3, 3},
+		{"retry on 429", []int{429, 202}, 3, 2},
+		{"no retry on 4xx", []int{400, 200}, 3, 1},
+		{"no retry on 404", []int{404, 200}, 3, 1},
+		{"retries exhausted", []int{500, 500, 500, 500}, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1)) - 1
+				if n >= len(tt.statuses) {
+					n = len(tt.statuses) - 1
+				}
+				w.WriteHeader(tt.statuses[n])
+			}))
+			defer server.Close()
+
+			receiver := ReceiverConfig{Name: "hook", Type: ReceiverWebhook, URL: server.URL, MaxRetries: tt.maxRetries}
+			newTestNotifier().deliver(receiver, testAlert())
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDeliverTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	receiver := ReceiverConfig{Name: "slow", Type: ReceiverWebhook, URL: server.URL, TimeoutMs: 20, MaxRetries: 1}
+	start := time.Now()
+	newTestNotifier().deliver(receiver, testAlert())
+
+	// Таймаут попытки считается повторяемой ошибкой
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("delivery took %s, attempts must be bounded by the receiver timeout", elapsed)
+	}
+}
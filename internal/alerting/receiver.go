@@ -0,0 +1,131 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Типы получателей оповещений
+const (
+	ReceiverWebhook   = "webhook"
+	ReceiverSlack     = "slack"
+	ReceiverPagerDuty = "pagerduty"
+)
+
+// ReceiverConfig настройки получателя оповещений
+type ReceiverConfig struct {
+	Name string `json:"name"`
+	// Type формат тела запроса: webhook, slack или pagerduty
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// RoutingKey ключ интеграции PagerDuty Events API v2
+	RoutingKey string            `json:"routing_key,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	TimeoutMs  int               `json:"timeout_ms,omitempty"`
+	MaxRetries int               `json:"max_retries,omitempty"`
+}
+
+// timeout возвращает таймаут одной попытки доставки
+func (c ReceiverConfig) timeout() time.Duration {
+	if c.TimeoutMs <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
+
+// ParseReceivers разбирает JSON-массив получателей (переменная ALERT_RECEIVERS)
+func ParseReceivers(data string) ([]ReceiverConfig, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var receivers []ReceiverConfig
+	if err := json.Unmarshal([]byte(data), &receivers); err != nil {
+		return nil, fmt.Errorf("failed to parse receivers: %w", err)
+	}
+
+	for i, r := range receivers {
+		if r.URL == "" {
+			return nil, fmt.Errorf("receiver %d: url is required", i)
+		}
+		if r.Name == "" {
+			receivers[i].Name = fmt.Sprintf("receiver-%d", i)
+		}
+		switch r.Type {
+		case "":
+			receivers[i].Type = ReceiverWebhook
+		case ReceiverWebhook, ReceiverSlack:
+		case ReceiverPagerDuty:
+			if r.RoutingKey == "" {
+				return nil, fmt.Errorf("receiver %s: routing_key is required for pagerduty", r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("receiver %s: unknown type %q", r.Name, r.Type)
+		}
+	}
+
+	return receivers, nil
+}
+
+// buildPayload формирует тело запроса в формате получателя
+func buildPayload(config ReceiverConfig, alert Alert) ([]byte, error) {
+	switch config.Type {
+	case ReceiverSlack:
+		return json.Marshal(slackPayload(alert))
+	case ReceiverPagerDuty:
+		return json.Marshal(pagerDutyPayload(config.RoutingKey, alert))
+	default:
+		return json.Marshal(map[string]interface{}{
+			"version": "1",
+			"alert":   alert,
+		})
+	}
+}
+
+// slackPayload сообщение для Slack incoming webhook
+func slackPayload(alert Alert) map[string]interface{} {
+	color := "danger"
+	if alert.Status == StatusResolved {
+		color = "good"
+	}
+
+	return map[string]interface{}{
+		"text": alert.Summary(),
+		"attachments": []map[string]interface{}{
+			{
+				"color": color,
+				"fields": []map[string]interface{}{
+					{"title": "Device", "value": alert.DeviceID, "short": true},
+					{"title": "Type", "value": alert.AnomalyType, "short": true},
+					{"title": "Score", "value": fmt.Sprintf("%.2f", alert.AnomalyScore), "short": true},
+					{"title": "Rolling CPU / RPS", "value": fmt.Sprintf("%.2f / %.2f", alert.RollingAvgCPU, alert.RollingAvgRPS), "short": true},
+				},
+				"ts": alert.StartsAt.Unix(),
+			},
+		},
+	}
+}
+
+// pagerDutyPayload событие PagerDuty Events API v2
+func pagerDutyPayload(routingKey string, alert Alert) map[string]interface{} {
+	action := "trigger"
+	if alert.Status == StatusResolved {
+		action = "resolve"
+	}
+
+	return map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": action,
+		"dedup_key":    alert.Fingerprint,
+		"payload": map[string]interface{}{
+			"summary":        alert.Summary(),
+			"source":         alert.DeviceID,
+			"severity":       alert.Severity(),
+			"timestamp":      alert.StartsAt.Format(time.RFC3339),
+			"component":      "highload-service",
+			"class":          alert.AnomalyType,
+			"custom_details": alert,
+		},
+	}
+}
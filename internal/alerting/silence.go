@@ -0,0 +1,220 @@
+package alerting
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+)
+
+// ErrInvalidSilence silence не прошел проверку
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// Matchers условия, которым должна удовлетворять аномалия, чтобы быть заглушенной.
+// Пустое поле совпадает с любым значением.
+type Matchers struct {
+	// DeviceID идентификатор или шаблон устройства (например, "sensor-*")
+	DeviceID string `json:"device_id,omitempty"`
+	// AnomalyType тип аномалии (CPU_SPIKE, RPS_DROP, ...)
+	AnomalyType string `json:"anomaly_type,omitempty"`
+	// Tags метки, которые должны присутствовать у устройства с теми же значениями
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Silence правило, заглушающее оповещения на заданный интервал времени
+type Silence struct {
+	ID        string    `json:"id"`
+	Matchers  Matchers  `json:"matchers"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate проверяет корректность silence
+func (s Silence) Validate() error {
+	if s.Matchers.DeviceID == "" && s.Matchers.AnomalyType == "" && len(s.Matchers.Tags) == 0 {
+		return errors.New("at least one matcher is required")
+	}
+	if _, err := path.Match(s.Matchers.DeviceID, ""); err != nil {
+		return fmt.Errorf("invalid device_id pattern: %w", err)
+	}
+	if s.EndsAt.IsZero() {
+		return errors.New("ends_at is required")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Active проверяет, действует ли silence в момент at
+func (s Silence) Active(at time.Time) bool {
+	return !at.Before(s.StartsAt) && at.Before(s.EndsAt)
+}
+
+// Matches проверяет, заглушает ли silence результат анализа, полученный в момент now.
+// Интервал проверяется по времени сервера: время метрики задает устройство и может расходиться с ним.
+func (s Silence) Matches(result analytics.AnalysisResult, now time.Time) bool {
+	if !s.Active(now) {
+		return false
+	}
+	if s.Matchers.DeviceID != "" {
+		if ok, _ := path.Match(s.Matchers.DeviceID, result.DeviceID); !ok {
+			return false
+		}
+	}
+	if s.Matchers.AnomalyType != "" && s.Matchers.AnomalyType != result.AnomalyType {
+		return false
+	}
+	for k, v := range s.Matchers.Tags {
+		if result.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Silencer хранит silences в Redis и держит их копию в памяти для быстрой проверки
+type Silencer struct {
+	cache    *cache.RedisCache
+	silences map[string]Silence
+	mu       sync.RWMutex
+}
+
+// NewSilencer создает silencer
+func NewSilencer(redisCache *cache.RedisCache) *Silencer {
+	return &Silencer{
+		cache:    redisCache,
+		silences: make(map[string]Silence),
+	}
+}
+
+// Silenced возвращает silence, заглушающий результат анализа, полученный в момент now
+func (s *Silencer) Silenced(result analytics.AnalysisResult, now time.Time) (Silence, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, silence := range s.silences {
+		if silence.Matches(result, now) {
+			return silence, true
+		}
+	}
+	return Silence{}, false
+}
+
+// Create сохраняет новый silence
+func (s *Silencer) Create(ctx context.Context, silence Silence) (Silence, error) {
+	now := time.Now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if err := silence.Validate(); err != nil {
+		return Silence{}, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+	}
+
+	silence.ID = newSilenceID()
+	silence.CreatedAt = now
+
+	if err := s.cache.SaveSilence(ctx, silence.ID, silence); err != nil {
+		return Silence{}, err
+	}
+
+	s.mu.Lock()
+	s.silences[silence.ID] = silence
+	s.mu.Unlock()
+
+	return silence, nil
+}
+
+// Delete удаляет silence; возвращает false, если он не найден
+func (s *Silencer) Delete(ctx context.Context, id string) (bool, error) {
+	deleted, err := s.cache.DeleteSilence(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	delete(s.silences, id)
+	s.mu.Unlock()
+
+	return deleted, nil
+}
+
+// List возвращает silences, отсортированные по времени начала
+func (s *Silencer) List() []Silence {
+	s.mu.RLock()
+	silences := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(silences, func(i, j int) bool {
+		return silences[i].StartsAt.Before(silences[j].StartsAt)
+	})
+	return silences
+}
+
+// Refresh перечитывает silences из Redis (изменения других реплик) и удаляет истекшие
+func (s *Silencer) Refresh(ctx context.Context) error {
+	raw, err := s.cache.ListSilences(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	silences := make(map[string]Silence, len(raw))
+	for _, item := range raw {
+		var silence Silence
+		if err := json.Unmarshal([]byte(item), &silence); err != nil {
+			log.Printf("Skipping invalid silence: %v\n", err)
+			continue
+		}
+
+		if !now.Before(silence.EndsAt) {
+			if _, err := s.cache.DeleteSilence(ctx, silence.ID); err != nil {
+				log.Printf("Failed to delete expired silence %s: %v\n", silence.ID, err)
+			}
+			continue
+		}
+		silences[silence.ID] = silence
+	}
+
+	s.mu.Lock()
+	s.silences = silences
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run периодически обновляет silences
+func (s *Silencer) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(context.Background()); err != nil && !errors.Is(err, cache.ErrUnavailable) {
+			log.Printf("Failed to refresh silences: %v\n", err)
+		}
+		<-ticker.C
+	}
+}
+
+// newSilenceID генерирует случайный идентификатор silence
+func newSilenceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
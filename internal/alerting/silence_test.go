@@ -0,0 +1,96 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := func(m Matchers) Silence {
+		return Silence{Matchers: m, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	}
+	result := analytics.AnalysisResult{
+		DeviceID:    "sensor-42",
+		AnomalyType: "CPU_SPIKE",
+		Tags:        map[string]string{"site": "eu", "rack": "r1"},
+		// Часы устройства отстают на сутки
+		Timestamp: now.Add(-24 * time.Hour),
+	}
+
+	tests := []struct {
+		name    string
+		silence Silence
+		at      time.Time
+		want    bool
+	}{
+		{"exact device", window(Matchers{DeviceID: "sensor-42"}), now, true},
+		{"other device", window(Matchers{DeviceID: "sensor-4"}), now, false},
+		{"star glob", window(Matchers{DeviceID: "sensor-*"}), now, true},
+		{"question glob", window(Matchers{DeviceID: "sensor-4?"}), now, true},
+		{"class glob", window(Matchers{DeviceID: "sensor-[0-3]2"}), now, false},
+		{"any device", window(Matchers{DeviceID: "*"}), now, true},
+		{"type", window(Matchers{AnomalyType: "CPU_SPIKE"}), now, true},
+		{"other type", window(Matchers{AnomalyType: "RPS_SPIKE"}), now, false},
+		{"tag subset", window(Matchers{Tags: map[string]string{"site": "eu"}}), now, true},
+		{"tag value differs", window(Matchers{Tags: map[string]string{"site": "us"}}), now, false},
+		{"missing tag", window(Matchers{Tags: map[string]string{"zone": "a"}}), now, false},
+		{"all matchers", window(Matchers{DeviceID: "sensor-*", AnomalyType: "CPU_SPIKE", Tags: map[string]string{"rack": "r1"}}), now, true},
+		{"one matcher fails", window(Matchers{DeviceID: "sensor-*", AnomalyType: "CPU_DROP", Tags: map[string]string{"rack": "r1"}}), now, false},
+		{"starts at is inclusive", window(Matchers{DeviceID: "sensor-42"}), now.Add(-time.Hour), true},
+		{"ends at is exclusive", window(Matchers{DeviceID: "sensor-42"}), now.Add(time.Hour), false},
+		{"not started", window(Matchers{DeviceID: "sensor-42"}), now.Add(-2 * time.Hour), false},
+		{"expired", window(Matchers{DeviceID: "sensor-42"}), now.Add(2 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.Matches(result, tt.at); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilenceValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		silence Silence
+		wantErr bool
+	}{
+		{"valid", Silence{Matchers: Matchers{DeviceID: "sensor-*"}, StartsAt: now, EndsAt: now.Add(time.Hour)}, false},
+		{"tags only", Silence{Matchers: Matchers{Tags: map[string]string{"site": "eu"}}, StartsAt: now, EndsAt: now.Add(time.Hour)}, false},
+		{"no matchers", Silence{StartsAt: now, EndsAt: now.Add(time.Hour)}, true},
+		{"bad pattern", Silence{Matchers: Matchers{DeviceID: "sensor-["}, StartsAt: now, EndsAt: now.Add(time.Hour)}, true},
+		{"no end", Silence{Matchers: Matchers{AnomalyType: "CPU_SPIKE"}, StartsAt: now}, true},
+		{"ends before start", Silence{Matchers: Matchers{AnomalyType: "CPU_SPIKE"}, StartsAt: now, EndsAt: now.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.silence.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSilencerSilenced(t *testing.T) {
+	now := time.Now()
+	s := NewSilencer(nil)
+	s.silences["a"] = Silence{ID: "a", Matchers: Matchers{DeviceID: "web-*"}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Minute)}
+	s.silences["b"] = Silence{ID: "b", Matchers: Matchers{AnomalyType: "RPS_DROP"}, StartsAt: now.Add(time.Minute), EndsAt: now.Add(time.Hour)}
+
+	if silence, ok := s.Silenced(analytics.AnalysisResult{DeviceID: "web-1", AnomalyType: "CPU_SPIKE"}, now); !ok || silence.ID != "a" {
+		t.Errorf("Silenced() = %s, %v; want silence a", silence.ID, ok)
+	}
+	// Silence b еще не начался
+	if _, ok := s.Silenced(analytics.AnalysisResult{DeviceID: "db-1", AnomalyType: "RPS_DROP"}, now); ok {
+		t.Error("pending silence must not match")
+	}
+	if silence, ok := s.Silenced(analytics.AnalysisResult{DeviceID: "db-1", AnomalyType: "RPS_DROP"}, now.Add(2*time.Minute)); !ok || silence.ID != "b" {
+		t.Errorf("Silenced() = %s, %v; want silence b", silence.ID, ok)
+	}
+}
@@ -0,0 +1,191 @@
+package alerting
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"highload-final/internal/analytics"
+)
+
+// Виды событий жизненного цикла инцидента
+const (
+	EventOpened   = "opened"
+	EventRepeated = "repeated"
+	EventResolved = "resolved"
+)
+
+// TrackerConfig настройки жизненного цикла инцидентов
+type TrackerConfig struct {
+	// Cooldown минимальный интервал между повторными оповещениями по открытому инциденту
+	Cooldown time.Duration
+	// ResolveAfter число подряд идущих нормальных результатов для закрытия инцидента
+	ResolveAfter int
+	// ResolveTimeout закрывает инцидент, если аномалий не было дольше этого времени
+	// (например, устройство перестало присылать метрики)
+	ResolveTimeout time.Duration
+}
+
+// Incident группа последовательных аномалий одного типа на устройстве
+type Incident struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"device_id"`
+	AnomalyType string    `json:"anomaly_type"`
+	Status      string    `json:"status"`
+	StartsAt    time.Time `json:"starts_at"`
+	// LastSeen время получения последней аномалии (не время метрики устройства)
+	LastSeen      time.Time         `json:"last_seen"`
+	EndsAt        *time.Time        `json:"ends_at,omitempty"`
+	Count         int               `json:"count"`
+	MaxScore      float64           `json:"max_score"`
+	LastScore     float64           `json:"last_score"`
+	RollingAvgCPU float64           `json:"rolling_avg_cpu"`
+	RollingAvgRPS float64           `json:"rolling_avg_rps"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	// Source происхождение инцидента; пусто для живого потока метрик
+	Source string `json:"source,omitempty"`
+
+	lastNotified time.Time
+	normalStreak int
+}
+
+// Alert формирует оповещение по инциденту
+func (i *Incident) Alert() Alert {
+	return Alert{
+		Fingerprint:   Fingerprint(i.DeviceID, i.AnomalyType),
+		Status:        i.Status,
+		DeviceID:      i.DeviceID,
+		AnomalyType:   i.AnomalyType,
+		AnomalyScore:  i.MaxScore,
+		RollingAvgCPU: i.RollingAvgCPU,
+		RollingAvgRPS: i.RollingAvgRPS,
+		StartsAt:      i.StartsAt,
+		EndsAt:        i.EndsAt,
+		Tags:          i.Tags,
+	}
+}
+
+// Event событие жизненного цикла инцидента
+type Event struct {
+	Kind     string
+	Incident Incident
+}
+
+// Tracker отслеживает инциденты по результатам анализатора
+type Tracker struct {
+	config    TrackerConfig
+	incidents map[string]*Incident
+	mu        sync.Mutex
+}
+
+// NewTracker создает трекер инцидентов
+func NewTracker(config TrackerConfig) *Tracker {
+	if config.ResolveAfter <= 0 {
+		config.ResolveAfter = 5
+	}
+	return &Tracker{
+		config:    config,
+		incidents: make(map[string]*Incident),
+	}
+}
+
+// Process обновляет инциденты устройства по очередному результату анализа.
+// at - время получения результата: для живого потока время сервера, по которому
+// Sweep закрывает инциденты, а не время метрики, которое может отставать.
+func (t *Tracker) Process(result analytics.AnalysisResult, at time.Time) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !result.IsAnomaly {
+		return t.recordNormal(result)
+	}
+
+	key := Fingerprint(result.DeviceID, result.AnomalyType)
+	incident, exists := t.incidents[key]
+	if !exists {
+		incident = &Incident{
+			ID:           fmt.Sprintf("%s:%d", key, result.Timestamp.UnixNano()),
+			DeviceID:     result.DeviceID,
+			AnomalyType:  result.AnomalyType,
+			Status:       StatusFiring,
+			StartsAt:     result.Timestamp,
+			lastNotified: at,
+		}
+		t.incidents[key] = incident
+	}
+
+	incident.Count++
+	incident.LastSeen = at
+	incident.LastScore = result.AnomalyScore
+	incident.RollingAvgCPU = result.RollingAvgCPU
+	incident.RollingAvgRPS = result.RollingAvgRPS
+	incident.Tags = result.Tags
+	incident.normalStreak = 0
+	if result.AnomalyScore > incident.MaxScore {
+		incident.MaxScore = result.AnomalyScore
+	}
+
+	if !exists {
+		return []Event{{Kind: EventOpened, Incident: *incident}}
+	}
+
+	if t.config.Cooldown > 0 && at.Sub(incident.lastNotified) >= t.config.Cooldown {
+		incident.lastNotified = at
+		return []Event{{Kind: EventRepeated, Incident: *incident}}
+	}
+
+	return nil
+}
+
+// recordNormal учитывает нормальный результат для открытых инцидентов устройства
+func (t *Tracker) recordNormal(result analytics.AnalysisResult) []Event {
+	var events []Event
+
+	for key, incident := range t.incidents {
+		if incident.DeviceID != result.DeviceID {
+			continue
+		}
+
+		incident.normalStreak++
+		if incident.normalStreak >= t.config.ResolveAfter {
+			events = append(events, Event{Kind: EventResolved, Incident: t.resolve(key, result.Timestamp)})
+		}
+	}
+
+	return events
+}
+
+// Sweep закрывает инциденты, по которым давно не было аномалий
+func (t *Tracker) Sweep(now time.Time) []Event {
+	if t.config.ResolveTimeout <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events []Event
+	for key, incident := range t.incidents {
+		if now.Sub(incident.LastSeen) >= t.config.ResolveTimeout {
+			events = append(events, Event{Kind: EventResolved, Incident: t.resolve(key, now)})
+		}
+	}
+	return events
+}
+
+// resolve закрывает инцидент и удаляет его из открытых
+func (t *Tracker) resolve(key string, at time.Time) Incident {
+	incident := t.incidents[key]
+	delete(t.incidents, key)
+
+	incident.Status = StatusResolved
+	incident.EndsAt = &at
+	return *incident
+}
+
+// OpenIncidents возвращает количество открытых инцидентов
+func (t *Tracker) OpenIncidents() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.incidents)
+}
@@ -0,0 +1,156 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+)
+
+func TestTrackerLifecycle(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// at время через n секунд от base
+	at := func(n int) time.Time { return base.Add(time.Duration(n) * time.Second) }
+
+	// step результат анализа, полученный сервером в момент received
+	type step struct {
+		device   string
+		anomaly  string
+		received int
+		want     []string
+	}
+
+	tests := []struct {
+		name   string
+		config TrackerConfig
+		steps  []step
+		open   int
+	}{
+		{
+			name:   "open and group",
+			config: TrackerConfig{ResolveAfter: 2},
+			steps: []step{
+				{device: "d1", anomaly: "CPU_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 1},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 2},
+			},
+			open: 1,
+		},
+		{
+			name:   "repeat after cooldown",
+			config: TrackerConfig{Cooldown: 10 * time.Second},
+			steps: []step{
+				{device: "d1", anomaly: "CPU_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 5},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 10, want: []string{EventRepeated}},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 15},
+			},
+			open: 1,
+		},
+		{
+			name:   "resolve after normal streak and reopen",
+			config: TrackerConfig{ResolveAfter: 2},
+			steps: []step{
+				{device: "d1", anomaly: "CPU_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d1", received: 1},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 2},
+				{device: "d1", received: 3},
+				{device: "d1", received: 4, want: []string{EventResolved}},
+				{device: "d1", anomaly: "CPU_SPIKE", received: 5, want: []string{EventOpened}},
+			},
+			open: 1,
+		},
+		{
+			name:   "devices and types are tracked separately",
+			config: TrackerConfig{ResolveAfter: 1},
+			steps: []step{
+				{device: "d1", anomaly: "CPU_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d1", anomaly: "RPS_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d2", anomaly: "CPU_SPIKE", received: 0, want: []string{EventOpened}},
+				{device: "d1", received: 1, want: []string{EventResolved, EventResolved}},
+			},
+			open: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(tt.config)
+			for i, s := range tt.steps {
+				result := analytics.AnalysisResult{
+					DeviceID:    s.device,
+					Timestamp:   at(s.received),
+					IsAnomaly:   s.anomaly != "",
+					AnomalyType: s.anomaly,
+				}
+				events := tracker.Process(result, at(s.received))
+				if len(events) != len(s.want) {
+					t.Fatalf("step %d: events = %+v, want %v", i, events, s.want)
+				}
+				for j, event := range events {
+					if event.Kind != s.want[j] {
+						t.Errorf("step %d: event %d = %s, want %s", i, j, event.Kind, s.want[j])
+					}
+				}
+			}
+			if got := tracker.OpenIncidents(); got != tt.open {
+				t.Errorf("open incidents = %d, want %d", got, tt.open)
+			}
+		})
+	}
+}
+
+func TestTrackerResolvedIncident(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewTracker(TrackerConfig{ResolveAfter: 1})
+
+	tracker.Process(analytics.AnalysisResult{DeviceID: "d1", Timestamp: start, IsAnomaly: true, AnomalyType: "CPU_SPIKE", AnomalyScore: 3}, start)
+	tracker.Process(analytics.AnalysisResult{DeviceID: "d1", Timestamp: start.Add(time.Second), IsAnomaly: true, AnomalyType: "CPU_SPIKE", AnomalyScore: 5}, start)
+	events := tracker.Process(analytics.AnalysisResult{DeviceID: "d1", Timestamp: start.Add(2 * time.Second)}, start)
+
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want one resolved", events)
+	}
+	incident := events[0].Incident
+	if incident.Status != StatusResolved || incident.Count != 2 || incident.MaxScore != 5 || incident.LastScore != 5 {
+		t.Errorf("incident = %+v", incident)
+	}
+	if !incident.StartsAt.Equal(start) || incident.EndsAt == nil || !incident.EndsAt.Equal(start.Add(2*time.Second)) {
+		t.Errorf("incident spans %s - %v, want %s - %s", incident.StartsAt, incident.EndsAt, start, start.Add(2*time.Second))
+	}
+}
+
+func TestTrackerSweepUsesReceiveTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	tracker := NewTracker(TrackerConfig{ResolveTimeout: time.Minute})
+
+	// Устройство присылает метрики с отставанием в час
+	lagging := func(received time.Time) analytics.AnalysisResult {
+		return analytics.AnalysisResult{DeviceID: "d1", Timestamp: received.Add(-time.Hour), IsAnomaly: true, AnomalyType: "CPU_SPIKE"}
+	}
+
+	if events := tracker.Process(lagging(now), now); len(events) != 1 || events[0].Kind != EventOpened {
+		t.Fatalf("events = %+v, want opened", events)
+	}
+	for i := 1; i <= 5; i++ {
+		received := now.Add(time.Duration(i) * 10 * time.Second)
+		if events := tracker.Process(lagging(received), received); len(events) != 0 {
+			t.Fatalf("anomaly %d: events = %+v, want none", i, events)
+		}
+		if events := tracker.Sweep(received); len(events) != 0 {
+			t.Fatalf("sweep %d resolved an active incident of a lagging device: %+v", i, events)
+		}
+	}
+
+	// Инцидент закрывается, когда аномалии перестают приходить
+	last := now.Add(50 * time.Second)
+	if events := tracker.Sweep(last.Add(59 * time.Second)); len(events) != 0 {
+		t.Fatalf("sweep before timeout: events = %+v", events)
+	}
+	events := tracker.Sweep(last.Add(time.Minute))
+	if len(events) != 1 || events[0].Kind != EventResolved {
+		t.Fatalf("sweep after timeout: events = %+v, want resolved", events)
+	}
+	if tracker.OpenIncidents() != 0 {
+		t.Error("resolved incident is still open")
+	}
+}
@@ -1,9 +1,31 @@
 package analytics
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"highload-final/internal/metrics"
+)
+
+// ErrStopped анализатор остановлен и не принимает метрики
+var ErrStopped = errors.New("analyzer is stopped")
+
+// ErrUnknownDetector неизвестный детектор аномалий
+var ErrUnknownDetector = errors.New("unknown anomaly detector")
+
+// Детекторы аномалий
+const (
+	// DetectorZScore отклонение от скользящего среднего в стандартных отклонениях
+	DetectorZScore = "zscore"
+	// DetectorMAD устойчивая к выбросам оценка по медиане и медианному абсолютному отклонению
+	DetectorMAD = "mad"
 )
 
 // MetricWindow хранит скользящее окно метрик
@@ -13,6 +35,10 @@ type MetricWindow struct {
 	timestamps []time.Time
 	mu         sync.RWMutex
 	maxSize    int
+	// latest самое позднее время среди принятых метрик устройства
+	latest time.Time
+	// detached окно передано другой реплике и больше не принимает метрики
+	detached bool
 }
 
 // Analyzer анализатор метрик с rolling average и z-score
@@ -21,10 +47,21 @@ type Analyzer struct {
 	mu               sync.RWMutex
 	windowSize       int
 	anomalyThreshold float64
+	detector         string
 	metricsChan      chan MetricData
-	resultsChan      chan AnalysisResult
 	stopChan         chan struct{}
 	wg               sync.WaitGroup
+
+	// allowedLateness насколько метрика может отставать от самой поздней
+	// метрики устройства, чтобы быть вставленной в окно по времени
+	allowedLateness time.Duration
+	lateReordered   atomic.Int64
+	lateDropped     atomic.Int64
+
+	// Подписчики на результаты анализа
+	subscribers map[*subscriber]struct{}
+	subsClosed  bool
+	subMu       sync.RWMutex
 }
 
 // MetricData данные для анализа
@@ -33,6 +70,7 @@ type MetricData struct {
 	Timestamp time.Time
 	CPU       float64
 	RPS       float64
+	Tags      map[string]string
 }
 
 // AnalysisResult результат анализа
@@ -45,6 +83,7 @@ type AnalysisResult struct {
 	AnomalyScore  float64
 	AnomalyType   string
 	StandardDev   float64
+	Tags          map[string]string
 }
 
 // NewAnalyzer создает новый анализатор
@@ -53,12 +92,30 @@ func NewAnalyzer(windowSize int, anomalyThreshold float64) *Analyzer {
 		windows:          make(map[string]*MetricWindow),
 		windowSize:       windowSize,
 		anomalyThreshold: anomalyThreshold,
+		detector:         DetectorZScore,
 		metricsChan:      make(chan MetricData, 1000),
-		resultsChan:      make(chan AnalysisResult, 1000),
 		stopChan:         make(chan struct{}),
+		subscribers:      make(map[*subscriber]struct{}),
+	}
+}
+
+// SetDetector выбирает детектор аномалий. Вызывается до Start.
+func (a *Analyzer) SetDetector(name string) error {
+	switch name {
+	case DetectorZScore, DetectorMAD:
+		a.detector = name
+		return nil
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownDetector, name)
 	}
 }
 
+// SetAllowedLateness задает допустимое опоздание метрик.
+// Вызывается до Start.
+func (a *Analyzer) SetAllowedLateness(d time.Duration) {
+	a.allowedLateness = d
+}
+
 // Start запускает обработчики в goroutines
 func (a *Analyzer) Start(workers int) {
 	for i := 0; i < workers; i++ {
@@ -72,21 +129,32 @@ func (a *Analyzer) Stop() {
 	close(a.stopChan)
 	a.wg.Wait()
 	close(a.metricsChan)
-	close(a.resultsChan)
+	a.closeSubscribers()
 }
 
-// AddMetric добавляет метрику для анализа
-func (a *Analyzer) AddMetric(data MetricData) {
+// AddMetric добавляет метрику для анализа.
+// Возвращает false, если очередь анализа заполнена и метрика пропущена.
+func (a *Analyzer) AddMetric(data MetricData) bool {
 	select {
 	case a.metricsChan <- data:
+		return true
 	default:
 		// Если канал полон, пропускаем метрику
+		return false
 	}
 }
 
-// GetResultsChan возвращает канал с результатами
-func (a *Analyzer) GetResultsChan() <-chan AnalysisResult {
-	return a.resultsChan
+// AddMetricWait добавляет метрику, ожидая места в очереди анализа.
+// Используется для массовой загрузки, где отправителя лучше притормозить, чем терять данные.
+func (a *Analyzer) AddMetricWait(ctx context.Context, data MetricData) error {
+	select {
+	case a.metricsChan <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.stopChan:
+		return ErrStopped
+	}
 }
 
 // processMetrics обрабатывает метрики из канала
@@ -98,20 +166,26 @@ func (a *Analyzer) processMetrics() {
 		case <-a.stopChan:
 			return
 		case data := <-a.metricsChan:
-			result := a.analyze(data)
-			select {
-			case a.resultsChan <- result:
-			default:
-				// Канал результатов полон
+			if result, ok := a.analyze(data); ok {
+				a.publish(result)
 			}
 		}
 	}
 }
 
-// analyze выполняет анализ метрики
-func (a *Analyzer) analyze(data MetricData) AnalysisResult {
+// Analyze анализирует метрику синхронно, минуя очередь и подписчиков.
+// Используется изолированными экземплярами анализатора без Start (backfill, офлайн-анализ).
+// Возвращает false, если метрика опоздала больше допустимого и отброшена.
+func (a *Analyzer) Analyze(data MetricData) (AnalysisResult, bool) {
+	return a.analyze(data)
+}
+
+// getOrCreateWindow возвращает окно устройства, создавая его при необходимости
+func (a *Analyzer) getOrCreateWindow(deviceID string) *MetricWindow {
 	a.mu.Lock()
-	window, exists := a.windows[data.DeviceID]
+	defer a.mu.Unlock()
+
+	window, exists := a.windows[deviceID]
 	if !exists {
 		window = &MetricWindow{
 			cpuValues:  make([]float64, 0, a.windowSize),
@@ -119,24 +193,43 @@ func (a *Analyzer) analyze(data MetricData) AnalysisResult {
 			timestamps: make([]time.Time, 0, a.windowSize),
 			maxSize:    a.windowSize,
 		}
-		a.windows[data.DeviceID] = window
+		a.windows[deviceID] = window
 	}
-	a.mu.Unlock()
+	return window
+}
 
-	window.mu.Lock()
-	defer window.mu.Unlock()
+// lockWindow возвращает захваченное окно устройства. Если окно успели
+// передать другой реплике, берется новое, чтобы метрика не попала в отданное окно.
+func (a *Analyzer) lockWindow(deviceID string) *MetricWindow {
+	for {
+		window := a.getOrCreateWindow(deviceID)
+		window.mu.Lock()
+		if !window.detached {
+			return window
+		}
+		window.mu.Unlock()
+	}
+}
 
-	// Добавляем новые значения
-	window.cpuValues = append(window.cpuValues, data.CPU)
-	window.rpsValues = append(window.rpsValues, data.RPS)
-	window.timestamps = append(window.timestamps, data.Timestamp)
+// analyze выполняет анализ метрики.
+// Возвращает false, если метрика опоздала больше допустимого и отброшена.
+func (a *Analyzer) analyze(data MetricData) (AnalysisResult, bool) {
+	window := a.lockWindow(data.DeviceID)
+	defer window.mu.Unlock()
 
-	// Ограничиваем размер окна
-	if len(window.cpuValues) > window.maxSize {
-		window.cpuValues = window.cpuValues[1:]
-		window.rpsValues = window.rpsValues[1:]
-		window.timestamps = window.timestamps[1:]
+	// Опоздавшие метрики вставляются в окно по времени, слишком старые отбрасываются
+	if data.Timestamp.Before(window.latest) {
+		if data.Timestamp.Before(window.latest.Add(-a.allowedLateness)) {
+			a.lateDropped.Add(1)
+			metrics.LateSamplesDropped.Inc()
+			return AnalysisResult{}, false
+		}
+		a.lateReordered.Add(1)
+		metrics.LateSamplesReordered.Inc()
+	} else {
+		window.latest = data.Timestamp
 	}
+	window.insert(data.Timestamp, data.CPU, data.RPS)
 
 	// Вычисляем rolling average
 	avgCPU := calculateAverage(window.cpuValues)
@@ -146,14 +239,9 @@ func (a *Analyzer) analyze(data MetricData) AnalysisResult {
 	stdDevCPU := calculateStdDev(window.cpuValues, avgCPU)
 	stdDevRPS := calculateStdDev(window.rpsValues, avgRPS)
 
-	// Вычисляем z-score для текущих значений
-	var zScoreCPU, zScoreRPS float64
-	if stdDevCPU > 0 {
-		zScoreCPU = (data.CPU - avgCPU) / stdDevCPU
-	}
-	if stdDevRPS > 0 {
-		zScoreRPS = (data.RPS - avgRPS) / stdDevRPS
-	}
+	// Вычисляем оценку отклонения для текущих значений
+	zScoreCPU := a.score(window.cpuValues, data.CPU, avgCPU, stdDevCPU)
+	zScoreRPS := a.score(window.rpsValues, data.RPS, avgRPS, stdDevRPS)
 
 	// Определяем аномалию
 	isAnomaly := false
@@ -189,7 +277,177 @@ func (a *Analyzer) analyze(data MetricData) AnalysisResult {
 		AnomalyScore:  maxZScore,
 		AnomalyType:   anomalyType,
 		StandardDev:   math.Max(stdDevCPU, stdDevRPS),
+		Tags:          data.Tags,
+	}, true
+}
+
+// insert добавляет значения в окно с сохранением порядка времени
+// и вытесняет самые старые при превышении размера
+func (w *MetricWindow) insert(ts time.Time, cpu, rps float64) {
+	i := sort.Search(len(w.timestamps), func(i int) bool {
+		return w.timestamps[i].After(ts)
+	})
+	w.cpuValues = slices.Insert(w.cpuValues, i, cpu)
+	w.rpsValues = slices.Insert(w.rpsValues, i, rps)
+	w.timestamps = slices.Insert(w.timestamps, i, ts)
+
+	// Ограничиваем размер окна
+	if len(w.cpuValues) > w.maxSize {
+		w.cpuValues = w.cpuValues[1:]
+		w.rpsValues = w.rpsValues[1:]
+		w.timestamps = w.timestamps[1:]
+	}
+}
+
+// WindowSnapshot снимок скользящего окна устройства для передачи между репликами
+type WindowSnapshot struct {
+	DeviceID   string      `json:"device_id"`
+	CPU        []float64   `json:"cpu"`
+	RPS        []float64   `json:"rps"`
+	Timestamps []time.Time `json:"timestamps"`
+}
+
+// DeviceIDs возвращает список устройств, для которых есть окно
+func (a *Analyzer) DeviceIDs() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ids := make([]string, 0, len(a.windows))
+	for id := range a.windows {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ExportWindow возвращает копию окна устройства
+func (a *Analyzer) ExportWindow(deviceID string) (WindowSnapshot, bool) {
+	a.mu.RLock()
+	window, exists := a.windows[deviceID]
+	a.mu.RUnlock()
+	if !exists {
+		return WindowSnapshot{}, false
+	}
+
+	window.mu.RLock()
+	defer window.mu.RUnlock()
+
+	return WindowSnapshot{
+		DeviceID:   deviceID,
+		CPU:        append([]float64(nil), window.cpuValues...),
+		RPS:        append([]float64(nil), window.rpsValues...),
+		Timestamps: append([]time.Time(nil), window.timestamps...),
+	}, true
+}
+
+// DetachWindow удаляет окно устройства для передачи другой реплике и возвращает его копию.
+// Метрики, пришедшие после этого, попадают в новое окно, а не теряются в отданном.
+func (a *Analyzer) DetachWindow(deviceID string) (WindowSnapshot, bool) {
+	a.mu.Lock()
+	window, exists := a.windows[deviceID]
+	delete(a.windows, deviceID)
+	a.mu.Unlock()
+	if !exists {
+		return WindowSnapshot{}, false
+	}
+
+	window.mu.Lock()
+	defer window.mu.Unlock()
+
+	window.detached = true
+	return WindowSnapshot{
+		DeviceID:   deviceID,
+		CPU:        window.cpuValues,
+		RPS:        window.rpsValues,
+		Timestamps: window.timestamps,
+	}, true
+}
+
+// ImportWindow загружает окно, переданное другой репликой.
+// Если окно уже существует (метрики успели прийти до передачи), значения
+// объединяются в порядке времени и обрезаются до размера окна.
+func (a *Analyzer) ImportWindow(snapshot WindowSnapshot) {
+	n := len(snapshot.CPU)
+	if len(snapshot.RPS) < n {
+		n = len(snapshot.RPS)
+	}
+	if len(snapshot.Timestamps) < n {
+		n = len(snapshot.Timestamps)
+	}
+
+	window := a.lockWindow(snapshot.DeviceID)
+	defer window.mu.Unlock()
+
+	type sample struct {
+		ts  time.Time
+		cpu float64
+		rps float64
+	}
+	samples := make([]sample, 0, n+len(window.cpuValues))
+	for i := 0; i < n; i++ {
+		samples = append(samples, sample{snapshot.Timestamps[i], snapshot.CPU[i], snapshot.RPS[i]})
+	}
+	for i := range window.cpuValues {
+		samples = append(samples, sample{window.timestamps[i], window.cpuValues[i], window.rpsValues[i]})
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].ts.Before(samples[j].ts)
+	})
+	if len(samples) > window.maxSize {
+		samples = samples[len(samples)-window.maxSize:]
+	}
+
+	window.cpuValues = window.cpuValues[:0]
+	window.rpsValues = window.rpsValues[:0]
+	window.timestamps = window.timestamps[:0]
+	for _, s := range samples {
+		window.cpuValues = append(window.cpuValues, s.cpu)
+		window.rpsValues = append(window.rpsValues, s.rps)
+		window.timestamps = append(window.timestamps, s.ts)
+	}
+	if n := len(window.timestamps); n > 0 && window.timestamps[n-1].After(window.latest) {
+		window.latest = window.timestamps[n-1]
+	}
+}
+
+// score вычисляет оценку отклонения значения выбранным детектором
+func (a *Analyzer) score(values []float64, value, mean, stdDev float64) float64 {
+	if a.detector == DetectorMAD {
+		return robustZScore(values, value)
+	}
+	if stdDev == 0 {
+		return 0
+	}
+	return (value - mean) / stdDev
+}
+
+// robustZScore вычисляет модифицированный z-score (Iglewicz-Hoaglin):
+// 0.6745 * (x - медиана) / MAD
+func robustZScore(values []float64, value float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	median := calculateMedian(sorted)
+
+	for i, v := range sorted {
+		sorted[i] = math.Abs(v - median)
+	}
+	slices.Sort(sorted)
+	mad := calculateMedian(sorted)
+	if mad == 0 {
+		return 0
+	}
+	return 0.6745 * (value - median) / mad
+}
+
+// calculateMedian вычисляет медиану отсортированных значений
+func calculateMedian(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
 	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
 }
 
 // calculateAverage вычисляет среднее значение
@@ -230,6 +488,10 @@ func (a *Analyzer) GetStats() map[string]interface{} {
 		"devices_tracked": len(a.windows),
 		"window_size":     a.windowSize,
 		"threshold":       a.anomalyThreshold,
+		"detector":        a.detector,
 		"queue_size":      len(a.metricsChan),
+		"subscribers":     a.SubscriberStats(),
+		"late_reordered":  a.lateReordered.Load(),
+		"late_dropped":    a.lateDropped.Load(),
 	}
 }
@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLateSampleInsertion(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// at время метрики через n секунд от base
+	at := func(n int) time.Time { return base.Add(time.Duration(n) * time.Second) }
+
+	tests := []struct {
+		name        string
+		window      int
+		lateness    time.Duration
+		samples     []int
+		wantOK      []bool
+		wantWindow  []int
+		wantReorder int64
+		wantDropped int64
+	}{
+		{
+			name:       "in order",
+			window:     10,
+			lateness:   time.Minute,
+			samples:    []int{1, 2, 3},
+			wantOK:     []bool{true, true, true},
+			wantWindow: []int{1, 2, 3},
+		},
+		{
+			name:        "late within allowed lateness is reordered",
+			window:      10,
+			lateness:    time.Minute,
+			samples:     []int{10, 20, 15, 5},
+			wantOK:      []bool{true, true, true, true},
+			wantWindow:  []int{5, 10, 15, 20},
+			wantReorder: 2,
+		},
+		{
+			name:        "too late is dropped",
+			window:      10,
+			lateness:    10 * time.Second,
+			samples:     []int{100, 95, 89, 90},
+			wantOK:      []bool{true, true, false, true},
+			wantWindow:  []int{90, 95, 100},
+			wantReorder: 2,
+			wantDropped: 1,
+		},
+		{
+			name:        "zero lateness drops any late sample",
+			window:      10,
+			samples:     []int{1, 3, 2, 3},
+			wantOK:      []bool{true, true, false, true},
+			wantWindow:  []int{1, 3, 3},
+			wantDropped: 1,
+		},
+		{
+			name:        "full window evicts the oldest sample",
+			window:      3,
+			lateness:    time.Minute,
+			samples:     []int{10, 20, 30, 25, 5},
+			wantOK:      []bool{true, true, true, true, true},
+			wantWindow:  []int{20, 25, 30},
+			wantReorder: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAnalyzer(tt.window, 2)
+			a.SetAllowedLateness(tt.lateness)
+
+			for i, n := range tt.samples {
+				_, ok := a.Analyze(MetricData{DeviceID: "d1", Timestamp: at(n), CPU: float64(n)})
+				if ok != tt.wantOK[i] {
+					t.Errorf("sample %d (t=%d): ok = %v, want %v", i, n, ok, tt.wantOK[i])
+				}
+			}
+
+			snapshot, _ := a.ExportWindow("d1")
+			want := make([]time.Time, len(tt.wantWindow))
+			wantCPU := make([]float64, len(tt.wantWindow))
+			for i, n := range tt.wantWindow {
+				want[i], wantCPU[i] = at(n), float64(n)
+			}
+			if !slices.Equal(snapshot.Timestamps, want) {
+				t.Errorf("window timestamps = %v, want %v", snapshot.Timestamps, want)
+			}
+			// Значения переставляются вместе с отметками времени
+			if !slices.Equal(snapshot.CPU, wantCPU) {
+				t.Errorf("window cpu = %v, want %v", snapshot.CPU, wantCPU)
+			}
+
+			stats := a.GetStats()
+			if stats["late_reordered"] != tt.wantReorder || stats["late_dropped"] != tt.wantDropped {
+				t.Errorf("late_reordered = %v, late_dropped = %v, want %d and %d",
+					stats["late_reordered"], stats["late_dropped"], tt.wantReorder, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestDetachWindow(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewAnalyzer(10, 2)
+	a.Analyze(MetricData{DeviceID: "d1", Timestamp: base, CPU: 1})
+	a.Analyze(MetricData{DeviceID: "d1", Timestamp: base.Add(time.Second), CPU: 2})
+
+	snapshot, ok := a.DetachWindow("d1")
+	if !ok || !slices.Equal(snapshot.CPU, []float64{1, 2}) {
+		t.Fatalf("DetachWindow() = %+v, %v", snapshot, ok)
+	}
+	if _, ok := a.DetachWindow("d1"); ok {
+		t.Fatal("window must be removed after detach")
+	}
+
+	// Метрика после передачи попадает в новое окно, отданное не меняется
+	a.Analyze(MetricData{DeviceID: "d1", Timestamp: base.Add(2 * time.Second), CPU: 3})
+	if !slices.Equal(snapshot.CPU, []float64{1, 2}) {
+		t.Errorf("detached snapshot changed to %v", snapshot.CPU)
+	}
+	residual, _ := a.ExportWindow("d1")
+	if !slices.Equal(residual.CPU, []float64{3}) {
+		t.Errorf("new window = %v, want [3]", residual.CPU)
+	}
+
+	// Возврат окна объединяет его с новыми метриками
+	a.ImportWindow(snapshot)
+	merged, _ := a.ExportWindow("d1")
+	if !slices.Equal(merged.CPU, []float64{1, 2, 3}) {
+		t.Errorf("merged window = %v, want [1 2 3]", merged.CPU)
+	}
+}
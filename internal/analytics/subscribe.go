@@ -0,0 +1,241 @@
+package analytics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-final/internal/metrics"
+)
+
+// DropPolicy определяет поведение при заполненном буфере подписчика
+type DropPolicy int
+
+const (
+	// DropNewest отбрасывает новый результат
+	DropNewest DropPolicy = iota
+	// DropOldest вытесняет самый старый результат из буфера
+	DropOldest
+	// Block ожидает освобождения буфера не дольше BlockTimeout,
+	// после чего результат отбрасывается
+	Block
+)
+
+// String возвращает название политики
+func (p DropPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop_oldest"
+	case Block:
+		return "block"
+	default:
+		return "drop_newest"
+	}
+}
+
+// ResultFilter отбирает результаты для подписчика; nil означает все результаты
+type ResultFilter func(AnalysisResult) bool
+
+// SubscribeOptions параметры подписки на результаты анализа
+type SubscribeOptions struct {
+	// Name имя подписчика в статистике
+	Name string
+	// BufferSize размер буфера канала подписчика
+	BufferSize int
+	// Policy политика при заполненном буфере
+	Policy DropPolicy
+	// BlockTimeout максимальное ожидание для политики Block
+	BlockTimeout time.Duration
+}
+
+// subscriber получатель результатов анализа
+type subscriber struct {
+	name      string
+	filter    ResultFilter
+	policy    DropPolicy
+	timeout   time.Duration
+	ch        chan AnalysisResult
+	delivered atomic.Int64
+	dropped   atomic.Int64
+	// mu сериализует вытеснение и запись для политики DropOldest
+	mu sync.Mutex
+
+	// done закрывается при отписке и прерывает ожидание политики Block.
+	// closeMu защищает канал от закрытия во время записи.
+	done     chan struct{}
+	closeMu  sync.RWMutex
+	closed   bool
+	shutdown sync.Once
+}
+
+// close закрывает канал подписчика, дождавшись завершения текущих записей
+func (s *subscriber) close() {
+	s.shutdown.Do(func() {
+		close(s.done)
+		s.closeMu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.closeMu.Unlock()
+	})
+}
+
+// drop учитывает отброшенный результат
+func (s *subscriber) drop() {
+	s.dropped.Add(1)
+	metrics.ResultSubscriberDropped.WithLabelValues(s.name).Inc()
+}
+
+// SubscriberStats статистика доставки результатов подписчику
+type SubscriberStats struct {
+	Name      string `json:"name"`
+	Policy    string `json:"policy"`
+	Buffered  int    `json:"buffered"`
+	Capacity  int    `json:"capacity"`
+	Delivered int64  `json:"delivered"`
+	Dropped   int64  `json:"dropped"`
+}
+
+// Subscribe регистрирует независимого получателя результатов анализа.
+// Каждый подписчик получает все результаты, прошедшие фильтр, в свой буфер.
+// Функция отмены закрывает канал; после Stop каналы всех подписчиков закрываются.
+func (a *Analyzer) Subscribe(filter ResultFilter, opts SubscribeOptions) (<-chan AnalysisResult, func()) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1000
+	}
+	if opts.Policy == Block && opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = time.Second
+	}
+
+	sub := &subscriber{
+		name:    opts.Name,
+		filter:  filter,
+		policy:  opts.Policy,
+		timeout: opts.BlockTimeout,
+		ch:      make(chan AnalysisResult, opts.BufferSize),
+		done:    make(chan struct{}),
+	}
+
+	a.subMu.Lock()
+	closed := a.subsClosed
+	if !closed {
+		a.subscribers[sub] = struct{}{}
+	}
+	a.subMu.Unlock()
+	if closed {
+		sub.close()
+	}
+
+	cancel := func() {
+		a.subMu.Lock()
+		delete(a.subscribers, sub)
+		a.subMu.Unlock()
+		sub.close()
+	}
+
+	return sub.ch, cancel
+}
+
+// SubscriberStats возвращает статистику доставки по подписчикам
+func (a *Analyzer) SubscriberStats() []SubscriberStats {
+	a.subMu.RLock()
+	defer a.subMu.RUnlock()
+
+	stats := make([]SubscriberStats, 0, len(a.subscribers))
+	for sub := range a.subscribers {
+		stats = append(stats, SubscriberStats{
+			Name:      sub.name,
+			Policy:    sub.policy.String(),
+			Buffered:  len(sub.ch),
+			Capacity:  cap(sub.ch),
+			Delivered: sub.delivered.Load(),
+			Dropped:   sub.dropped.Load(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// publish рассылает результат всем подходящим подписчикам.
+// Доставка идет вне блокировки списка: ожидание подписчика с политикой Block
+// не должно задерживать подписку и отписку остальных.
+func (a *Analyzer) publish(result AnalysisResult) {
+	a.subMu.RLock()
+	subs := make([]*subscriber, 0, len(a.subscribers))
+	for sub := range a.subscribers {
+		if sub.filter == nil || sub.filter(result) {
+			subs = append(subs, sub)
+		}
+	}
+	a.subMu.RUnlock()
+
+	for _, sub := range subs {
+		if a.deliver(sub, result) {
+			sub.delivered.Add(1)
+		} else {
+			sub.drop()
+		}
+	}
+}
+
+// deliver помещает результат в буфер подписчика согласно его политике.
+// Результат для уже отписавшегося подписчика отбрасывается.
+func (a *Analyzer) deliver(sub *subscriber, result AnalysisResult) bool {
+	sub.closeMu.RLock()
+	defer sub.closeMu.RUnlock()
+	if sub.closed {
+		return false
+	}
+
+	select {
+	case sub.ch <- result:
+		return true
+	default:
+	}
+
+	switch sub.policy {
+	case DropOldest:
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		for {
+			select {
+			case sub.ch <- result:
+				return true
+			default:
+			}
+			select {
+			case <-sub.ch:
+				sub.drop()
+			default:
+			}
+		}
+
+	case Block:
+		timer := time.NewTimer(sub.timeout)
+		defer timer.Stop()
+		select {
+		case sub.ch <- result:
+			return true
+		case <-timer.C:
+		case <-a.stopChan:
+		case <-sub.done:
+		}
+	}
+	return false
+}
+
+// closeSubscribers закрывает каналы всех подписчиков после остановки анализатора
+func (a *Analyzer) closeSubscribers() {
+	a.subMu.Lock()
+	subs := make([]*subscriber, 0, len(a.subscribers))
+	for sub := range a.subscribers {
+		subs = append(subs, sub)
+		delete(a.subscribers, sub)
+	}
+	a.subsClosed = true
+	a.subMu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"highload-final/internal/metrics"
+)
+
+func TestPublishBlockDoesNotHoldSubscribers(t *testing.T) {
+	a := NewAnalyzer(10, 2)
+	defer a.Stop()
+
+	// Подписчик с заполненным буфером и долгим ожиданием
+	_, cancelBlocked := a.Subscribe(nil, SubscribeOptions{Name: "blocked", BufferSize: 1, Policy: Block, BlockTimeout: time.Minute})
+	a.publish(AnalysisResult{DeviceID: "d1"})
+
+	published := make(chan struct{})
+	go func() {
+		a.publish(AnalysisResult{DeviceID: "d1"})
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Пока публикация ждет подписчика, подписка и отписка остальных не блокируются
+	done := make(chan struct{})
+	go func() {
+		_, cancel := a.Subscribe(nil, SubscribeOptions{Name: "other"})
+		cancel()
+		a.SubscriberStats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribe blocked by a publish waiting on a Block subscriber")
+	}
+
+	// Отписка прерывает ожидание без записи в закрытый канал
+	cancelBlocked()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish still waits after the subscriber was canceled")
+	}
+}
+
+func TestDeliverPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      DropPolicy
+		want        []string
+		wantDropped int64
+	}{
+		{"drop newest", DropNewest, []string{"d1", "d2"}, 1},
+		{"drop oldest", DropOldest, []string{"d2", "d3"}, 1},
+		{"block", Block, []string{"d1", "d2"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAnalyzer(10, 2)
+			dropped := metrics.ResultSubscriberDropped.WithLabelValues(tt.name)
+			before := testutil.ToFloat64(dropped)
+			ch, cancel := a.Subscribe(nil, SubscribeOptions{Name: tt.name, BufferSize: 2, Policy: tt.policy, BlockTimeout: 10 * time.Millisecond})
+			defer cancel()
+
+			for _, id := range []string{"d1", "d2", "d3"} {
+				a.publish(AnalysisResult{DeviceID: id})
+			}
+
+			for _, want := range tt.want {
+				if got := (<-ch).DeviceID; got != want {
+					t.Errorf("got %s, want %s", got, want)
+				}
+			}
+			if stats := a.SubscriberStats(); len(stats) != 1 || stats[0].Dropped != tt.wantDropped {
+				t.Errorf("stats = %+v, want %d dropped", stats, tt.wantDropped)
+			}
+			if got := testutil.ToFloat64(dropped) - before; got != float64(tt.wantDropped) {
+				t.Errorf("dropped counter increased by %v, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSubscribeFilterAndStop(t *testing.T) {
+	a := NewAnalyzer(10, 2)
+	ch, _ := a.Subscribe(func(r AnalysisResult) bool { return r.IsAnomaly }, SubscribeOptions{})
+
+	a.publish(AnalysisResult{DeviceID: "normal"})
+	a.publish(AnalysisResult{DeviceID: "anomaly", IsAnomaly: true})
+	a.Stop()
+
+	var got []string
+	for r := range ch {
+		got = append(got, r.DeviceID)
+	}
+	if len(got) != 1 || got[0] != "anomaly" {
+		t.Errorf("got %v, want [anomaly]", got)
+	}
+
+	// Подписка после остановки сразу получает закрытый канал
+	late, _ := a.Subscribe(nil, SubscribeOptions{})
+	if _, ok := <-late; ok {
+		t.Error("channel of a subscriber added after Stop must be closed")
+	}
+}
@@ -0,0 +1,441 @@
+package backfill
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"highload-final/internal/alerting"
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// Source отметка инцидентов, найденных при загрузке истории
+const Source = "backfill"
+
+// Статусы задания
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusCanceled  = "canceled"
+	StatusFailed    = "failed"
+)
+
+var (
+	// ErrTooManyJobs превышено число одновременно выполняемых заданий
+	ErrTooManyJobs = errors.New("too many backfill jobs running")
+	// ErrStopped исполнитель остановлен, задание не принимает метрики
+	ErrStopped = errors.New("backfill runner stopped")
+)
+
+const (
+	// progressInterval через сколько метрик обновляется прогресс задания
+	progressInterval = 1000
+	// chunkSize сколько метрик загрузки передается на анализ за раз
+	chunkSize = 5000
+	// queuedChunks сколько пачек может ждать анализа; остальная загрузка
+	// читается по мере анализа, поэтому в памяти не больше нескольких пачек
+	queuedChunks = 2
+)
+
+// incidentStore хранилище инцидентов, найденных при загрузке истории
+type incidentStore interface {
+	StoreBackfillAnomaly(ctx context.Context, deviceID, anomalyType string, timestamp time.Time, data interface{}) error
+}
+
+// Config параметры анализа истории; совпадают с живым анализатором
+type Config struct {
+	WindowSize       int
+	AnomalyThreshold float64
+	Detector         string
+	Tracker          alerting.TrackerConfig
+	// MaxRunning сколько заданий может выполняться одновременно
+	MaxRunning int
+	// MaxJobs сколько последних заданий хранится для просмотра прогресса
+	MaxJobs int
+	// AllowedLateness допустимое опоздание метрики внутри загрузки.
+	// Пачки упорядочиваются по времени по отдельности, поэтому история должна
+	// быть примерно упорядочена.
+	AllowedLateness time.Duration
+}
+
+// Job задание загрузки истории и его прогресс
+type Job struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+	Rejected  int    `json:"rejected"`
+	// Late метрики, опоздавшие больше AllowedLateness и отброшенные
+	Late       int        `json:"late"`
+	Anomalies  int        `json:"anomalies"`
+	Incidents  int        `json:"incidents"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Runner выполняет задания загрузки истории.
+// Каждое задание анализируется отдельным экземпляром анализатора,
+// поэтому окна живых устройств не затрагиваются.
+type Runner struct {
+	config Config
+	store  incidentStore
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	running int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRunner создает исполнителя заданий
+func NewRunner(config Config, cache *cache.RedisCache) *Runner {
+	if config.MaxRunning <= 0 {
+		config.MaxRunning = 1
+	}
+	if config.MaxJobs <= 0 {
+		config.MaxJobs = 100
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		config: config,
+		store:  cache,
+		jobs:   make(map[string]*Job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Upload загрузка истории в выполняемое задание.
+// Метрики передаются на анализ пачками по мере чтения; методы вызываются из одной goroutine.
+type Upload struct {
+	runner *Runner
+	job    *Job
+	chunk  []models.Metric
+	chunks chan []models.Metric
+	// done закрывается, когда задание перестает принимать пачки
+	done chan struct{}
+
+	accepted int
+	rejected int
+	// sent сколько метрик передано на анализ
+	sent     int
+	from, to time.Time
+	err      error
+	closed   bool
+}
+
+// Start создает задание и возвращает загрузку, в которую передаются
+// провалидированные метрики. Загрузка завершается Finish или Abort.
+func (r *Runner) Start() (*Upload, error) {
+	job := &Job{
+		ID:        newJobID(),
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+	}
+
+	r.mu.Lock()
+	if r.running >= r.config.MaxRunning {
+		r.mu.Unlock()
+		return nil, ErrTooManyJobs
+	}
+	r.running++
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	r.evict()
+	r.mu.Unlock()
+
+	u := &Upload{
+		runner: r,
+		job:    job,
+		chunks: make(chan []models.Metric, queuedChunks),
+		done:   make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run(u)
+
+	return u, nil
+}
+
+// Add передает метрику на анализ. Если очередь пачек заполнена, ждет анализа
+// предыдущих пачек. Возвращает ErrStopped, если исполнитель остановлен.
+func (u *Upload) Add(metric models.Metric) error {
+	if u.accepted == 0 || metric.Timestamp.Before(u.from) {
+		u.from = metric.Timestamp
+	}
+	if metric.Timestamp.After(u.to) {
+		u.to = metric.Timestamp
+	}
+	u.accepted++
+	u.chunk = append(u.chunk, metric)
+	if len(u.chunk) < chunkSize {
+		return nil
+	}
+	return u.flush()
+}
+
+// Reject учитывает запись, отклоненную при разборе
+func (u *Upload) Reject() {
+	u.rejected++
+}
+
+// Accepted возвращает количество принятых метрик
+func (u *Upload) Accepted() int {
+	return u.accepted
+}
+
+// flush передает накопленную пачку заданию
+func (u *Upload) flush() error {
+	u.runner.update(u.job, func(j *Job) {
+		j.Total, j.Rejected = u.accepted+u.rejected, u.rejected
+		j.From, j.To = u.from, u.to
+	})
+	if len(u.chunk) == 0 {
+		return nil
+	}
+
+	select {
+	case u.chunks <- u.chunk:
+		u.sent += len(u.chunk)
+		u.chunk = nil
+		return nil
+	case <-u.done:
+		return ErrStopped
+	}
+}
+
+// Finish передает оставшиеся метрики и закрывает загрузку.
+// Анализ продолжается в фоне; возвращается снимок задания.
+func (u *Upload) Finish() (Job, error) {
+	if u.closed {
+		job, _ := u.runner.Get(u.job.ID)
+		return job, nil
+	}
+	err := u.flush()
+	u.close(nil)
+	job, _ := u.runner.Get(u.job.ID)
+	return job, err
+}
+
+// Abort прерывает загрузку с ошибкой. Если пачки уже переданы на анализ, их результаты
+// остаются, а задание завершается со статусом failed; иначе задание удаляется.
+// Вызов после Finish ничего не делает.
+func (u *Upload) Abort(err error) {
+	if u.closed {
+		return
+	}
+	u.close(err)
+	if u.sent > 0 {
+		return
+	}
+	<-u.done
+	u.runner.remove(u.job.ID)
+}
+
+// close сообщает заданию, что пачек больше не будет
+func (u *Upload) close(err error) {
+	u.closed = true
+	u.err = err
+	u.chunk = nil
+	close(u.chunks)
+}
+
+// Get возвращает снимок задания
+func (r *Runner) Get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List возвращает снимки заданий, начиная с последнего
+func (r *Runner) List() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := make([]Job, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, *r.jobs[r.order[i]])
+	}
+	return jobs
+}
+
+// Stop прерывает выполняемые задания и ждет их завершения
+func (r *Runner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// remove удаляет завершенное задание
+func (r *Runner) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.jobs, id)
+	r.order = slices.DeleteFunc(r.order, func(jobID string) bool { return jobID == id })
+}
+
+// evict удаляет самые старые завершенные задания сверх MaxJobs
+func (r *Runner) evict() {
+	for i := 0; len(r.order) > r.config.MaxJobs && i < len(r.order); {
+		id := r.order[i]
+		if r.jobs[id].Status == StatusRunning {
+			i++
+			continue
+		}
+		delete(r.jobs, id)
+		r.order = append(r.order[:i], r.order[i+1:]...)
+	}
+}
+
+// run анализирует пачки загрузки изолированным анализатором и трекером
+func (r *Runner) run(u *Upload) {
+	defer r.wg.Done()
+	defer close(u.done)
+	job := u.job
+
+	analyzer := analytics.NewAnalyzer(r.config.WindowSize, r.config.AnomalyThreshold)
+	// Детектор проверен при запуске сервиса
+	analyzer.SetDetector(r.config.Detector)
+	analyzer.SetAllowedLateness(r.config.AllowedLateness)
+	tracker := alerting.NewTracker(r.config.Tracker)
+
+	var (
+		processed, late, anomalies, incidents int
+		latest                                time.Time
+	)
+	status := StatusCompleted
+	progress := func(j *Job) {
+		j.Processed, j.Late, j.Anomalies, j.Incidents = processed, late, anomalies, incidents
+	}
+
+chunks:
+	for {
+		var (
+			chunk []models.Metric
+			ok    bool
+		)
+		select {
+		case chunk, ok = <-u.chunks:
+		case <-r.ctx.Done():
+			status = StatusCanceled
+			break chunks
+		}
+		if !ok {
+			break
+		}
+
+		sort.SliceStable(chunk, func(i, j int) bool {
+			return chunk[i].Timestamp.Before(chunk[j].Timestamp)
+		})
+		for _, metric := range chunk {
+			if r.ctx.Err() != nil {
+				status = StatusCanceled
+				break chunks
+			}
+
+			processed++
+			result, ok := analyzer.Analyze(analytics.MetricData{
+				DeviceID:  metric.DeviceID,
+				Timestamp: metric.Timestamp,
+				CPU:       metric.CPU,
+				RPS:       metric.RPS,
+				Tags:      metric.Tags,
+			})
+			if !ok {
+				late++
+				continue
+			}
+			if result.Timestamp.After(latest) {
+				latest = result.Timestamp
+			}
+			if result.IsAnomaly {
+				anomalies++
+			}
+			// История проигрывается во времени метрик
+			incidents += r.storeEvents(tracker.Process(result, result.Timestamp))
+
+			if processed%progressInterval == 0 {
+				r.update(job, progress)
+			}
+		}
+	}
+	if status == StatusCompleted && u.err != nil {
+		status = StatusFailed
+	}
+
+	// Инциденты, открытые в конце истории, закрываются по таймауту как в живом потоке
+	if status == StatusCompleted && processed > late && r.config.Tracker.ResolveTimeout > 0 {
+		incidents += r.storeEvents(tracker.Sweep(latest.Add(r.config.Tracker.ResolveTimeout)))
+	}
+
+	now := time.Now()
+	r.update(job, func(j *Job) {
+		progress(j)
+		j.Status = status
+		j.FinishedAt = &now
+		if status == StatusFailed {
+			j.Error = u.err.Error()
+		}
+	})
+	metrics.BackfillMetrics.WithLabelValues(status).Add(float64(processed))
+
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+
+	log.Printf("Backfill %s %s: %d metrics, %d anomalies, %d incidents\n",
+		job.ID, status, processed, anomalies, incidents)
+}
+
+// storeEvents сохраняет открытые и закрытые инциденты с отметкой источника.
+// Возвращает число новых инцидентов. Оповещения по истории не отправляются.
+func (r *Runner) storeEvents(events []alerting.Event) int {
+	opened := 0
+	for _, event := range events {
+		if event.Kind == alerting.EventRepeated {
+			continue
+		}
+		if event.Kind == alerting.EventOpened {
+			opened++
+		}
+
+		incident := event.Incident
+		incident.Source = Source
+		err := r.store.StoreBackfillAnomaly(r.ctx, incident.DeviceID, incident.AnomalyType, incident.StartsAt, incident)
+		metrics.RedisOperations.WithLabelValues("store_backfill_anomaly", cache.Status(err)).Inc()
+	}
+	return opened
+}
+
+// update изменяет задание под блокировкой
+func (r *Runner) update(job *Job, fn func(j *Job)) {
+	r.mu.Lock()
+	fn(job)
+	r.mu.Unlock()
+}
+
+// newJobID генерирует случайный идентификатор задания
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,240 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-final/internal/alerting"
+	"highload-final/internal/analytics"
+	"highload-final/internal/models"
+)
+
+// fakeIncidentStore сохраняет инциденты в памяти; block задерживает запись
+type fakeIncidentStore struct {
+	mu        sync.Mutex
+	incidents []alerting.Incident
+	block     chan struct{}
+}
+
+func (s *fakeIncidentStore) StoreBackfillAnomaly(_ context.Context, _, _ string, _ time.Time, data interface{}) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incidents = append(s.incidents, data.(alerting.Incident))
+	return nil
+}
+
+func (s *fakeIncidentStore) stored() []alerting.Incident {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]alerting.Incident(nil), s.incidents...)
+}
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// metric метрика устройства d1 через n секунд от base
+func metric(n int, cpu float64) models.Metric {
+	return models.Metric{DeviceID: "d1", Timestamp: base.Add(time.Duration(n) * time.Second), CPU: cpu, RPS: 100}
+}
+
+// steady значение CPU без аномалий
+func steady(n int) float64 {
+	return 10 + float64(n%2)
+}
+
+func newTestRunner(config Config) (*Runner, *fakeIncidentStore) {
+	config.WindowSize = 10
+	config.AnomalyThreshold = 2
+	config.Detector = analytics.DetectorZScore
+	store := &fakeIncidentStore{}
+	r := NewRunner(config, nil)
+	r.store = store
+	return r, store
+}
+
+// waitJob ждет завершения задания
+func waitJob(t *testing.T, r *Runner, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := r.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s is still running", id)
+	return Job{}
+}
+
+func TestUploadStreamsChunks(t *testing.T) {
+	r, store := newTestRunner(Config{Tracker: alerting.TrackerConfig{ResolveTimeout: time.Minute}})
+	defer r.Stop()
+
+	upload, err := r.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 2*chunkSize + 10
+	for n := 0; n < total; n++ {
+		cpu := steady(n)
+		// Всплеск на границе пачек
+		if n == chunkSize {
+			cpu = 100
+		}
+		if err := upload.Add(metric(n, cpu)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload.Reject()
+
+	job, err := upload.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Total != total+1 || job.Rejected != 1 || !job.From.Equal(base) || !job.To.Equal(base.Add(time.Duration(total-1)*time.Second)) {
+		t.Errorf("started job = %+v", job)
+	}
+
+	job = waitJob(t, r, job.ID)
+	if job.Status != StatusCompleted || job.Processed != total || job.Late != 0 {
+		t.Errorf("finished job = %+v", job)
+	}
+	if job.Anomalies == 0 || job.Incidents != 1 {
+		t.Errorf("job found %d anomalies and %d incidents, want one incident", job.Anomalies, job.Incidents)
+	}
+	incidents := store.stored()
+	if len(incidents) == 0 || incidents[0].Source != Source {
+		t.Errorf("stored incidents = %+v", incidents)
+	}
+}
+
+func TestUploadBoundsQueuedChunks(t *testing.T) {
+	r, store := newTestRunner(Config{})
+	store.block = make(chan struct{})
+	defer r.Stop()
+
+	upload, err := r.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Анализ останавливается на записи первого инцидента
+	added := make(chan int, 1)
+	go func() {
+		n := 0
+		for ; n < (queuedChunks+3)*chunkSize; n++ {
+			cpu := steady(n)
+			if n == 20 {
+				cpu = 100
+			}
+			if upload.Add(metric(n, cpu)) != nil {
+				break
+			}
+		}
+		added <- n
+	}()
+
+	select {
+	case n := <-added:
+		t.Fatalf("added %d metrics while analysis was blocked", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(store.block)
+	if n := <-added; n != (queuedChunks+3)*chunkSize {
+		t.Fatalf("added %d metrics after analysis resumed", n)
+	}
+	job, _ := upload.Finish()
+	if job = waitJob(t, r, job.ID); job.Status != StatusCompleted || job.Processed != (queuedChunks+3)*chunkSize {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestUploadLateMetrics(t *testing.T) {
+	r, _ := newTestRunner(Config{AllowedLateness: 10 * time.Second})
+	defer r.Stop()
+
+	upload, _ := r.Start()
+	for n := 0; n < chunkSize; n++ {
+		upload.Add(metric(1000+n, steady(n)))
+	}
+	// Следующая пачка начинается раньше предыдущей больше чем на AllowedLateness
+	upload.Add(metric(0, 10))
+	upload.Add(metric(1000+chunkSize-5, 10))
+
+	job, _ := upload.Finish()
+	if job = waitJob(t, r, job.ID); job.Processed != chunkSize+2 || job.Late != 1 {
+		t.Errorf("job = %+v, want one late metric", job)
+	}
+}
+
+func TestUploadAbort(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted int
+	}{
+		{"nothing analyzed is removed", 10},
+		{"partial upload fails", chunkSize + 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRunner(Config{})
+			defer r.Stop()
+
+			upload, _ := r.Start()
+			for n := 0; n < tt.accepted; n++ {
+				upload.Add(metric(n, steady(n)))
+			}
+			upload.Abort(errors.New("invalid JSON"))
+			id := upload.job.ID
+
+			if tt.accepted < chunkSize {
+				if _, ok := r.Get(id); ok || len(r.List()) != 0 {
+					t.Errorf("empty aborted job is still listed: %+v", r.List())
+				}
+			} else if job := waitJob(t, r, id); job.Status != StatusFailed || job.Error != "invalid JSON" {
+				t.Errorf("job = %+v, want failed", job)
+			}
+
+			// Слот задания освобожден
+			next, err := r.Start()
+			if err != nil {
+				t.Fatalf("Start() after abort: %v", err)
+			}
+			next.Abort(errors.New("done"))
+		})
+	}
+}
+
+func TestRunnerLimits(t *testing.T) {
+	r, _ := newTestRunner(Config{MaxRunning: 1})
+
+	upload, err := r.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Start(); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("second Start() error = %v, want ErrTooManyJobs", err)
+	}
+
+	r.Stop()
+	var addErr error
+	for n := 0; n <= (queuedChunks+1)*chunkSize && addErr == nil; n++ {
+		addErr = upload.Add(metric(n, steady(n)))
+	}
+	if !errors.Is(addErr, ErrStopped) {
+		t.Errorf("Add() after Stop error = %v, want ErrStopped", addErr)
+	}
+	if job, _ := r.Get(upload.job.ID); job.Status != StatusCanceled {
+		t.Errorf("job status = %s, want canceled", job.Status)
+	}
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen операция отклонена, так как circuit breaker разомкнут
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker is open", ErrUnavailable)
+
+// BreakerState состояние circuit breaker
+type BreakerState int
+
+// Состояния circuit breaker
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+// String возвращает название состояния
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig настройки circuit breaker
+type BreakerConfig struct {
+	// WindowSize количество последних вызовов, по которым считается статистика
+	WindowSize int
+	// MinRequests минимальное число вызовов в окне для принятия решения
+	MinRequests int
+	// ErrorRateThreshold доля ошибок, при которой breaker размыкается
+	ErrorRateThreshold float64
+	// SlowCallDuration вызов дольше этого времени считается медленным
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold доля медленных вызовов, при которой breaker размыкается
+	SlowCallRateThreshold float64
+	// OpenTimeout время в разомкнутом состоянии до пробных вызовов
+	OpenTimeout time.Duration
+	// HalfOpenMaxCalls число успешных пробных вызовов для замыкания
+	HalfOpenMaxCalls int
+}
+
+// callOutcome результат одного вызова
+type callOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// CircuitBreaker circuit breaker со скользящим окном по количеству вызовов
+type CircuitBreaker struct {
+	config BreakerConfig
+
+	mu                sync.Mutex
+	state             BreakerState
+	outcomes          []callOutcome
+	next              int
+	count             int
+	openedAt          time.Time
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+	// generation меняется при каждой смене состояния, чтобы отличать
+	// вызовы, разрешенные до перехода в half-open
+	generation uint64
+
+	onStateChange func(from, to BreakerState)
+}
+
+// NewCircuitBreaker создает circuit breaker
+func NewCircuitBreaker(config BreakerConfig, onStateChange func(from, to BreakerState)) *CircuitBreaker {
+	if config.WindowSize <= 0 {
+		config.WindowSize = 100
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.ErrorRateThreshold <= 0 {
+		config.ErrorRateThreshold = 0.5
+	}
+	if config.SlowCallDuration <= 0 {
+		config.SlowCallDuration = 200 * time.Millisecond
+	}
+	if config.SlowCallRateThreshold <= 0 {
+		config.SlowCallRateThreshold = 0.5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 10 * time.Second
+	}
+	if config.HalfOpenMaxCalls <= 0 {
+		config.HalfOpenMaxCalls = 3
+	}
+
+	return &CircuitBreaker{
+		config:        config,
+		outcomes:      make([]callOutcome, config.WindowSize),
+		onStateChange: onStateChange,
+	}
+}
+
+// Allow проверяет, можно ли выполнить вызов.
+// Возвращает поколение состояния, которое передается в Record.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return 0, ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.halfOpenInFlight >= b.config.HalfOpenMaxCalls {
+			return 0, ErrCircuitOpen
+		}
+		b.halfOpenInFlight++
+	}
+	return b.generation, nil
+}
+
+// Record учитывает результат вызова, разрешенного Allow в поколении generation
+func (b *CircuitBreaker) Record(generation uint64, failed bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slow := latency > b.config.SlowCallDuration
+
+	switch b.state {
+	case StateHalfOpen:
+		// Вызовы, разрешенные до размыкания, не являются пробными
+		if generation != b.generation {
+			return
+		}
+		b.halfOpenInFlight--
+		if failed || slow {
+			b.trip()
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.config.HalfOpenMaxCalls {
+			b.setState(StateClosed)
+		}
+	case StateClosed:
+		b.outcomes[b.next] = callOutcome{failed: failed, slow: slow}
+		b.next = (b.next + 1) % len(b.outcomes)
+		if b.count < len(b.outcomes) {
+			b.count++
+		}
+
+		if b.count < b.config.MinRequests {
+			return
+		}
+
+		var failures, slowCalls int
+		for i := 0; i < b.count; i++ {
+			if b.outcomes[i].failed {
+				failures++
+			}
+			if b.outcomes[i].slow {
+				slowCalls++
+			}
+		}
+
+		total := float64(b.count)
+		if float64(failures)/total >= b.config.ErrorRateThreshold ||
+			float64(slowCalls)/total >= b.config.SlowCallRateThreshold {
+			b.trip()
+		}
+	}
+}
+
+// State возвращает текущее состояние
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// trip размыкает breaker
+func (b *CircuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.setState(StateOpen)
+}
+
+// setState меняет состояние и сбрасывает статистику
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+
+	from := b.state
+	b.state = state
+	b.generation++
+	b.next = 0
+	b.count = 0
+	b.halfOpenInFlight = 0
+	b.halfOpenSuccesses = 0
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
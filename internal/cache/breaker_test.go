@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testBreakerConfig конфигурация, размыкающаяся после двух ошибок из двух вызовов
+func testBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		WindowSize:         4,
+		MinRequests:        2,
+		ErrorRateThreshold: 0.5,
+		SlowCallDuration:   time.Second,
+		OpenTimeout:        time.Millisecond,
+		HalfOpenMaxCalls:   2,
+	}
+}
+
+// call выполняет вызов через breaker с заданным исходом
+func call(t *testing.T, b *CircuitBreaker, failed bool) {
+	t.Helper()
+	generation, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() in state %s: %v", b.State(), err)
+	}
+	b.Record(generation, failed, 0)
+}
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	b := NewCircuitBreaker(testBreakerConfig(), nil)
+
+	call(t, b, true)
+	call(t, b, true)
+	if b.State() != StateOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("Allow() = %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	call(t, b, false)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", b.State())
+	}
+	call(t, b, false)
+	if b.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", b.State())
+	}
+}
+
+func TestBreakerHalfOpenIgnoresCallsAdmittedBeforeTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		staleFail bool
+	}{
+		{"stale success", false},
+		{"stale failure", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(testBreakerConfig(), nil)
+
+			// Долгие вызовы разрешены, пока breaker еще замкнут
+			var stale []uint64
+			for i := 0; i < 3; i++ {
+				generation, err := b.Allow()
+				if err != nil {
+					t.Fatal(err)
+				}
+				stale = append(stale, generation)
+			}
+
+			call(t, b, true)
+			call(t, b, true)
+			time.Sleep(2 * time.Millisecond)
+
+			// Пробный вызов в half-open
+			probe, err := b.Allow()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Завершение старых вызовов не влияет на пробные и не уводит счетчик в минус
+			for _, generation := range stale {
+				b.Record(generation, tt.staleFail, 0)
+			}
+			if b.State() != StateHalfOpen {
+				t.Fatalf("state = %s after stale calls, want half-open", b.State())
+			}
+			b.mu.Lock()
+			inFlight := b.halfOpenInFlight
+			b.mu.Unlock()
+			if inFlight != 1 {
+				t.Fatalf("halfOpenInFlight = %d, want 1", inFlight)
+			}
+
+			// Лимит пробных вызовов соблюдается
+			if _, err := b.Allow(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Allow(); err != ErrCircuitOpen {
+				t.Fatalf("Allow() beyond HalfOpenMaxCalls = %v, want ErrCircuitOpen", err)
+			}
+			b.Record(probe, false, 0)
+		})
+	}
+}
+
+func TestNewClientMaxRetries(t *testing.T) {
+	tests := []struct {
+		maxRetries int
+		want       int
+	}{
+		{0, 0},
+		{-1, 0},
+		{2, 2},
+	}
+	for _, tt := range tests {
+		client, err := newClient(Options{Mode: ModeSingle, Addrs: []string{"127.0.0.1:1"}, MaxRetries: tt.maxRetries})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.(*redis.Client).Options().MaxRetries; got != tt.want {
+			t.Errorf("MaxRetries %d: client retries = %d, want %d", tt.maxRetries, got, tt.want)
+		}
+		client.Close()
+	}
+}
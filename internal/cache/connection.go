@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"highload-final/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrSpooled запись отложена в локальный буфер до восстановления соединения
+	ErrSpooled = errors.New("redis unavailable, write spooled")
+	// ErrUnavailable Redis недоступен, операция не выполнена
+	ErrUnavailable = errors.New("redis unavailable")
+)
+
+// ConnectionState состояние подключения к Redis
+type ConnectionState struct {
+	Connected    bool  `json:"connected"`
+	Spooled      int   `json:"spooled"`
+	SpoolDropped int64 `json:"spool_dropped"`
+}
+
+// Status возвращает статус операции для метрики redis_operations_total
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrSpooled):
+		return "spooled"
+	default:
+		return "error"
+	}
+}
+
+// Connected проверяет, есть ли соединение с Redis
+func (r *RedisCache) Connected() bool {
+	return r.connected.Load()
+}
+
+// State возвращает состояние подключения и локального буфера
+func (r *RedisCache) State() ConnectionState {
+	return ConnectionState{
+		Connected:    r.connected.Load(),
+		Spooled:      r.spool.len(),
+		SpoolDropped: r.spool.droppedCount(),
+	}
+}
+
+// write выполняет запись или откладывает ее в буфер, если Redis недоступен
+func (r *RedisCache) write(ctx context.Context, entry spoolEntry) error {
+	if !r.connected.Load() && r.enqueue(entry) {
+		return ErrSpooled
+	}
+
+	if err := r.exec(ctx, entry); err != nil {
+		// Ошибки сервера (WRONGTYPE и т.п.) повторять бессмысленно,
+		// а отмененную вызывающим запись откладывать не нужно
+		var redisErr redis.Error
+		if errors.As(err, &redisErr) || ctx.Err() != nil {
+			return err
+		}
+
+		r.markDisconnected(err)
+		if r.enqueue(entry) {
+			return ErrSpooled
+		}
+		return err
+	}
+	return nil
+}
+
+// enqueue кладет запись в буфер, если соединение все еще отсутствует
+func (r *RedisCache) enqueue(entry spoolEntry) bool {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	if r.connected.Load() {
+		return false
+	}
+
+	if !r.spool.push(entry) {
+		metrics.RedisSpoolDropped.Inc()
+	}
+	metrics.RedisSpoolSize.Set(float64(r.spool.len()))
+	return true
+}
+
+// markDisconnected переводит кэш в деградированный режим и запускает переподключение
+func (r *RedisCache) markDisconnected(err error) {
+	r.stateMu.Lock()
+	wasConnected := r.connected.Swap(false)
+	r.stateMu.Unlock()
+
+	if wasConnected {
+		log.Printf("Redis connection lost: %v, switching to degraded mode\n", err)
+		metrics.RedisConnected.Set(0)
+	}
+
+	select {
+	case r.reconnectCh <- struct{}{}:
+	default:
+	}
+}
+
+// reconnectLoop переподключается к Redis с экспоненциальной задержкой
+func (r *RedisCache) reconnectLoop() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-r.reconnectCh:
+		}
+
+		backoff := r.minBackoff
+		for !r.tryConnect() {
+			select {
+			case <-r.stopCh:
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		}
+	}
+}
+
+// tryConnect проверяет соединение и воспроизводит отложенные записи.
+// Проверка идет через circuit breaker: пока он разомкнут, попытки не нагружают Redis.
+func (r *RedisCache) tryConnect() bool {
+	if err := r.Ping(context.Background()); err != nil {
+		log.Printf("Redis reconnect failed: %v\n", err)
+		return false
+	}
+
+	// Основную часть буфера воспроизводим без блокировки, чтобы не задерживать запись
+	if !r.replaySpool() {
+		return false
+	}
+
+	// Остаток, накопившийся во время воспроизведения, дописываем под блокировкой
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	if !r.replaySpool() {
+		return false
+	}
+	r.connected.Store(true)
+	metrics.RedisConnected.Set(1)
+	log.Println("Connected to Redis")
+	return true
+}
+
+// replaySpool записывает отложенные записи в Redis в порядке поступления
+func (r *RedisCache) replaySpool() bool {
+	replayed := 0
+	for {
+		entry, ok := r.spool.pop()
+		if !ok {
+			break
+		}
+
+		if err := r.exec(context.Background(), entry); err != nil {
+			var redisErr redis.Error
+			if errors.As(err, &redisErr) {
+				log.Printf("Redis spool replay: dropping %s entry for %s: %v\n", entry.kind, entry.deviceID, err)
+				continue
+			}
+
+			r.spool.unpop(entry)
+			metrics.RedisSpoolSize.Set(float64(r.spool.len()))
+			log.Printf("Redis spool replay interrupted after %d entries: %v\n", replayed, err)
+			return false
+		}
+		replayed++
+	}
+
+	metrics.RedisSpoolSize.Set(float64(r.spool.len()))
+	if replayed > 0 {
+		log.Printf("Redis spool replayed: %d entries\n", replayed)
+	}
+	return true
+}
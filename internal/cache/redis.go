@@ -3,117 +3,415 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"highload-final/internal/metrics"
+
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	clusterMembersKey    = "cluster:members"
+	clusterHeartbeatsKey = "cluster:heartbeats"
+	silencesKey          = "silences"
+	anomalyIndexKey      = "anomaly_index"
+	anomalyStatusKey     = "anomaly_status"
+)
+
+// ErrNotFound ключ отсутствует в Redis
+var ErrNotFound = errors.New("not found")
+
+// Режимы подключения к Redis
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+// Options параметры подключения к Redis
+type Options struct {
+	// Mode топология: single, sentinel или cluster
+	Mode string
+	// Addrs адрес сервера, список sentinel-узлов или seed-узлов кластера
+	Addrs    []string
+	Password string
+	// DB номер базы (не поддерживается в режиме cluster)
+	DB int
+	// MasterName имя мастера для режима sentinel
+	MasterName       string
+	SentinelPassword string
+	TTL              time.Duration
+
+	// SpoolSize емкость локального буфера записей на время недоступности Redis
+	SpoolSize int
+	// ReconnectMinBackoff и ReconnectMaxBackoff границы задержки между попытками переподключения
+	ReconnectMinBackoff time.Duration
+	ReconnectMaxBackoff time.Duration
+
+	// MaxRetries количество повторов go-redis внутри одной операции, 0 - без повторов
+	MaxRetries int
+	// OperationTimeout ограничение времени одной операции по умолчанию
+	OperationTimeout time.Duration
+	// OperationTimeouts таймауты отдельных операций (store_metric, get_anomalies, ...)
+	OperationTimeouts map[string]time.Duration
+	// Breaker настройки circuit breaker вокруг операций
+	Breaker BreakerConfig
+}
+
 // RedisCache обертка для Redis клиента
 type RedisCache struct {
-	client *redis.Client
-	ctx    context.Context
-	ttl    time.Duration
+	client     redis.UniversalClient
+	ttl        time.Duration
+	opTimeout  time.Duration
+	opTimeouts map[string]time.Duration
+	breaker    *CircuitBreaker
+
+	connected   atomic.Bool
+	stateMu     sync.Mutex
+	spool       *spool
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	reconnectCh chan struct{}
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
 }
 
-// NewRedisCache создает новый Redis кэш
-func NewRedisCache(addr, password string, db int, ttl time.Duration) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         addr,
-		Password:     password,
-		DB:           db,
-		PoolSize:     100,
-		MinIdleConns: 10,
-		MaxRetries:   3,
-	})
+// NewRedisCache создает новый Redis кэш.
+// Если Redis недоступен при старте, кэш работает в деградированном режиме:
+// записи копятся в локальном буфере, а подключение повторяется в фоне.
+// Ошибка возвращается только при некорректной конфигурации.
+func NewRedisCache(opts Options) (*RedisCache, error) {
+	client, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx := context.Background()
+	if opts.SpoolSize <= 0 {
+		opts.SpoolSize = 10000
+	}
+	if opts.ReconnectMinBackoff <= 0 {
+		opts.ReconnectMinBackoff = time.Second
+	}
+	if opts.ReconnectMaxBackoff < opts.ReconnectMinBackoff {
+		opts.ReconnectMaxBackoff = 30 * time.Second
+	}
+	if opts.OperationTimeout <= 0 {
+		opts.OperationTimeout = time.Second
+	}
+
+	r := &RedisCache{
+		client:      client,
+		ttl:         opts.TTL,
+		opTimeout:   opts.OperationTimeout,
+		opTimeouts:  opts.OperationTimeouts,
+		breaker:     NewCircuitBreaker(opts.Breaker, onBreakerStateChange),
+		spool:       newSpool(opts.SpoolSize),
+		minBackoff:  opts.ReconnectMinBackoff,
+		maxBackoff:  opts.ReconnectMaxBackoff,
+		reconnectCh: make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go r.reconnectLoop()
 
 	// Проверяем подключение
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if err := r.Ping(context.Background()); err != nil {
+		log.Printf("Redis is unavailable at startup: %v, starting in degraded mode\n", err)
+		r.markDisconnected(err)
+	} else {
+		r.connected.Store(true)
+		metrics.RedisConnected.Set(1)
 	}
 
-	return &RedisCache{
-		client: client,
-		ctx:    ctx,
-		ttl:    ttl,
-	}, nil
+	return r, nil
 }
 
-// StoreMetric сохраняет метрику в Redis
-func (r *RedisCache) StoreMetric(deviceID string, timestamp time.Time, data interface{}) error {
-	key := fmt.Sprintf("metric:%s:%d", deviceID, timestamp.Unix())
+// newClient создает клиент для выбранной топологии
+func newClient(opts Options) (redis.UniversalClient, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, fmt.Errorf("no Redis addresses configured")
+	}
+	// В go-redis 0 означает повторы по умолчанию (3), а -1 отключает их
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = -1
+	}
+
+	switch opts.Mode {
+	case "", ModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:         opts.Addrs[0],
+			Password:     opts.Password,
+			DB:           opts.DB,
+			PoolSize:     100,
+			MinIdleConns: 10,
+			MaxRetries:   opts.MaxRetries,
+		}), nil
+	case ModeSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("sentinel mode requires a master name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.MasterName,
+			SentinelAddrs:    opts.Addrs,
+			SentinelPassword: opts.SentinelPassword,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			PoolSize:         100,
+			MinIdleConns:     10,
+			MaxRetries:       opts.MaxRetries,
+		}), nil
+	case ModeCluster:
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("cluster mode supports only DB 0")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        opts.Addrs,
+			Password:     opts.Password,
+			PoolSize:     100,
+			MinIdleConns: 10,
+			MaxRetries:   opts.MaxRetries,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", opts.Mode)
+	}
+}
+
+// onBreakerStateChange обновляет метрики при смене состояния circuit breaker
+func onBreakerStateChange(from, to BreakerState) {
+	log.Printf("Redis circuit breaker: %s -> %s\n", from, to)
+	metrics.RedisBreakerState.Set(float64(to))
+	metrics.RedisBreakerTransitions.WithLabelValues(to.String()).Inc()
+}
+
+// do выполняет операцию через circuit breaker.
+// Время операции ограничено таймаутом для op и дедлайном родительского контекста.
+func (r *RedisCache) do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	generation, err := r.breaker.Allow()
+	if err != nil {
+		metrics.RedisBreakerRejected.WithLabelValues(op).Inc()
+		return err
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, r.timeout(op))
+	defer cancel()
+
+	start := time.Now()
+	err = fn(opCtx)
+	// Отмена со стороны вызывающего (клиент закрыл соединение) не говорит о проблеме с Redis
+	r.breaker.Record(generation, isFailure(err) && ctx.Err() == nil, time.Since(start))
+	return err
+}
+
+// timeout возвращает таймаут операции
+func (r *RedisCache) timeout(op string) time.Duration {
+	if t, ok := r.opTimeouts[op]; ok {
+		return t
+	}
+	return r.opTimeout
+}
+
+// isFailure определяет, говорит ли ошибка о проблеме с Redis.
+// Отсутствие ключа и ошибки команд (WRONGTYPE и т.п.) не считаются отказом.
+func isFailure(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// deviceTag возвращает hash tag устройства, чтобы все ключи устройства
+// в Redis Cluster попадали в один слот
+func deviceTag(deviceID string) string {
+	return "{" + deviceID + "}"
+}
 
+// StoreMetric сохраняет метрику в Redis
+func (r *RedisCache) StoreMetric(ctx context.Context, deviceID string, timestamp time.Time, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metric: %w", err)
 	}
 
-	return r.client.Set(r.ctx, key, jsonData, r.ttl).Err()
+	return r.write(ctx, spoolEntry{kind: entryMetric, deviceID: deviceID, timestamp: timestamp, data: jsonData})
 }
 
 // StoreAnalysis сохраняет результат анализа
-func (r *RedisCache) StoreAnalysis(deviceID string, timestamp time.Time, data interface{}) error {
-	key := fmt.Sprintf("analysis:%s:%d", deviceID, timestamp.Unix())
-
+func (r *RedisCache) StoreAnalysis(ctx context.Context, deviceID string, timestamp time.Time, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal analysis: %w", err)
 	}
 
-	return r.client.Set(r.ctx, key, jsonData, r.ttl).Err()
+	return r.write(ctx, spoolEntry{kind: entryAnalysis, deviceID: deviceID, timestamp: timestamp, data: jsonData})
 }
 
-// StoreAnomaly сохраняет аномалию (с более длительным TTL)
-func (r *RedisCache) StoreAnomaly(deviceID string, timestamp time.Time, data interface{}) error {
-	key := fmt.Sprintf("anomaly:%s:%d", deviceID, timestamp.Unix())
+// StoreAnomaly сохраняет аномалию (с более длительным TTL).
+// Ключ включает тип, чтобы инциденты разных типов, открытые в одну секунду, не совпадали.
+func (r *RedisCache) StoreAnomaly(ctx context.Context, deviceID, anomalyType string, timestamp time.Time, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly: %w", err)
+	}
 
+	return r.write(ctx, spoolEntry{kind: entryAnomaly, deviceID: deviceID, anomalyType: anomalyType, timestamp: timestamp, data: jsonData})
+}
+
+// StoreBackfillAnomaly сохраняет аномалию, найденную при загрузке истории.
+// Ключи не пересекаются с ключами живых аномалий того же устройства и времени.
+func (r *RedisCache) StoreBackfillAnomaly(ctx context.Context, deviceID, anomalyType string, timestamp time.Time, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal anomaly: %w", err)
 	}
 
+	return r.write(ctx, spoolEntry{kind: entryBackfillAnomaly, deviceID: deviceID, anomalyType: anomalyType, timestamp: timestamp, data: jsonData})
+}
+
+// exec выполняет запись в Redis
+func (r *RedisCache) exec(ctx context.Context, entry spoolEntry) error {
+	return r.do(ctx, "store_"+entry.kind, func(ctx context.Context) error {
+		return r.execEntry(ctx, entry)
+	})
+}
+
+// execEntry выполняет команды записи
+func (r *RedisCache) execEntry(ctx context.Context, entry spoolEntry) error {
+	switch entry.kind {
+	case entryMetric:
+		key := fmt.Sprintf("metric:%s:%d", entry.deviceID, entry.timestamp.Unix())
+		return r.client.Set(ctx, key, entry.data, r.ttl).Err()
+	case entryAnalysis:
+		key := fmt.Sprintf("analysis:%s:%d", entry.deviceID, entry.timestamp.Unix())
+		return r.client.Set(ctx, key, entry.data, r.ttl).Err()
+	case entryAnomaly:
+		key := fmt.Sprintf("anomaly:%s:%d:%s", deviceTag(entry.deviceID), entry.timestamp.Unix(), entry.anomalyType)
+		listKey := fmt.Sprintf("anomaly_list:%s", deviceTag(entry.deviceID))
+		return r.storeAnomaly(ctx, key, listKey, entry)
+	case entryBackfillAnomaly:
+		// Отдельное пространство ключей и отдельный список, чтобы история
+		// не перезаписывала живые инциденты и не попадала в последние аномалии устройства
+		key := fmt.Sprintf("anomaly:backfill:%s:%d:%s", deviceTag(entry.deviceID), entry.timestamp.Unix(), entry.anomalyType)
+		listKey := fmt.Sprintf("anomaly_list:backfill:%s", deviceTag(entry.deviceID))
+		return r.storeAnomaly(ctx, key, listKey, entry)
+	default:
+		return fmt.Errorf("unknown entry kind %q", entry.kind)
+	}
+}
+
+// storeAnomaly сохраняет аномалию под ключом key и добавляет ее в список устройства listKey
+// и общий индекс
+func (r *RedisCache) storeAnomaly(ctx context.Context, key, listKey string, entry spoolEntry) error {
 	// Аномалии хранятся дольше
 	anomalyTTL := r.ttl * 24 // 24 часа если базовый TTL = 1 час
 
-	// Добавляем в sorted set для легкого извлечения
-	score := float64(timestamp.Unix())
-	listKey := fmt.Sprintf("anomaly_list:%s", deviceID)
-
+	// Список устройства - sorted set для легкого извлечения
 	pipe := r.client.Pipeline()
-	pipe.Set(r.ctx, key, jsonData, anomalyTTL)
-	pipe.ZAdd(r.ctx, listKey, redis.Z{Score: score, Member: key})
-	pipe.Expire(r.ctx, listKey, anomalyTTL)
-
-	_, err = pipe.Exec(r.ctx)
+	pipe.Set(ctx, key, entry.data, anomalyTTL)
+	pipe.ZAdd(ctx, listKey, redis.Z{Score: float64(entry.timestamp.Unix()), Member: key})
+	pipe.Expire(ctx, listKey, anomalyTTL)
+
+	// Общий индекс аномалий всех устройств (для обхода без SCAN).
+	// Упорядочен по времени записи, как и TTL ключа: иначе аномалии,
+	// загруженные из истории, удалялись бы из индекса сразу после записи.
+	now := time.Now()
+	pipe.ZAdd(ctx, anomalyIndexKey, redis.Z{Score: float64(now.Unix()), Member: key})
+	pipe.ZRemRangeByScore(ctx, anomalyIndexKey, "-inf",
+		fmt.Sprintf("(%d", now.Add(-anomalyTTL).Unix()))
+
+	_, err := pipe.Exec(ctx)
 	return err
 }
 
 // GetRecentMetrics получает последние N метрик для устройства
-func (r *RedisCache) GetRecentMetrics(deviceID string, limit int) ([]string, error) {
-	pattern := fmt.Sprintf("metric:%s:*", deviceID)
+func (r *RedisCache) GetRecentMetrics(ctx context.Context, deviceID string, limit int) ([]string, error) {
+	if !r.connected.Load() {
+		return nil, ErrUnavailable
+	}
 
-	var keys []string
-	iter := r.client.Scan(r.ctx, 0, pattern, int64(limit)).Iterator()
+	pattern := fmt.Sprintf("metric:%s:*", deviceID)
 
-	for iter.Next(r.ctx) {
-		keys = append(keys, iter.Val())
+	// В кластере SCAN работает в пределах одного узла, обходим все мастера
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		var (
+			mu   sync.Mutex
+			keys []string
+		)
+		err := r.do(ctx, "scan_metrics", func(ctx context.Context) error {
+			return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+				nodeKeys, err := scanKeys(ctx, node, pattern, limit)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				keys = append(keys, nodeKeys...)
+				mu.Unlock()
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan metrics: %w", err)
+		}
+		return keys, nil
 	}
 
-	if err := iter.Err(); err != nil {
+	var keys []string
+	err := r.do(ctx, "scan_metrics", func(ctx context.Context) error {
+		var err error
+		keys, err = scanKeys(ctx, r.client, pattern, limit)
+		return err
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to scan metrics: %w", err)
 	}
-
 	return keys, nil
 }
 
-// GetRecentAnomalies получает последние аномалии для устройства
-func (r *RedisCache) GetRecentAnomalies(deviceID string, limit int) ([]string, error) {
-	listKey := fmt.Sprintf("anomaly_list:%s", deviceID)
+// scanKeys обходит ключи по шаблону на одном узле
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string, limit int) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, int64(limit)).Iterator()
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+// GetRecentAnomalies получает последние аномалии для устройства.
+// Аномалии, записанные до перехода ключей на hash tag, читаются из старого
+// списка, пока он не истечет вместе с TTL аномалий.
+func (r *RedisCache) GetRecentAnomalies(ctx context.Context, deviceID string, limit int) ([]string, error) {
+	if !r.connected.Load() {
+		return nil, ErrUnavailable
+	}
+
+	listKey := fmt.Sprintf("anomaly_list:%s", deviceTag(deviceID))
+	legacyListKey := fmt.Sprintf("anomaly_list:%s", deviceID)
 
 	// Получаем последние аномалии из sorted set
-	results, err := r.client.ZRevRange(r.ctx, listKey, 0, int64(limit-1)).Result()
+	var results []string
+	err := r.do(ctx, "get_anomalies", func(ctx context.Context) error {
+		pipe := r.client.Pipeline()
+		current := pipe.ZRevRangeWithScores(ctx, listKey, 0, int64(limit-1))
+		legacy := pipe.ZRevRangeWithScores(ctx, legacyListKey, 0, int64(limit-1))
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+		results = mergeAnomalyLists(current.Val(), legacy.Val(), limit)
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get anomalies: %w", err)
 	}
@@ -121,40 +419,321 @@ func (r *RedisCache) GetRecentAnomalies(deviceID string, limit int) ([]string, e
 	return results, nil
 }
 
+// mergeAnomalyLists объединяет списки аномалий по убыванию времени и
+// оставляет не больше limit ключей (limit <= 0 - без ограничения)
+func mergeAnomalyLists(current, legacy []redis.Z, limit int) []string {
+	merged := append(append([]redis.Z(nil), current...), legacy...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+
+	keys := make([]string, len(merged))
+	for i, z := range merged {
+		keys[i], _ = z.Member.(string)
+	}
+	return keys
+}
+
 // IncrementCounter увеличивает счетчик
-func (r *RedisCache) IncrementCounter(key string) error {
-	return r.client.Incr(r.ctx, key).Err()
+func (r *RedisCache) IncrementCounter(ctx context.Context, key string) error {
+	return r.do(ctx, "incr", func(ctx context.Context) error {
+		return r.client.Incr(ctx, key).Err()
+	})
 }
 
 // GetCounter получает значение счетчика
-func (r *RedisCache) GetCounter(key string) (int64, error) {
-	val, err := r.client.Get(r.ctx, key).Int64()
+func (r *RedisCache) GetCounter(ctx context.Context, key string) (int64, error) {
+	var val int64
+	err := r.do(ctx, "get_counter", func(ctx context.Context) error {
+		var err error
+		val, err = r.client.Get(ctx, key).Int64()
+		return err
+	})
 	if err == redis.Nil {
 		return 0, nil
 	}
 	return val, err
 }
 
-// Close закрывает соединение с Redis
+// MarkMessage отмечает сообщение устройства как принятое на ttl.
+// Возвращает false, если сообщение уже было отмечено.
+func (r *RedisCache) MarkMessage(ctx context.Context, deviceID, messageID string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("dedup:%s:%s", deviceTag(deviceID), messageID)
+
+	var marked bool
+	err := r.do(ctx, "mark_message", func(ctx context.Context) error {
+		var err error
+		marked, err = r.client.SetNX(ctx, key, 1, ttl).Result()
+		return err
+	})
+	return marked, err
+}
+
+// UnmarkMessage снимает отметку, чтобы повтор сообщения был принят
+func (r *RedisCache) UnmarkMessage(ctx context.Context, deviceID, messageID string) error {
+	key := fmt.Sprintf("dedup:%s:%s", deviceTag(deviceID), messageID)
+
+	return r.do(ctx, "unmark_message", func(ctx context.Context) error {
+		return r.client.Del(ctx, key).Err()
+	})
+}
+
+// RegisterMember регистрирует реплику в реестре кластера и обновляет heartbeat
+func (r *RedisCache) RegisterMember(ctx context.Context, id, addr string) error {
+	return r.do(ctx, "register_member", func(ctx context.Context) error {
+		pipe := r.client.Pipeline()
+		pipe.HSet(ctx, clusterMembersKey, id, addr)
+		pipe.ZAdd(ctx, clusterHeartbeatsKey, redis.Z{Score: float64(time.Now().Unix()), Member: id})
+
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+// UnregisterMember удаляет реплику из реестра кластера
+func (r *RedisCache) UnregisterMember(ctx context.Context, id string) error {
+	return r.do(ctx, "unregister_member", func(ctx context.Context) error {
+		pipe := r.client.Pipeline()
+		pipe.HDel(ctx, clusterMembersKey, id)
+		pipe.ZRem(ctx, clusterHeartbeatsKey, id)
+
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+// GetMembers возвращает живые реплики (id -> адрес), heartbeat которых не старше ttl.
+// Просроченные записи удаляются из реестра.
+func (r *RedisCache) GetMembers(ctx context.Context, ttl time.Duration) (map[string]string, error) {
+	deadline := time.Now().Add(-ttl).Unix()
+
+	var members map[string]string
+	err := r.do(ctx, "get_members", func(ctx context.Context) error {
+		stale, err := r.client.ZRangeByScore(ctx, clusterHeartbeatsKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: fmt.Sprintf("(%d", deadline),
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get stale members: %w", err)
+		}
+		if len(stale) > 0 {
+			pipe := r.client.Pipeline()
+			pipe.HDel(ctx, clusterMembersKey, stale...)
+			pipe.ZRemRangeByScore(ctx, clusterHeartbeatsKey, "-inf", fmt.Sprintf("(%d", deadline))
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("failed to remove stale members: %w", err)
+			}
+		}
+
+		members, err = r.client.HGetAll(ctx, clusterMembersKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get members: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SaveSilence сохраняет silence (создает или заменяет по id)
+func (r *RedisCache) SaveSilence(ctx context.Context, id string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal silence: %w", err)
+	}
+
+	return r.do(ctx, "save_silence", func(ctx context.Context) error {
+		return r.client.HSet(ctx, silencesKey, id, jsonData).Err()
+	})
+}
+
+// DeleteSilence удаляет silence; возвращает false, если его не было
+func (r *RedisCache) DeleteSilence(ctx context.Context, id string) (bool, error) {
+	var deleted int64
+	err := r.do(ctx, "delete_silence", func(ctx context.Context) error {
+		var err error
+		deleted, err = r.client.HDel(ctx, silencesKey, id).Result()
+		return err
+	})
+	return deleted > 0, err
+}
+
+// ListSilences возвращает все сохраненные silences в виде JSON
+func (r *RedisCache) ListSilences(ctx context.Context) ([]string, error) {
+	var silences []string
+	err := r.do(ctx, "list_silences", func(ctx context.Context) error {
+		var err error
+		silences, err = r.client.HVals(ctx, silencesKey).Result()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list silences: %w", err)
+	}
+	return silences, nil
+}
+
+// GetAnomaly получает сохраненную аномалию по ключу
+func (r *RedisCache) GetAnomaly(ctx context.Context, key string) (string, error) {
+	var data string
+	err := r.do(ctx, "get_anomaly", func(ctx context.Context) error {
+		var err error
+		data, err = r.client.Get(ctx, key).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	return data, err
+}
+
+// GetAnomalies получает сохраненные аномалии по ключам (истекшие не попадают в результат)
+func (r *RedisCache) GetAnomalies(ctx context.Context, keys []string) (map[string]string, error) {
+	anomalies := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return anomalies, nil
+	}
+
+	err := r.do(ctx, "get_anomalies", func(ctx context.Context) error {
+		// Ключи разных устройств лежат в разных слотах, поэтому pipeline вместо MGET
+		pipe := r.client.Pipeline()
+		cmds := make([]*redis.StringCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+		for i, cmd := range cmds {
+			if data, err := cmd.Result(); err == nil {
+				anomalies[keys[i]] = data
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomalies: %w", err)
+	}
+	return anomalies, nil
+}
+
+// ListAnomalyKeys возвращает ключи аномалий всех устройств, начиная с последних сохраненных
+func (r *RedisCache) ListAnomalyKeys(ctx context.Context, offset, limit int) ([]string, error) {
+	var keys []string
+	err := r.do(ctx, "list_anomalies", func(ctx context.Context) error {
+		var err error
+		keys, err = r.client.ZRevRange(ctx, anomalyIndexKey, int64(offset), int64(offset+limit-1)).Result()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	return keys, nil
+}
+
+// SetAnomalyStatus сохраняет статус (разметку) аномалии.
+// Разметка хранится без TTL, чтобы размеченные аномалии переживали исходные ключи.
+func (r *RedisCache) SetAnomalyStatus(ctx context.Context, key string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly status: %w", err)
+	}
+
+	return r.do(ctx, "set_anomaly_status", func(ctx context.Context) error {
+		return r.client.HSet(ctx, anomalyStatusKey, key, jsonData).Err()
+	})
+}
+
+// GetAnomalyStatuses возвращает статусы аномалий по ключам (отсутствующие не попадают в результат)
+func (r *RedisCache) GetAnomalyStatuses(ctx context.Context, keys []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return statuses, nil
+	}
+
+	err := r.do(ctx, "get_anomaly_statuses", func(ctx context.Context) error {
+		values, err := r.client.HMGet(ctx, anomalyStatusKey, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			if s, ok := v.(string); ok {
+				statuses[keys[i]] = s
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomaly statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+// ScanAnomalyStatuses обходит все статусы аномалий порциями
+func (r *RedisCache) ScanAnomalyStatuses(ctx context.Context, fn func(key, data string) error) error {
+	var cursor uint64
+	for {
+		var fields []string
+		err := r.do(ctx, "scan_anomaly_statuses", func(ctx context.Context) error {
+			var err error
+			fields, cursor, err = r.client.HScan(ctx, anomalyStatusKey, cursor, "", 500).Result()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan anomaly statuses: %w", err)
+		}
+
+		for i := 0; i+1 < len(fields); i += 2 {
+			if err := fn(fields[i], fields[i+1]); err != nil {
+				return err
+			}
+		}
+
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Close останавливает переподключение и закрывает соединение с Redis
 func (r *RedisCache) Close() error {
+	close(r.stopCh)
+	r.wg.Wait()
+
+	if n := r.spool.len(); n > 0 {
+		log.Printf("Redis cache closed with %d unsent spooled writes\n", n)
+	}
 	return r.client.Close()
 }
 
 // Ping проверяет доступность Redis
-func (r *RedisCache) Ping() error {
-	return r.client.Ping(r.ctx).Err()
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.do(ctx, "ping", func(ctx context.Context) error {
+		return r.client.Ping(ctx).Err()
+	})
 }
 
 // GetStats возвращает статистику Redis
 func (r *RedisCache) GetStats() map[string]interface{} {
 	stats := r.client.PoolStats()
 
+	state := r.State()
+
 	return map[string]interface{}{
-		"hits":        stats.Hits,
-		"misses":      stats.Misses,
-		"timeouts":    stats.Timeouts,
-		"total_conns": stats.TotalConns,
-		"idle_conns":  stats.IdleConns,
-		"stale_conns": stats.StaleConns,
+		"hits":          stats.Hits,
+		"misses":        stats.Misses,
+		"timeouts":      stats.Timeouts,
+		"total_conns":   stats.TotalConns,
+		"idle_conns":    stats.IdleConns,
+		"stale_conns":   stats.StaleConns,
+		"connected":     state.Connected,
+		"spooled":       state.Spooled,
+		"spool_dropped": state.SpoolDropped,
+		"breaker_state": r.breaker.State().String(),
 	}
 }
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMergeAnomalyLists(t *testing.T) {
+	current := []redis.Z{
+		{Score: 30, Member: "anomaly:{d1}:30"},
+		{Score: 10, Member: "anomaly:{d1}:10"},
+	}
+	legacy := []redis.Z{
+		{Score: 20, Member: "anomaly:d1:20"},
+		{Score: 5, Member: "anomaly:d1:5"},
+	}
+
+	tests := []struct {
+		name    string
+		current []redis.Z
+		legacy  []redis.Z
+		limit   int
+		want    []string
+	}{
+		{"only current", current, nil, 10, []string{"anomaly:{d1}:30", "anomaly:{d1}:10"}},
+		{"only legacy", nil, legacy, 10, []string{"anomaly:d1:20", "anomaly:d1:5"}},
+		{"merged by time", current, legacy, 10, []string{"anomaly:{d1}:30", "anomaly:d1:20", "anomaly:{d1}:10", "anomaly:d1:5"}},
+		{"limited", current, legacy, 3, []string{"anomaly:{d1}:30", "anomaly:d1:20", "anomaly:{d1}:10"}},
+		{"no limit", current, legacy, 0, []string{"anomaly:{d1}:30", "anomaly:d1:20", "anomaly:{d1}:10", "anomaly:d1:5"}},
+		{"empty", nil, nil, 10, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeAnomalyLists(tt.current, tt.legacy, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeAnomalyLists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Виды отложенных записей
+const (
+	entryMetric   = "metric"
+	entryAnalysis = "analysis"
+	entryAnomaly  = "anomaly"
+	// Аномалия, найденная при загрузке истории
+	entryBackfillAnomaly = "backfill_anomaly"
+)
+
+// spoolEntry запись, отложенная до восстановления соединения с Redis
+type spoolEntry struct {
+	kind      string
+	deviceID  string
+	timestamp time.Time
+	data      []byte
+	// anomalyType тип аномалии, входит в ключ инцидента
+	anomalyType string
+}
+
+// spool ограниченный локальный буфер записей.
+// При переполнении вытесняются самые старые записи.
+type spool struct {
+	entries  []spoolEntry
+	head     int
+	size     int
+	capacity int
+	dropped  int64
+	mu       sync.Mutex
+}
+
+// newSpool создает буфер заданной емкости
+func newSpool(capacity int) *spool {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &spool{
+		entries:  make([]spoolEntry, capacity),
+		capacity: capacity,
+	}
+}
+
+// push добавляет запись в конец буфера; возвращает false, если была вытеснена старая запись
+func (s *spool) push(entry spoolEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tail := (s.head + s.size) % s.capacity
+	s.entries[tail] = entry
+
+	if s.size == s.capacity {
+		s.head = (s.head + 1) % s.capacity
+		s.dropped++
+		return false
+	}
+	s.size++
+	return true
+}
+
+// pop извлекает самую старую запись
+func (s *spool) pop() (spoolEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size == 0 {
+		return spoolEntry{}, false
+	}
+
+	entry := s.entries[s.head]
+	s.entries[s.head] = spoolEntry{}
+	s.head = (s.head + 1) % s.capacity
+	s.size--
+	return entry, true
+}
+
+// unpop возвращает запись в начало буфера (если повторить запись не удалось)
+func (s *spool) unpop(entry spoolEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size == s.capacity {
+		// Место заняли новые записи - старая запись теряется
+		s.dropped++
+		return
+	}
+
+	s.head = (s.head - 1 + s.capacity) % s.capacity
+	s.entries[s.head] = entry
+	s.size++
+}
+
+// len возвращает количество отложенных записей
+func (s *spool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// droppedCount возвращает количество вытесненных записей
+func (s *spool) droppedCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/metrics"
+)
+
+// ForwardedHeader заголовок, которым помечаются запросы, пересланные другой репликой.
+// Такие запросы обрабатываются локально без повторной пересылки.
+const ForwardedHeader = "X-Cluster-Forwarded-By"
+
+// SecretHeader заголовок с общим секретом реплик. Без верного секрета
+// ForwardedHeader игнорируется, а передача окон отклоняется.
+const SecretHeader = "X-Cluster-Secret"
+
+// HandoffPath путь для приема окон устройств от других реплик
+const HandoffPath = "/cluster/handoff"
+
+// Config конфигурация узла кластера
+type Config struct {
+	NodeID            string
+	AdvertiseAddr     string
+	HeartbeatInterval time.Duration
+	MemberTTL         time.Duration
+	VirtualNodes      int
+	// Secret общий секрет реплик для пересылки метрик и передачи окон
+	Secret string
+}
+
+// Node реплика, участвующая в распределении устройств по кольцу
+type Node struct {
+	config   Config
+	cache    *cache.RedisCache
+	analyzer *analytics.Analyzer
+	client   *http.Client
+
+	ring   *Ring
+	mu     sync.RWMutex
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewNode создает узел кластера
+func NewNode(config Config, redisCache *cache.RedisCache, analyzer *analytics.Analyzer) *Node {
+	return &Node{
+		config:   config,
+		cache:    redisCache,
+		analyzer: analyzer,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		ring:     NewRing(map[string]string{config.NodeID: config.AdvertiseAddr}, config.VirtualNodes),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start регистрирует реплику и запускает heartbeat
+func (n *Node) Start() {
+	n.heartbeat()
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		ticker := time.NewTicker(n.config.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-n.stopCh:
+				return
+			case <-ticker.C:
+				n.heartbeat()
+			}
+		}
+	}()
+}
+
+// Stop удаляет реплику из реестра и передает ее окна оставшимся владельцам
+func (n *Node) Stop() {
+	close(n.stopCh)
+	n.wg.Wait()
+
+	if err := n.cache.UnregisterMember(context.Background(), n.config.NodeID); err != nil {
+		log.Printf("Cluster: failed to unregister member %s: %v\n", n.config.NodeID, err)
+	}
+
+	members, err := n.cache.GetMembers(context.Background(), n.config.MemberTTL)
+	if err != nil {
+		log.Printf("Cluster: failed to get members on shutdown: %v\n", err)
+		return
+	}
+	delete(members, n.config.NodeID)
+	if len(members) == 0 {
+		return
+	}
+
+	n.setRing(NewRing(members, n.config.VirtualNodes))
+	n.rebalance()
+}
+
+// heartbeat обновляет запись реплики, перестраивает кольцо при изменении состава
+// и передает окна чужих устройств
+func (n *Node) heartbeat() {
+	if err := n.cache.RegisterMember(context.Background(), n.config.NodeID, n.config.AdvertiseAddr); err != nil {
+		log.Printf("Cluster: heartbeat failed: %v\n", err)
+		return
+	}
+
+	members, err := n.cache.GetMembers(context.Background(), n.config.MemberTTL)
+	if err != nil {
+		log.Printf("Cluster: failed to get members: %v\n", err)
+		return
+	}
+	members[n.config.NodeID] = n.config.AdvertiseAddr
+
+	metrics.ClusterMembers.Set(float64(len(members)))
+
+	n.mu.RLock()
+	changed := !n.ring.Equal(members)
+	n.mu.RUnlock()
+
+	if changed {
+		log.Printf("Cluster: membership changed, %d members\n", len(members))
+		n.setRing(NewRing(members, n.config.VirtualNodes))
+	}
+	// Передаем и окна, в которые попали метрики после прошлой передачи
+	n.rebalance()
+}
+
+// setRing заменяет текущее кольцо
+func (n *Node) setRing(ring *Ring) {
+	n.mu.Lock()
+	n.ring = ring
+	n.mu.Unlock()
+}
+
+// Owner возвращает владельца устройства и признак того, что это текущая реплика
+func (n *Node) Owner(deviceID string) (Member, bool) {
+	n.mu.RLock()
+	owner, ok := n.ring.Owner(deviceID)
+	n.mu.RUnlock()
+
+	if !ok || owner.ID == n.config.NodeID {
+		return owner, true
+	}
+	return owner, false
+}
+
+// NodeID возвращает идентификатор текущей реплики
+func (n *Node) NodeID() string {
+	return n.config.NodeID
+}
+
+// Members возвращает текущий состав кластера
+func (n *Node) Members() []Member {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ring.Members()
+}
+
+// Authenticated проверяет, что запрос пришел от реплики с тем же секретом
+func (n *Node) Authenticated(r *http.Request) bool {
+	if n.config.Secret == "" {
+		return false
+	}
+	secret := r.Header.Get(SecretHeader)
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(n.config.Secret)) == 1
+}
+
+// Forwarded проверяет, что запрос переслан другой репликой
+func (n *Node) Forwarded(r *http.Request) bool {
+	return r.Header.Get(ForwardedHeader) != "" && n.Authenticated(r)
+}
+
+// setPeerHeaders помечает запрос к другой реплике
+func (n *Node) setPeerHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ForwardedHeader, n.config.NodeID)
+	req.Header.Set(SecretHeader, n.config.Secret)
+}
+
+// Forward пересылает тело запроса владельцу устройства
+func (n *Node) Forward(ctx context.Context, owner Member, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+owner.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build forward request: %w", err)
+	}
+	n.setPeerHeaders(req)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		metrics.ClusterForwarded.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to forward to %s: %w", owner.ID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.ClusterForwarded.WithLabelValues("error").Inc()
+		return fmt.Errorf("owner %s responded with status %d", owner.ID, resp.StatusCode)
+	}
+
+	metrics.ClusterForwarded.WithLabelValues("success").Inc()
+	return nil
+}
+
+// rebalance передает окна устройств, которыми реплика больше не владеет.
+// Окно отсоединяется до отправки, поэтому метрики, пришедшие во время передачи,
+// копятся в новом окне и уходят владельцу при следующем heartbeat.
+// Если передать окна не удалось, они возвращаются в анализатор.
+func (n *Node) rebalance() {
+	handoffs := make(map[Member][]analytics.WindowSnapshot)
+
+	for _, deviceID := range n.analyzer.DeviceIDs() {
+		owner, local := n.Owner(deviceID)
+		if local {
+			continue
+		}
+		if snapshot, ok := n.analyzer.DetachWindow(deviceID); ok {
+			handoffs[owner] = append(handoffs[owner], snapshot)
+		}
+	}
+
+	for owner, snapshots := range handoffs {
+		if err := n.handoff(owner, snapshots); err != nil {
+			for _, snapshot := range snapshots {
+				n.analyzer.ImportWindow(snapshot)
+			}
+			metrics.ClusterHandoffWindows.WithLabelValues("out", "error").Add(float64(len(snapshots)))
+			log.Printf("Cluster: handoff of %d windows to %s failed: %v\n", len(snapshots), owner.ID, err)
+			continue
+		}
+
+		metrics.ClusterHandoffWindows.WithLabelValues("out", "success").Add(float64(len(snapshots)))
+		log.Printf("Cluster: handed off %d windows to %s\n", len(snapshots), owner.ID)
+	}
+}
+
+// handoff отправляет окна устройств новому владельцу
+func (n *Node) handoff(owner Member, snapshots []analytics.WindowSnapshot) error {
+	body, err := json.Marshal(snapshots)
+	if err != nil {
+		return fmt.Errorf("failed to marshal windows: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+owner.Addr+HandoffPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build handoff request: %w", err)
+	}
+	n.setPeerHeaders(req)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("owner responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
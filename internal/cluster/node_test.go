@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+)
+
+// testPeer реплика-получатель окон
+type testPeer struct {
+	server *httptest.Server
+	status int
+
+	mu       sync.Mutex
+	received map[string]analytics.WindowSnapshot
+}
+
+func newTestPeer(t *testing.T, status int) *testPeer {
+	p := &testPeer{status: status, received: make(map[string]analytics.WindowSnapshot)}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != HandoffPath || r.Header.Get(SecretHeader) != "secret" || r.Header.Get(ForwardedHeader) != "a" {
+			t.Errorf("unexpected handoff request %s with headers %v", r.URL.Path, r.Header)
+		}
+		var snapshots []analytics.WindowSnapshot
+		if err := json.NewDecoder(r.Body).Decode(&snapshots); err != nil {
+			t.Errorf("invalid handoff body: %v", err)
+		}
+		if p.status == http.StatusOK {
+			p.mu.Lock()
+			for _, snapshot := range snapshots {
+				p.received[snapshot.DeviceID] = snapshot
+			}
+			p.mu.Unlock()
+		}
+		w.WriteHeader(p.status)
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func TestRebalance(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantMoved  bool
+		wantWindow int
+	}{
+		{"handoff succeeds", http.StatusOK, true, 2},
+		{"handoff fails", http.StatusInternalServerError, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := newTestPeer(t, tt.status)
+			analyzer := analytics.NewAnalyzer(10, 2)
+			node := NewNode(Config{NodeID: "a", AdvertiseAddr: "a:8080", VirtualNodes: 64, Secret: "secret"}, nil, analyzer)
+
+			base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			var devices []string
+			for i := 0; i < 50; i++ {
+				device := "device-" + strconv.Itoa(i)
+				devices = append(devices, device)
+				for s := 0; s < 2; s++ {
+					analyzer.Analyze(analytics.MetricData{DeviceID: device, Timestamp: base.Add(time.Duration(s) * time.Second), CPU: 1})
+				}
+			}
+
+			// В кластер входит вторая реплика
+			node.setRing(NewRing(map[string]string{"a": "a:8080", "b": strings.TrimPrefix(peer.server.URL, "http://")}, 64))
+			node.rebalance()
+
+			local := make(map[string]bool)
+			for _, id := range analyzer.DeviceIDs() {
+				local[id] = true
+			}
+			peer.mu.Lock()
+			defer peer.mu.Unlock()
+
+			moved := 0
+			for _, device := range devices {
+				_, own := node.Owner(device)
+				if own || !tt.wantMoved {
+					// Свои окна и окна, которые не удалось передать, остаются на месте
+					if !local[device] {
+						t.Errorf("window of %s was removed", device)
+					}
+					if snapshot, ok := analyzer.ExportWindow(device); !ok || len(snapshot.CPU) != tt.wantWindow {
+						t.Errorf("window of %s has %d samples, want %d", device, len(snapshot.CPU), tt.wantWindow)
+					}
+					continue
+				}
+				moved++
+				if local[device] {
+					t.Errorf("window of %s stayed after handoff", device)
+				}
+				if snapshot, ok := peer.received[device]; !ok || len(snapshot.CPU) != tt.wantWindow {
+					t.Errorf("peer received %+v for %s, want %d samples", snapshot, device, tt.wantWindow)
+				}
+			}
+			if tt.wantMoved && moved == 0 {
+				t.Error("no windows moved to the new member")
+			}
+			if moved != len(peer.received) {
+				t.Errorf("peer received %d windows, want %d", len(peer.received), moved)
+			}
+		})
+	}
+}
+
+func TestAuthenticated(t *testing.T) {
+	tests := []struct {
+		name          string
+		secret        string
+		headers       map[string]string
+		wantAuth      bool
+		wantForwarded bool
+	}{
+		{"peer", "secret", map[string]string{SecretHeader: "secret", ForwardedHeader: "b"}, true, true},
+		{"handoff without forwarded header", "secret", map[string]string{SecretHeader: "secret"}, true, false},
+		{"client sets forwarded header", "secret", map[string]string{ForwardedHeader: "b"}, false, false},
+		{"wrong secret", "secret", map[string]string{SecretHeader: "guess", ForwardedHeader: "b"}, false, false},
+		{"secret not configured", "", map[string]string{SecretHeader: "", ForwardedHeader: "b"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := NewNode(Config{NodeID: "a", Secret: tt.secret}, nil, nil)
+			r := httptest.NewRequest(http.MethodPost, "/metrics", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := node.Authenticated(r); got != tt.wantAuth {
+				t.Errorf("Authenticated() = %v, want %v", got, tt.wantAuth)
+			}
+			if got := node.Forwarded(r); got != tt.wantForwarded {
+				t.Errorf("Forwarded() = %v, want %v", got, tt.wantForwarded)
+			}
+		})
+	}
+}
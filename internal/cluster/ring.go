@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// Member реплика сервиса в кластере
+type Member struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// Ring кольцо консистентного хеширования с виртуальными узлами
+type Ring struct {
+	virtualNodes int
+	hashes       []uint32
+	owners       map[uint32]Member
+	members      map[string]Member
+}
+
+// NewRing создает кольцо для заданного набора реплик
+func NewRing(members map[string]string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = 1
+	}
+
+	ring := &Ring{
+		virtualNodes: virtualNodes,
+		owners:       make(map[uint32]Member, len(members)*virtualNodes),
+		members:      make(map[string]Member, len(members)),
+	}
+
+	for id, addr := range members {
+		member := Member{ID: id, Addr: addr}
+		ring.members[id] = member
+		for i := 0; i < virtualNodes; i++ {
+			hash := crc32.ChecksumIEEE([]byte(id + "#" + strconv.Itoa(i)))
+			// При коллизии побеждает меньший ID, чтобы все реплики строили одинаковое кольцо
+			if existing, ok := ring.owners[hash]; ok && existing.ID < id {
+				continue
+			}
+			if _, ok := ring.owners[hash]; !ok {
+				ring.hashes = append(ring.hashes, hash)
+			}
+			ring.owners[hash] = member
+		}
+	}
+
+	sort.Slice(ring.hashes, func(i, j int) bool {
+		return ring.hashes[i] < ring.hashes[j]
+	})
+
+	return ring
+}
+
+// Owner возвращает реплику, владеющую ключом
+func (r *Ring) Owner(key string) (Member, bool) {
+	if len(r.hashes) == 0 {
+		return Member{}, false
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+
+	return r.owners[r.hashes[idx]], true
+}
+
+// Members возвращает реплики кольца
+func (r *Ring) Members() []Member {
+	members := make([]Member, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+	return members
+}
+
+// Equal проверяет, что кольца построены для одинакового набора реплик
+func (r *Ring) Equal(other map[string]string) bool {
+	if len(r.members) != len(other) {
+		return false
+	}
+	for id, addr := range other {
+		if m, ok := r.members[id]; !ok || m.Addr != addr {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestRingOwner(t *testing.T) {
+	if _, ok := NewRing(nil, 16).Owner("d1"); ok {
+		t.Error("empty ring must not have owners")
+	}
+
+	single := NewRing(map[string]string{"a": "a:8080"}, 16)
+	for i := 0; i < 100; i++ {
+		if owner, ok := single.Owner("device-" + strconv.Itoa(i)); !ok || owner != (Member{ID: "a", Addr: "a:8080"}) {
+			t.Fatalf("Owner() = %+v, %v; want the only member", owner, ok)
+		}
+	}
+
+	// Все реплики строят одинаковое кольцо и выбирают одного владельца
+	members := map[string]string{"a": "a:8080", "b": "b:8080", "c": "c:8080"}
+	ring, other := NewRing(members, 64), NewRing(members, 64)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := "device-" + strconv.Itoa(i)
+		owner, _ := ring.Owner(key)
+		if again, _ := other.Owner(key); again != owner {
+			t.Fatalf("Owner(%s) = %s and %s on identical rings", key, owner.ID, again.ID)
+		}
+		counts[owner.ID]++
+	}
+	for id := range members {
+		if counts[id] < 500 {
+			t.Errorf("member %s owns %d of 3000 keys, want a fair share", id, counts[id])
+		}
+	}
+}
+
+func TestRingMembershipChange(t *testing.T) {
+	before := NewRing(map[string]string{"a": "a:8080", "b": "b:8080"}, 64)
+	after := NewRing(map[string]string{"a": "a:8080", "b": "b:8080", "c": "c:8080"}, 64)
+
+	// При добавлении реплики ключи переходят только к ней
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		key := "device-" + strconv.Itoa(i)
+		old, _ := before.Owner(key)
+		owner, _ := after.Owner(key)
+		if owner == old {
+			continue
+		}
+		moved++
+		if owner.ID != "c" {
+			t.Fatalf("key %s moved from %s to %s, want only moves to the new member", key, old.ID, owner.ID)
+		}
+	}
+	if moved == 0 {
+		t.Error("no keys moved to the new member")
+	}
+}
+
+func TestRingEqual(t *testing.T) {
+	ring := NewRing(map[string]string{"a": "a:8080", "b": "b:8080"}, 4)
+
+	tests := []struct {
+		name    string
+		members map[string]string
+		want    bool
+	}{
+		{"same members", map[string]string{"b": "b:8080", "a": "a:8080"}, true},
+		{"member added", map[string]string{"a": "a:8080", "b": "b:8080", "c": "c:8080"}, false},
+		{"member removed", map[string]string{"a": "a:8080"}, false},
+		{"member replaced", map[string]string{"a": "a:8080", "c": "b:8080"}, false},
+		{"address changed", map[string]string{"a": "a:8080", "b": "b:9000"}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ring.Equal(tt.members); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingHashCollision(t *testing.T) {
+	// Виртуальные узлы этих реплик попадают в одну точку кольца
+	const winner, loser = "iiwucoup", "uejgtcuo"
+	if crc32.ChecksumIEEE([]byte(winner+"#0")) != crc32.ChecksumIEEE([]byte(loser+"#0")) {
+		t.Fatal("test members must collide")
+	}
+
+	// Порядок обхода map случаен, поэтому кольцо строится несколько раз
+	for i := 0; i < 20; i++ {
+		ring := NewRing(map[string]string{loser: "l:8080", winner: "w:8080"}, 1)
+		if len(ring.hashes) != 1 {
+			t.Fatalf("ring has %d points, want 1", len(ring.hashes))
+		}
+		if owner, _ := ring.Owner("d1"); owner.ID != winner {
+			t.Fatalf("collision won by %s, want the smaller ID %s", owner.ID, winner)
+		}
+		// Проигравшая реплика остается в составе кольца
+		if members := ring.Members(); len(members) != 2 {
+			t.Fatalf("members = %v, want both", members)
+		}
+	}
+}
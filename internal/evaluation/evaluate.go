@@ -0,0 +1,179 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/models"
+)
+
+// Interval известная аномалия устройства в разметке
+type Interval struct {
+	DeviceID string    `json:"device_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Config параметры анализатора, для которых считается оценка
+type Config struct {
+	WindowSize int     `json:"window_size"`
+	Threshold  float64 `json:"threshold"`
+	Detector   string  `json:"detector"`
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("window=%d threshold=%g detector=%s", c.WindowSize, c.Threshold, c.Detector)
+}
+
+// Report качество обнаружения для одной конфигурации.
+// Полнота считается по событиям: размеченная аномалия обнаружена, если внутри
+// интервала (с учетом допуска после конца) есть хотя бы один аномальный результат.
+// Точность считается по точкам: доля аномальных результатов, попавших в размеченные интервалы.
+type Report struct {
+	Config
+
+	Events         int `json:"events"`
+	Detected       int `json:"detected"`
+	Flagged        int `json:"flagged"`
+	TruePositives  int `json:"true_positives"`
+	FalsePositives int `json:"false_positives"`
+
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+
+	// Задержка обнаружения от начала интервала до первого аномального результата
+	MeanDelay time.Duration `json:"mean_delay_ns"`
+	MaxDelay  time.Duration `json:"max_delay_ns"`
+}
+
+// Grid перебирает все сочетания размеров окна, порогов и детекторов
+func Grid(windows []int, thresholds []float64, detectors []string) []Config {
+	configs := make([]Config, 0, len(windows)*len(thresholds)*len(detectors))
+	for _, detector := range detectors {
+		for _, window := range windows {
+			for _, threshold := range thresholds {
+				configs = append(configs, Config{WindowSize: window, Threshold: threshold, Detector: detector})
+			}
+		}
+	}
+	return configs
+}
+
+// LoadLabels читает разметку: JSON массив интервалов {"device_id","start","end"}
+func LoadLabels(r io.Reader) ([]Interval, error) {
+	var labels []Interval
+	if err := json.NewDecoder(r).Decode(&labels); err != nil {
+		return nil, fmt.Errorf("invalid labels: %w", err)
+	}
+	for i, label := range labels {
+		if label.DeviceID == "" {
+			return nil, fmt.Errorf("label %d: device_id is required", i)
+		}
+		if label.End.Before(label.Start) {
+			return nil, fmt.Errorf("label %d: end is before start", i)
+		}
+	}
+	return labels, nil
+}
+
+// Evaluate прогоняет отсортированные по времени метрики через новый анализатор
+// с параметрами config и сравнивает результаты с разметкой.
+// tolerance - сколько после конца интервала аномальный результат еще считается попаданием.
+func Evaluate(series []models.Metric, labels []Interval, config Config, tolerance time.Duration) (Report, error) {
+	if config.WindowSize <= 0 {
+		return Report{}, errors.New("window size must be positive")
+	}
+	analyzer := analytics.NewAnalyzer(config.WindowSize, config.Threshold)
+	if err := analyzer.SetDetector(config.Detector); err != nil {
+		return Report{}, err
+	}
+
+	byDevice := make(map[string][]Interval)
+	for _, label := range labels {
+		byDevice[label.DeviceID] = append(byDevice[label.DeviceID], label)
+	}
+	for _, intervals := range byDevice {
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].Start.Before(intervals[j].Start)
+		})
+	}
+
+	// firstHit время первого аномального результата в интервале
+	firstHit := make(map[*Interval]time.Time)
+	report := Report{Config: config, Events: len(labels)}
+
+	for _, metric := range series {
+		result, ok := analyzer.Analyze(analytics.MetricData{
+			DeviceID:  metric.DeviceID,
+			Timestamp: metric.Timestamp,
+			CPU:       metric.CPU,
+			RPS:       metric.RPS,
+		})
+		if !ok || !result.IsAnomaly {
+			continue
+		}
+		report.Flagged++
+
+		hit := false
+		intervals := byDevice[result.DeviceID]
+		for i := range intervals {
+			interval := &intervals[i]
+			if result.Timestamp.Before(interval.Start) || result.Timestamp.After(interval.End.Add(tolerance)) {
+				continue
+			}
+			hit = true
+			if _, seen := firstHit[interval]; !seen {
+				firstHit[interval] = result.Timestamp
+			}
+		}
+		if hit {
+			report.TruePositives++
+		} else {
+			report.FalsePositives++
+		}
+	}
+
+	var totalDelay time.Duration
+	for interval, at := range firstHit {
+		delay := at.Sub(interval.Start)
+		totalDelay += delay
+		if delay > report.MaxDelay {
+			report.MaxDelay = delay
+		}
+	}
+	report.Detected = len(firstHit)
+	if report.Detected > 0 {
+		report.MeanDelay = totalDelay / time.Duration(report.Detected)
+	}
+
+	report.Precision = ratio(report.TruePositives, report.Flagged)
+	report.Recall = ratio(report.Detected, report.Events)
+	if report.Precision+report.Recall > 0 {
+		report.F1 = 2 * report.Precision * report.Recall / (report.Precision + report.Recall)
+	}
+	return report, nil
+}
+
+// Rank сортирует отчеты по убыванию F1, при равенстве - по меньшей средней задержке
+func Rank(reports []Report) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].F1 != reports[j].F1 {
+			return reports[i].F1 > reports[j].F1
+		}
+		return reports[i].MeanDelay < reports[j].MeanDelay
+	})
+}
+
+// ratio доля n от total, 0 при пустом total
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,133 @@
+package evaluation
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/models"
+)
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at время через n секунд от base
+func at(n int) time.Time {
+	return base.Add(time.Duration(n) * time.Second)
+}
+
+// testSeries строит ряд d1 и d2 по точке в секунду с постоянной загрузкой 10
+// и одиночными всплесками до 100. Всплеск в заполненном окне из 10 постоянных
+// значений дает z-score ровно 3, остальные точки - не больше 0.33 по модулю.
+func testSeries() []models.Metric {
+	spikes := map[string]map[int]bool{
+		"d1": {20: true, 40: true, 52: true},
+		"d2": {15: true},
+	}
+	var series []models.Metric
+	for n := 0; n < 60; n++ {
+		for _, device := range []string{"d1", "d2"} {
+			cpu := 10.0
+			if spikes[device][n] {
+				cpu = 100
+			}
+			series = append(series, models.Metric{DeviceID: device, Timestamp: at(n), CPU: cpu})
+		}
+	}
+	return series
+}
+
+func TestEvaluate(t *testing.T) {
+	labels := []Interval{
+		// Всплеск d1 через 2 секунды после начала
+		{DeviceID: "d1", Start: at(18), End: at(25)},
+		// Пропущенная аномалия
+		{DeviceID: "d1", Start: at(30), End: at(35)},
+		// Всплеск d1 через секунду после конца интервала
+		{DeviceID: "d1", Start: at(50), End: at(51)},
+		// Всплеск d2 через 5 секунд после начала
+		{DeviceID: "d2", Start: at(10), End: at(20)},
+	}
+	config := Config{WindowSize: 10, Threshold: 2, Detector: analytics.DetectorZScore}
+
+	tests := []struct {
+		name      string
+		tolerance time.Duration
+		want      Report
+	}{
+		{
+			name:      "hit within tolerance",
+			tolerance: 2 * time.Second,
+			want: Report{
+				Events: 4, Detected: 3, Flagged: 4, TruePositives: 3, FalsePositives: 1,
+				Precision: 0.75, Recall: 0.75, F1: 0.75,
+				MeanDelay: 3 * time.Second, MaxDelay: 5 * time.Second,
+			},
+		},
+		{
+			name: "hit after end without tolerance",
+			want: Report{
+				Events: 4, Detected: 2, Flagged: 4, TruePositives: 2, FalsePositives: 2,
+				Precision: 0.5, Recall: 0.5, F1: 0.5,
+				MeanDelay: 3500 * time.Millisecond, MaxDelay: 5 * time.Second,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(testSeries(), labels, config, tt.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Config = config
+			if !almostEqual(got.Precision, tt.want.Precision) || !almostEqual(got.Recall, tt.want.Recall) || !almostEqual(got.F1, tt.want.F1) {
+				t.Errorf("precision %g, recall %g, f1 %g; want %g, %g, %g",
+					got.Precision, got.Recall, got.F1, tt.want.Precision, tt.want.Recall, tt.want.F1)
+			}
+			got.Precision, got.Recall, got.F1 = tt.want.Precision, tt.want.Recall, tt.want.F1
+			if got != tt.want {
+				t.Errorf("report = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateOverlappingLabels(t *testing.T) {
+	// Один всплеск попадает в оба интервала: это одна истинная точка и два обнаруженных события
+	labels := []Interval{
+		{DeviceID: "d2", Start: at(10), End: at(20)},
+		{DeviceID: "d2", Start: at(14), End: at(16)},
+	}
+	got, err := Evaluate(testSeries(), labels, Config{WindowSize: 10, Threshold: 2, Detector: analytics.DetectorZScore}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TruePositives != 1 || got.FalsePositives != 3 || got.Detected != 2 {
+		t.Errorf("tp %d, fp %d, detected %d; want 1, 3, 2", got.TruePositives, got.FalsePositives, got.Detected)
+	}
+	if got.MeanDelay != 3*time.Second || got.MaxDelay != 5*time.Second {
+		t.Errorf("mean delay %s, max delay %s; want 3s and 5s", got.MeanDelay, got.MaxDelay)
+	}
+}
+
+func TestEvaluateInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"zero window", Config{WindowSize: 0, Threshold: 2, Detector: analytics.DetectorZScore}},
+		{"unknown detector", Config{WindowSize: 10, Threshold: 2, Detector: "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Evaluate(testSeries(), nil, tt.config, 0); err == nil {
+				t.Error("Evaluate() = nil error, want error")
+			}
+		})
+	}
+}
+
+// almostEqual сравнивает доли с точностью до ошибки округления
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,217 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	metricsv1 "highload-final/api/metrics/v1"
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/cluster"
+	"highload-final/internal/ingest"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// forwardBatchSize количество метрик чужого устройства, после которого они пересылаются владельцу
+const forwardBatchSize = 100
+
+// Server реализация gRPC сервиса метрик
+type Server struct {
+	metricsv1.UnimplementedMetricsServiceServer
+
+	analyzer *analytics.Analyzer
+	cache    *cache.RedisCache
+	ingest   *ingest.Pipeline
+}
+
+// NewServer создает gRPC сервис поверх общего конвейера приема метрик
+func NewServer(analyzer *analytics.Analyzer, cache *cache.RedisCache, pipeline *ingest.Pipeline) *Server {
+	return &Server{
+		analyzer: analyzer,
+		cache:    cache,
+		ingest:   pipeline,
+	}
+}
+
+// Register регистрирует сервис на gRPC сервере
+func (s *Server) Register(server *grpc.Server) {
+	metricsv1.RegisterMetricsServiceServer(server, s)
+}
+
+// SubmitMetrics принимает поток метрик от агента
+func (s *Server) SubmitMetrics(stream grpc.ClientStreamingServer[metricsv1.Metric, metricsv1.SubmitMetricsResponse]) error {
+	start := time.Now()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("GRPC", "SubmitMetrics").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx := stream.Context()
+	var resp metricsv1.SubmitMetricsResponse
+	remote := make(map[cluster.Member][]models.Metric)
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			metrics.RequestsTotal.WithLabelValues("GRPC", "SubmitMetrics", status.Code(err).String()).Inc()
+			return err
+		}
+		resp.Received++
+
+		metric := fromProto(msg)
+		if err := s.ingest.Validate(&metric); err != nil {
+			metrics.MetricsRejected.WithLabelValues("grpc", ingest.Reason(err)).Inc()
+			resp.Rejected++
+			continue
+		}
+
+		// Метрики чужих устройств копятся по владельцу и пересылаются пачками
+		if owner, isRemote := s.ingest.RemoteOwner(metric.DeviceID); isRemote {
+			remote[owner] = append(remote[owner], metric)
+			if len(remote[owner]) >= forwardBatchSize {
+				s.forward(ctx, owner, remote[owner], &resp)
+				delete(remote, owner)
+			}
+			continue
+		}
+
+		if err := s.ingest.Ingest(ctx, metric); err != nil {
+			metrics.MetricsRejected.WithLabelValues("grpc", ingest.Reason(err)).Inc()
+			resp.Rejected++
+			continue
+		}
+		resp.Accepted++
+	}
+
+	for owner, ownerMetrics := range remote {
+		s.forward(ctx, owner, ownerMetrics, &resp)
+	}
+
+	metrics.RequestsTotal.WithLabelValues("GRPC", "SubmitMetrics", codes.OK.String()).Inc()
+	return stream.SendAndClose(&resp)
+}
+
+// forward пересылает метрики владельцу и учитывает результат в ответе.
+// При ошибке пересылки метрики считаются отклоненными.
+func (s *Server) forward(ctx context.Context, owner cluster.Member, batch []models.Metric, resp *metricsv1.SubmitMetricsResponse) {
+	n := int64(len(batch))
+	if err := s.ingest.Forward(ctx, owner, batch); err != nil {
+		metrics.MetricsRejected.WithLabelValues("grpc", "forward_failed").Add(float64(n))
+		resp.Rejected += n
+		return
+	}
+	resp.Forwarded += n
+	resp.Accepted += n
+}
+
+// GetAnalytics возвращает последние аномалии устройства
+func (s *Server) GetAnalytics(ctx context.Context, req *metricsv1.GetAnalyticsRequest) (*metricsv1.GetAnalyticsResponse, error) {
+	start := time.Now()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("GRPC", "GetAnalytics").Observe(time.Since(start).Seconds())
+	}()
+
+	if req.GetDeviceId() == "" {
+		metrics.RequestsTotal.WithLabelValues("GRPC", "GetAnalytics", codes.InvalidArgument.String()).Inc()
+		return nil, status.Error(codes.InvalidArgument, "device_id is required")
+	}
+
+	anomalyKeys, err := s.cache.GetRecentAnomalies(ctx, req.GetDeviceId(), 10)
+	if err != nil {
+		code := codes.Internal
+		switch {
+		case ctx.Err() != nil:
+			code = codes.Canceled
+		case errors.Is(err, cache.ErrUnavailable):
+			code = codes.Unavailable
+		default:
+			metrics.RedisOperations.WithLabelValues("get_anomalies", "error").Inc()
+		}
+		metrics.RequestsTotal.WithLabelValues("GRPC", "GetAnalytics", code.String()).Inc()
+		return nil, status.Error(code, "failed to retrieve analytics")
+	}
+
+	metrics.RedisOperations.WithLabelValues("get_anomalies", "success").Inc()
+	metrics.RequestsTotal.WithLabelValues("GRPC", "GetAnalytics", codes.OK.String()).Inc()
+
+	return &metricsv1.GetAnalyticsResponse{
+		DeviceId:     req.GetDeviceId(),
+		AnomalyCount: int32(len(anomalyKeys)),
+		Anomalies:    anomalyKeys,
+	}, nil
+}
+
+// GetStats возвращает статистику анализатора и хранилища
+func (s *Server) GetStats(ctx context.Context, req *metricsv1.GetStatsRequest) (*metricsv1.GetStatsResponse, error) {
+	analyzerStats := s.analyzer.GetStats()
+	redisState := s.cache.State()
+
+	resp := &metricsv1.GetStatsResponse{
+		Analyzer: &metricsv1.AnalyzerStats{},
+		Redis: &metricsv1.RedisStats{
+			Connected:    redisState.Connected,
+			Spooled:      int64(redisState.Spooled),
+			SpoolDropped: redisState.SpoolDropped,
+		},
+		Timestamp: timestamppb.Now(),
+	}
+	if v, ok := analyzerStats["devices_tracked"].(int); ok {
+		resp.Analyzer.DevicesTracked = int64(v)
+	}
+	if v, ok := analyzerStats["window_size"].(int); ok {
+		resp.Analyzer.WindowSize = int64(v)
+	}
+	if v, ok := analyzerStats["threshold"].(float64); ok {
+		resp.Analyzer.Threshold = v
+	}
+	if v, ok := analyzerStats["queue_size"].(int); ok {
+		resp.Analyzer.QueueSize = int64(v)
+	}
+	if v, ok := analyzerStats["late_reordered"].(int64); ok {
+		resp.Analyzer.LateReordered = v
+	}
+	if v, ok := analyzerStats["late_dropped"].(int64); ok {
+		resp.Analyzer.LateDropped = v
+	}
+	if v, ok := s.cache.GetStats()["breaker_state"].(string); ok {
+		resp.Redis.BreakerState = v
+	}
+	for _, sub := range s.analyzer.SubscriberStats() {
+		resp.Analyzer.Subscribers = append(resp.Analyzer.Subscribers, &metricsv1.SubscriberStats{
+			Name:      sub.Name,
+			Policy:    sub.Policy,
+			Buffered:  int64(sub.Buffered),
+			Capacity:  int64(sub.Capacity),
+			Delivered: sub.Delivered,
+			Dropped:   sub.Dropped,
+		})
+	}
+
+	metrics.RequestsTotal.WithLabelValues("GRPC", "GetStats", codes.OK.String()).Inc()
+	return resp, nil
+}
+
+// fromProto преобразует метрику gRPC во внутреннюю модель
+func fromProto(msg *metricsv1.Metric) models.Metric {
+	metric := models.Metric{
+		DeviceID: msg.GetDeviceId(),
+		CPU:      msg.GetCpu(),
+		RPS:      msg.GetRps(),
+		Memory:   msg.GetMemory(),
+		Tags:     msg.GetTags(),
+	}
+	if msg.GetTimestamp() != nil {
+		metric.Timestamp = msg.GetTimestamp().AsTime()
+	}
+	return metric
+}
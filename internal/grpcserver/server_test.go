@@ -0,0 +1,137 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	metricsv1 "highload-final/api/metrics/v1"
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/cluster"
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// newTestServer создает сервис с анализатором и кэшем без Redis
+func newTestServer(t *testing.T) (*Server, *ingest.Pipeline) {
+	t.Helper()
+
+	redis, err := cache.NewRedisCache(cache.Options{
+		Mode:                cache.ModeSingle,
+		Addrs:               []string{"127.0.0.1:1"},
+		TTL:                 time.Minute,
+		ReconnectMinBackoff: time.Hour,
+		ReconnectMaxBackoff: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redis.Close() })
+
+	analyzer := analytics.NewAnalyzer(10, 2)
+	analyzer.Start(1)
+	t.Cleanup(analyzer.Stop)
+
+	pipeline := ingest.NewPipeline(analyzer, redis)
+	return NewServer(analyzer, redis, pipeline), pipeline
+}
+
+// dial поднимает gRPC сервер на bufconn и возвращает клиента
+func dial(t *testing.T, s *Server) metricsv1.MetricsServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	s.Register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return metricsv1.NewMetricsServiceClient(conn)
+}
+
+func TestSubmitMetrics(t *testing.T) {
+	s, _ := newTestServer(t)
+	client := dial(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SubmitMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := timestamppb.Now()
+	batch := []*metricsv1.Metric{
+		{DeviceId: "sensor-1", Cpu: 10, Rps: 100, Timestamp: now},
+		{DeviceId: "sensor-1", Cpu: 20, Rps: 120},
+		{DeviceId: "", Cpu: 10},
+		{DeviceId: "sensor-2", Cpu: 150},
+		{DeviceId: "bad id", Cpu: 10},
+	}
+	for _, m := range batch {
+		if err := stream.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetReceived() != 5 || resp.GetAccepted() != 2 || resp.GetRejected() != 3 || resp.GetForwarded() != 0 {
+		t.Errorf("response = %+v, want received=5 accepted=2 rejected=3 forwarded=0", resp)
+	}
+}
+
+func TestForward(t *testing.T) {
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer owner.Close()
+
+	tests := []struct {
+		name          string
+		addr          string
+		wantAccepted  int64
+		wantForwarded int64
+		wantRejected  int64
+	}{
+		{"owner accepts", strings.TrimPrefix(owner.URL, "http://"), 2, 2, 0},
+		// Реплика-владелец недоступна: метрики не пропадают из учета
+		{"owner unavailable", "127.0.0.1:1", 0, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pipeline := newTestServer(t)
+			pipeline.SetCluster(cluster.NewNode(cluster.Config{NodeID: "self"}, nil, nil))
+
+			batch := []models.Metric{{DeviceID: "sensor-1"}, {DeviceID: "sensor-2"}}
+			var resp metricsv1.SubmitMetricsResponse
+			s.forward(context.Background(), cluster.Member{ID: "other", Addr: tt.addr}, batch, &resp)
+
+			if resp.GetAccepted() != tt.wantAccepted || resp.GetForwarded() != tt.wantForwarded || resp.GetRejected() != tt.wantRejected {
+				t.Errorf("response = %+v, want accepted=%d forwarded=%d rejected=%d",
+					&resp, tt.wantAccepted, tt.wantForwarded, tt.wantRejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-final/internal/cache"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// maxIndexScan ограничивает число просматриваемых записей индекса аномалий за запрос
+const maxIndexScan = 10000
+
+// anomalyStore хранилище аномалий и их разметки
+type anomalyStore interface {
+	GetAnomaly(ctx context.Context, key string) (string, error)
+	GetAnomalies(ctx context.Context, keys []string) (map[string]string, error)
+	ListAnomalyKeys(ctx context.Context, offset, limit int) ([]string, error)
+	SetAnomalyStatus(ctx context.Context, key string, data interface{}) error
+	GetAnomalyStatuses(ctx context.Context, keys []string) (map[string]string, error)
+	ScanAnomalyStatuses(ctx context.Context, fn func(key, data string) error) error
+}
+
+// UpdateAnomalyStatus обрабатывает POST /anomalies/status
+func (h *Handler) UpdateAnomalyStatus(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/anomalies/status").Observe(duration)
+	}()
+
+	if r.Method != http.MethodPost {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var update models.AnomalyStatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "400").Inc()
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Валидация
+	if !strings.HasPrefix(update.Key, "anomaly:") {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "400").Inc()
+		http.Error(w, "key must be an anomaly key", http.StatusBadRequest)
+		return
+	}
+	if !isAnomalyStatus(update.Status) {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "400").Inc()
+		http.Error(w, "status must be one of acknowledged, false_positive, confirmed", http.StatusBadRequest)
+		return
+	}
+	if update.Author == "" {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "400").Inc()
+		http.Error(w, "author is required", http.StatusBadRequest)
+		return
+	}
+
+	anomaly, err := h.anomalies.GetAnomaly(r.Context(), update.Key)
+	if errors.Is(err, cache.ErrNotFound) {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "404").Inc()
+		http.Error(w, "Anomaly not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		status := storeErrorStatus(err)
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", strconv.Itoa(status)).Inc()
+		http.Error(w, "Failed to retrieve anomaly", status)
+		return
+	}
+
+	label := models.AnomalyLabel{
+		Key:       update.Key,
+		Status:    update.Status,
+		Note:      update.Note,
+		Author:    update.Author,
+		UpdatedAt: time.Now(),
+		Anomaly:   json.RawMessage(anomaly),
+	}
+	if err := h.anomalies.SetAnomalyStatus(r.Context(), update.Key, label); err != nil {
+		status := storeErrorStatus(err)
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", strconv.Itoa(status)).Inc()
+		http.Error(w, "Failed to update anomaly status", status)
+		return
+	}
+
+	metrics.AnomalyLabels.WithLabelValues(update.Status).Inc()
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/status", "200").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(label)
+}
+
+// UnacknowledgedAnomalies обрабатывает GET /anomalies/unacknowledged
+func (h *Handler) UnacknowledgedAnomalies(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/anomalies/unacknowledged").Observe(duration)
+	}()
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/unacknowledged", "400").Inc()
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	type anomalyItem struct {
+		Key     string          `json:"key"`
+		Anomaly json.RawMessage `json:"anomaly"`
+	}
+	items := make([]anomalyItem, 0, limit)
+
+	// Идем по общему индексу от новых к старым и отбрасываем подтвержденные аномалии.
+	// Аномалии с другой разметкой (false_positive, confirmed) еще не подтверждены.
+	const pageSize = 200
+	for offset := 0; offset < maxIndexScan && len(items) < limit; offset += pageSize {
+		keys, err := h.anomalies.ListAnomalyKeys(r.Context(), offset, pageSize)
+		if err == nil && len(keys) == 0 {
+			break
+		}
+
+		var statuses, anomalies map[string]string
+		if err == nil {
+			statuses, err = h.anomalies.GetAnomalyStatuses(r.Context(), keys)
+		}
+		if err == nil {
+			anomalies, err = h.anomalies.GetAnomalies(r.Context(), keys)
+		}
+		if err != nil {
+			status := storeErrorStatus(err)
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/unacknowledged", strconv.Itoa(status)).Inc()
+			http.Error(w, "Failed to list anomalies", status)
+			return
+		}
+
+		for _, key := range keys {
+			data, exists := anomalies[key]
+			if !exists || acknowledged(statuses[key]) {
+				continue
+			}
+			items = append(items, anomalyItem{Key: key, Anomaly: json.RawMessage(data)})
+			if len(items) == limit {
+				break
+			}
+		}
+
+		if len(keys) < pageSize {
+			break
+		}
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/unacknowledged", "200").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(items),
+		"anomalies": items,
+	})
+}
+
+// ExportAnomalies обрабатывает GET /anomalies/export.
+// Возвращает размеченные аномалии в формате NDJSON, параметр status фильтрует по статусам.
+func (h *Handler) ExportAnomalies(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/anomalies/export").Observe(duration)
+	}()
+
+	filter := make(map[string]bool)
+	if v := r.URL.Query().Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			if !isAnomalyStatus(status) {
+				metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/export", "400").Inc()
+				http.Error(w, "unknown status "+status, http.StatusBadRequest)
+				return
+			}
+			filter[status] = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	err := h.anomalies.ScanAnomalyStatuses(r.Context(), func(key, data string) error {
+		var label models.AnomalyLabel
+		if err := json.Unmarshal([]byte(data), &label); err != nil {
+			return nil
+		}
+		if len(filter) > 0 && !filter[label.Status] {
+			return nil
+		}
+		written++
+		return encoder.Encode(label)
+	})
+	if err != nil {
+		// Если часть ответа уже отправлена, статус изменить нельзя
+		if written == 0 {
+			status := storeErrorStatus(err)
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/export", strconv.Itoa(status)).Inc()
+			http.Error(w, "Failed to export anomalies", status)
+			return
+		}
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/export", "500").Inc()
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/anomalies/export", "200").Inc()
+}
+
+// acknowledged проверяет, что разметка аномалии подтверждает ее
+func acknowledged(data string) bool {
+	if data == "" {
+		return false
+	}
+	var label models.AnomalyLabel
+	if err := json.Unmarshal([]byte(data), &label); err != nil {
+		return false
+	}
+	return label.Status == models.AnomalyAcknowledged
+}
+
+// isAnomalyStatus проверяет допустимость статуса разметки
+func isAnomalyStatus(status string) bool {
+	switch status {
+	case models.AnomalyAcknowledged, models.AnomalyFalsePositive, models.AnomalyConfirmed:
+		return true
+	default:
+		return false
+	}
+}
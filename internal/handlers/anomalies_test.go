@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"highload-final/internal/cache"
+	"highload-final/internal/models"
+)
+
+// fakeAnomalyStore хранилище аномалий в памяти
+type fakeAnomalyStore struct {
+	anomalies map[string]string
+	// index ключи аномалий от новых к старым
+	index    []string
+	statuses map[string]string
+	err      error
+}
+
+func newFakeAnomalyStore() *fakeAnomalyStore {
+	return &fakeAnomalyStore{anomalies: make(map[string]string), statuses: make(map[string]string)}
+}
+
+// add сохраняет аномалию как самую новую
+func (s *fakeAnomalyStore) add(key, data string) {
+	s.anomalies[key] = data
+	s.index = append([]string{key}, s.index...)
+}
+
+// label размечает аномалию
+func (s *fakeAnomalyStore) label(key, status string) {
+	data, _ := json.Marshal(models.AnomalyLabel{Key: key, Status: status, Author: "test"})
+	s.statuses[key] = string(data)
+}
+
+func (s *fakeAnomalyStore) GetAnomaly(_ context.Context, key string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	data, ok := s.anomalies[key]
+	if !ok {
+		return "", cache.ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *fakeAnomalyStore) GetAnomalies(_ context.Context, keys []string) (map[string]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := make(map[string]string)
+	for _, key := range keys {
+		if data, ok := s.anomalies[key]; ok {
+			result[key] = data
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeAnomalyStore) ListAnomalyKeys(_ context.Context, offset, limit int) ([]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if offset >= len(s.index) {
+		return nil, nil
+	}
+	return s.index[offset:min(offset+limit, len(s.index))], nil
+}
+
+func (s *fakeAnomalyStore) SetAnomalyStatus(_ context.Context, key string, data interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+	encoded, _ := json.Marshal(data)
+	s.statuses[key] = string(encoded)
+	return nil
+}
+
+func (s *fakeAnomalyStore) GetAnomalyStatuses(_ context.Context, keys []string) (map[string]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := make(map[string]string)
+	for _, key := range keys {
+		if data, ok := s.statuses[key]; ok {
+			result[key] = data
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeAnomalyStore) ScanAnomalyStatuses(_ context.Context, fn func(key, data string) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	keys := make([]string, 0, len(s.statuses))
+	for key := range s.statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, s.statuses[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestUpdateAnomalyStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		storeErr   error
+		wantStatus int
+	}{
+		{"acknowledge", http.MethodPost, `{"key":"anomaly:{d1}:1:CPU_SPIKE","status":"acknowledged","author":"ops","note":"known"}`, nil, http.StatusOK},
+		{"method not allowed", http.MethodGet, "", nil, http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPost, `{`, nil, http.StatusBadRequest},
+		{"not an anomaly key", http.MethodPost, `{"key":"metric:d1:1","status":"acknowledged","author":"ops"}`, nil, http.StatusBadRequest},
+		{"unknown status", http.MethodPost, `{"key":"anomaly:{d1}:1:CPU_SPIKE","status":"ignored","author":"ops"}`, nil, http.StatusBadRequest},
+		{"missing author", http.MethodPost, `{"key":"anomaly:{d1}:1:CPU_SPIKE","status":"acknowledged"}`, nil, http.StatusBadRequest},
+		{"anomaly not found", http.MethodPost, `{"key":"anomaly:{d1}:2:CPU_SPIKE","status":"confirmed","author":"ops"}`, nil, http.StatusNotFound},
+		{"storage unavailable", http.MethodPost, `{"key":"anomaly:{d1}:1:CPU_SPIKE","status":"confirmed","author":"ops"}`, cache.ErrUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeAnomalyStore()
+			store.add("anomaly:{d1}:1:CPU_SPIKE", `{"device_id":"d1"}`)
+			store.err = tt.storeErr
+			h := &Handler{anomalies: store}
+
+			w := httptest.NewRecorder()
+			h.UpdateAnomalyStatus(w, httptest.NewRequest(tt.method, "/anomalies/status", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if len(store.statuses) != 0 {
+					t.Errorf("status saved for a failed request: %v", store.statuses)
+				}
+				return
+			}
+
+			var label models.AnomalyLabel
+			if err := json.Unmarshal([]byte(store.statuses["anomaly:{d1}:1:CPU_SPIKE"]), &label); err != nil {
+				t.Fatal(err)
+			}
+			if label.Status != models.AnomalyAcknowledged || label.Author != "ops" || label.Note != "known" || label.UpdatedAt.IsZero() {
+				t.Errorf("label = %+v", label)
+			}
+			if string(label.Anomaly) != `{"device_id":"d1"}` {
+				t.Errorf("label anomaly = %s, want the stored anomaly", label.Anomaly)
+			}
+		})
+	}
+}
+
+func TestUnacknowledgedAnomalies(t *testing.T) {
+	store := newFakeAnomalyStore()
+	for _, key := range []string{"a1", "a2", "a3", "a4", "a5", "a6"} {
+		store.add("anomaly:"+key, `{"id":"`+key+`"}`)
+	}
+	store.label("anomaly:a6", models.AnomalyAcknowledged)
+	store.label("anomaly:a5", models.AnomalyFalsePositive)
+	store.label("anomaly:a4", models.AnomalyConfirmed)
+	// Аномалия a3 истекла, в индексе остался только ключ
+	delete(store.anomalies, "anomaly:a3")
+
+	tests := []struct {
+		name       string
+		query      string
+		storeErr   error
+		wantStatus int
+		want       []string
+	}{
+		{"only acknowledged are excluded", "", nil, http.StatusOK, []string{"anomaly:a5", "anomaly:a4", "anomaly:a2", "anomaly:a1"}},
+		{"limit", "?limit=2", nil, http.StatusOK, []string{"anomaly:a5", "anomaly:a4"}},
+		{"invalid limit", "?limit=0", nil, http.StatusBadRequest, nil},
+		{"limit too large", "?limit=1001", nil, http.StatusBadRequest, nil},
+		{"storage unavailable", "", cache.ErrUnavailable, http.StatusServiceUnavailable, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.err = tt.storeErr
+			h := &Handler{anomalies: store}
+
+			w := httptest.NewRecorder()
+			h.UnacknowledgedAnomalies(w, httptest.NewRequest(http.MethodGet, "/anomalies/unacknowledged"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Count     int `json:"count"`
+				Anomalies []struct {
+					Key     string          `json:"key"`
+					Anomaly json.RawMessage `json:"anomaly"`
+				} `json:"anomalies"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, item := range resp.Anomalies {
+				got = append(got, item.Key)
+				if want := `{"id":"` + strings.TrimPrefix(item.Key, "anomaly:") + `"}`; string(item.Anomaly) != want {
+					t.Errorf("anomaly of %s = %s, want %s", item.Key, item.Anomaly, want)
+				}
+			}
+			if !slices.Equal(got, tt.want) || resp.Count != len(tt.want) {
+				t.Errorf("anomalies = %v (count %d), want %v", got, resp.Count, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnacknowledgedAnomaliesPaging(t *testing.T) {
+	// Подтвержденные аномалии занимают целые страницы индекса
+	store := newFakeAnomalyStore()
+	store.add("anomaly:old", `{}`)
+	for i := 0; i < 450; i++ {
+		key := "anomaly:ack-" + strconv.Itoa(i)
+		store.add(key, `{}`)
+		store.label(key, models.AnomalyAcknowledged)
+	}
+
+	w := httptest.NewRecorder()
+	(&Handler{anomalies: store}).UnacknowledgedAnomalies(w, httptest.NewRequest(http.MethodGet, "/anomalies/unacknowledged", nil))
+
+	if !strings.Contains(w.Body.String(), `"key":"anomaly:old"`) || !strings.Contains(w.Body.String(), `"count":1`) {
+		t.Errorf("response = %s, want only anomaly:old", w.Body)
+	}
+}
+
+func TestExportAnomalies(t *testing.T) {
+	store := newFakeAnomalyStore()
+	store.label("anomaly:a1", models.AnomalyAcknowledged)
+	store.label("anomaly:a2", models.AnomalyFalsePositive)
+	store.label("anomaly:a3", models.AnomalyConfirmed)
+	// Поврежденная разметка пропускается
+	store.statuses["anomaly:a4"] = "{"
+
+	tests := []struct {
+		name       string
+		query      string
+		storeErr   error
+		wantStatus int
+		want       []string
+	}{
+		{"all labels", "", nil, http.StatusOK, []string{"anomaly:a1", "anomaly:a2", "anomaly:a3"}},
+		{"status filter", "?status=false_positive,confirmed", nil, http.StatusOK, []string{"anomaly:a2", "anomaly:a3"}},
+		{"unknown status", "?status=acknowledged,ignored", nil, http.StatusBadRequest, nil},
+		{"storage unavailable", "", cache.ErrUnavailable, http.StatusServiceUnavailable, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.err = tt.storeErr
+			h := &Handler{anomalies: store}
+
+			w := httptest.NewRecorder()
+			h.ExportAnomalies(w, httptest.NewRequest(http.MethodGet, "/anomalies/export"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+			}
+
+			var got []string
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var label models.AnomalyLabel
+				if err := json.Unmarshal(scanner.Bytes(), &label); err != nil {
+					t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+				}
+				got = append(got, label.Key)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
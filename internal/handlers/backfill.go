@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-final/internal/backfill"
+	"highload-final/internal/ingest"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// SetBackfill включает загрузку истории через /backfill
+func (h *Handler) SetBackfill(runner *backfill.Runner) {
+	h.backfill = runner
+}
+
+// Backfill обрабатывает /backfill: POST запускает загрузку истории,
+// GET возвращает прогресс задания по id или список заданий
+func (h *Handler) Backfill(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/backfill").Observe(duration)
+	}()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getBackfill(w, r)
+	case http.MethodPost:
+		h.startBackfill(w, r)
+	default:
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getBackfill возвращает задание или список заданий
+func (h *Handler) getBackfill(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		jobs := h.backfill.List()
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "200").Inc()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": len(jobs),
+			"jobs":  jobs,
+		})
+		return
+	}
+
+	job, ok := h.backfill.Get(id)
+	if !ok {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "404").Inc()
+		http.Error(w, "Backfill job not found", http.StatusNotFound)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "200").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// startBackfill читает историю (JSON массив, NDJSON или CSV), проверяет записи
+// и передает их на анализ пачками по мере чтения. Ограничение возраста метрик
+// к истории не применяется.
+func (h *Handler) startBackfill(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(bulkTimeout))
+
+	body, err := h.batchBody(w, r)
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "400").Inc()
+		http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	// Лимит заданий проверяется до чтения тела
+	upload, err := h.backfill.Start()
+	if err != nil {
+		h.backfillError(w, r, err)
+		return
+	}
+
+	rules := h.ingest.Rules()
+	rules.MaxAge = 0
+
+	// Чтение прекращается, если задание перестало принимать метрики
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var (
+		addErr error
+		errs   = []models.BatchItemError{}
+	)
+	index := 0
+	collect := func(line int, metric models.Metric, parseErr error) {
+		defer func() { index++ }()
+		if addErr != nil {
+			return
+		}
+
+		err := parseErr
+		if err == nil {
+			err = rules.Validate(&metric)
+		}
+		if err != nil {
+			metrics.MetricsRejected.WithLabelValues("backfill", ingest.Reason(err)).Inc()
+			upload.Reject()
+			if len(errs) < maxReportedErrors {
+				errs = append(errs, models.BatchItemError{
+					Index:    index,
+					Line:     line,
+					DeviceID: metric.DeviceID,
+					Error:    err.Error(),
+				})
+			}
+			return
+		}
+		if addErr = upload.Add(metric); addErr != nil {
+			cancel()
+		}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/x-ndjson", "application/jsonl":
+		err = ingest.ReadNDJSON(ctx, body, collect)
+	case "text/csv":
+		err = ingest.ReadCSV(ctx, body, collect)
+	default:
+		err = readJSONArray(body, collect)
+	}
+	if addErr != nil {
+		err = addErr
+	}
+	if err != nil {
+		// Если часть пачек уже проанализирована, задание остается со статусом failed
+		upload.Abort(err)
+		h.backfillError(w, r, err)
+		return
+	}
+	if upload.Accepted() == 0 {
+		upload.Abort(errNoBackfillMetrics)
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "400").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  errNoBackfillMetrics.Error(),
+			"errors": errs,
+		})
+		return
+	}
+
+	job, err := upload.Finish()
+	if err != nil {
+		h.backfillError(w, r, err)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", "202").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/backfill?id="+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job":    job,
+		"errors": errs,
+	})
+}
+
+// errNoBackfillMetrics в загрузке нет ни одной корректной метрики
+var errNoBackfillMetrics = errors.New("no valid metrics to backfill")
+
+// backfillError отвечает ошибкой запуска или чтения загрузки
+func (h *Handler) backfillError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, backfill.ErrTooManyJobs):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, backfill.ErrStopped):
+		status = http.StatusServiceUnavailable
+	case isBodyTooLarge(err):
+		status = http.StatusRequestEntityTooLarge
+	}
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/backfill", strconv.Itoa(status)).Inc()
+	http.Error(w, err.Error(), status)
+}
+
+// readJSONArray читает JSON массив метрик поэлементно, передавая в fn каждый элемент
+func readJSONArray(body io.Reader, fn ingest.RecordFunc) error {
+	decoder := json.NewDecoder(body)
+	invalid := func(err error) error {
+		if isBodyTooLarge(err) {
+			return err
+		}
+		return errors.New("invalid JSON")
+	}
+
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+		return invalid(err)
+	}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return invalid(err)
+		}
+		var metric models.Metric
+		err := json.Unmarshal(raw, &metric)
+		fn(0, metric, err)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return invalid(err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/backfill"
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// newBackfillHandler обработчик загрузки истории с отдельным исполнителем
+func newBackfillHandler(t *testing.T, maxBody int64) (*Handler, *backfill.Runner) {
+	runner := backfill.NewRunner(backfill.Config{
+		WindowSize:       10,
+		AnomalyThreshold: 3,
+		Detector:         analytics.DetectorZScore,
+		MaxRunning:       1,
+	}, nil)
+	t.Cleanup(runner.Stop)
+	h := &Handler{
+		ingest:       ingest.NewPipeline(nil, nil),
+		backfill:     runner,
+		maxBatchBody: maxBody,
+	}
+	return h, runner
+}
+
+// waitBackfill ждет завершения задания
+func waitBackfill(t *testing.T, runner *backfill.Runner, id string) backfill.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := runner.Get(id); ok && job.Status != backfill.StatusRunning {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("backfill job %s did not finish", id)
+	return backfill.Job{}
+}
+
+func TestStartBackfill(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		wantTotal    int
+		wantRejected int
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body: `{"device_id":"d1","timestamp":"2024-01-01T00:00:00Z","cpu":10,"rps":100}` + "\n" +
+				`{"device_id":"d1","timestamp":"2024-01-01T00:00:01Z","cpu":200,"rps":100}` + "\n" +
+				`not json` + "\n" +
+				`{"device_id":"d1","timestamp":"2024-01-01T00:00:02Z","cpu":11,"rps":100}` + "\n",
+			wantTotal:    4,
+			wantRejected: 2,
+		},
+		{
+			name:        "json array",
+			contentType: "application/json",
+			body: `[{"device_id":"d1","timestamp":"2024-01-01T00:00:00Z","cpu":10,"rps":100},` +
+				`{"device_id":"bad id","timestamp":"2024-01-01T00:00:01Z","cpu":10,"rps":100}]`,
+			wantTotal:    2,
+			wantRejected: 1,
+		},
+		{
+			name:         "csv",
+			contentType:  "text/csv",
+			body:         "device_id,timestamp,cpu,rps\nd1,1704067200,10,100\nd1,1704067201,11,100\n",
+			wantTotal:    2,
+			wantRejected: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, runner := newBackfillHandler(t, 1<<20)
+
+			r := httptest.NewRequest(http.MethodPost, "/backfill", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			h.Backfill(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Job    backfill.Job            `json:"job"`
+				Errors []models.BatchItemError `json:"errors"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Job.Total != tt.wantTotal || resp.Job.Rejected != tt.wantRejected || len(resp.Errors) != tt.wantRejected {
+				t.Errorf("response = %+v, want %d total and %d rejected", resp, tt.wantTotal, tt.wantRejected)
+			}
+			if location := w.Header().Get("Location"); location != "/backfill?id="+resp.Job.ID {
+				t.Errorf("Location = %q", location)
+			}
+
+			job := waitBackfill(t, runner, resp.Job.ID)
+			if job.Status != backfill.StatusCompleted || job.Processed != tt.wantTotal-tt.wantRejected {
+				t.Errorf("job = %+v", job)
+			}
+		})
+	}
+}
+
+func TestStartBackfillErrors(t *testing.T) {
+	valid := `{"device_id":"d1","timestamp":"2024-01-01T00:00:00Z","cpu":10,"rps":100}` + "\n"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBody     int64
+		busy        bool
+		wantStatus  int
+		wantJobs    int
+	}{
+		{"invalid json", "application/json", `[{"device_id":`, 1 << 20, false, http.StatusBadRequest, 0},
+		{"not an array", "application/json", `{"device_id":"d1"}`, 1 << 20, false, http.StatusBadRequest, 0},
+		{"no valid metrics", "application/x-ndjson", `{"device_id":"d1","cpu":500}` + "\n", 1 << 20, false, http.StatusBadRequest, 0},
+		{"body too large", "application/x-ndjson", strings.Repeat(valid, 10), 100, false, http.StatusRequestEntityTooLarge, 0},
+		{"too many jobs", "application/x-ndjson", valid, 1 << 20, true, http.StatusTooManyRequests, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, runner := newBackfillHandler(t, tt.maxBody)
+			if tt.busy {
+				upload, err := runner.Start()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer upload.Abort(nil)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/backfill", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			h.Backfill(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			// Загрузка без принятых метрик не оставляет задания
+			if jobs := runner.List(); len(jobs) != tt.wantJobs {
+				t.Errorf("jobs = %+v, want %d", jobs, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func TestGetBackfill(t *testing.T) {
+	h, runner := newBackfillHandler(t, 1<<20)
+	upload, err := runner.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.Add(models.Metric{DeviceID: "d1", Timestamp: time.Now(), CPU: 10})
+	job, _ := upload.Finish()
+	waitBackfill(t, runner, job.ID)
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+	}{
+		{"list", http.MethodGet, "", http.StatusOK},
+		{"by id", http.MethodGet, "?id=" + job.ID, http.StatusOK},
+		{"unknown id", http.MethodGet, "?id=missing", http.StatusNotFound},
+		{"method not allowed", http.MethodDelete, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.Backfill(w, httptest.NewRequest(tt.method, "/backfill"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), `"id":"`+job.ID+`"`) {
+				t.Errorf("response = %s, want job %s", w.Body, job.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-final/internal/cluster"
+	"highload-final/internal/ingest"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+const (
+	// bulkTimeout время на чтение большой загрузки вместо общего ReadTimeout сервера
+	bulkTimeout = 10 * time.Minute
+	// maxReportedErrors сколько ошибок записей возвращается в ответе
+	maxReportedErrors = 100
+	// bulkForwardBatch размер пачки, пересылаемой владельцу устройств при потоковой загрузке
+	bulkForwardBatch = 500
+	// batchQueueWait сколько разобранная пачка (remote_write, OTLP) ждет места в очереди анализа
+	batchQueueWait = 5 * time.Second
+)
+
+// errBodyTooLarge тело запроса (после распаковки) превышает ограничение
+var errBodyTooLarge = errors.New("request body too large")
+
+// SetMaxBatchBody задает ограничение размера тела /metrics/batch
+func (h *Handler) SetMaxBatchBody(n int64) {
+	h.maxBatchBody = n
+}
+
+// batchBody возвращает тело запроса с ограничением размера и распаковкой gzip
+func (h *Handler) batchBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	body := http.MaxBytesReader(w, r.Body, h.maxBatchBody)
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	// Ограничение распакованного размера защищает от gzip-бомб
+	return &limitedReadCloser{r: gz, n: h.maxBatchBody}, nil
+}
+
+// limitedReadCloser возвращает errBodyTooLarge при чтении больше n байт
+type limitedReadCloser struct {
+	r *gzip.Reader
+	n int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.r.Close()
+}
+
+// isBodyTooLarge проверяет, превышено ли ограничение размера тела
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr) || errors.Is(err, errBodyTooLarge)
+}
+
+// remoteItem запись чужого устройства, ожидающая пересылки владельцу
+type remoteItem struct {
+	index  int
+	line   int
+	metric models.Metric
+}
+
+// bulkIngester принимает записи потоковой загрузки по одной.
+// При заполненной очереди анализа ожидает места, притормаживая чтение тела.
+type bulkIngester struct {
+	h      *Handler
+	r      *http.Request
+	source string
+	resp   models.BatchResponse
+	remote map[cluster.Member][]remoteItem
+	// idempotencyKey ключ запроса; записи без message_id получают "<ключ>#<индекс>"
+	idempotencyKey string
+}
+
+func newBulkIngester(h *Handler, r *http.Request, source string) *bulkIngester {
+	return &bulkIngester{
+		h:      h,
+		r:      r,
+		source: source,
+		resp:   models.BatchResponse{Status: "accepted"},
+		remote: make(map[cluster.Member][]remoteItem),
+
+		idempotencyKey: r.Header.Get("Idempotency-Key"),
+	}
+}
+
+// add принимает одну запись; parseErr - ошибка разбора самой записи
+func (b *bulkIngester) add(line int, metric models.Metric, parseErr error) {
+	index := b.resp.Total
+	b.resp.Total++
+
+	if parseErr != nil {
+		b.reject(index, line, "", "invalid", parseErr)
+		return
+	}
+	if metric.MessageID == "" && b.idempotencyKey != "" {
+		metric.MessageID = b.idempotencyKey + "#" + strconv.Itoa(index)
+	}
+	if err := b.h.ingest.Validate(&metric); err != nil {
+		b.reject(index, line, metric.DeviceID, ingest.Reason(err), err)
+		return
+	}
+
+	if owner, isRemote := b.h.remoteOwner(b.r, metric.DeviceID); isRemote {
+		b.remote[owner] = append(b.remote[owner], remoteItem{index: index, line: line, metric: metric})
+		if len(b.remote[owner]) >= bulkForwardBatch {
+			b.forward(owner)
+		}
+		return
+	}
+
+	err := b.h.ingest.IngestWait(b.r.Context(), metric)
+	if errors.Is(err, ingest.ErrDuplicate) {
+		metrics.MetricsDuplicates.WithLabelValues(b.source).Inc()
+		b.resp.Duplicates++
+		return
+	}
+	if err != nil {
+		b.reject(index, line, metric.DeviceID, ingest.Reason(err), err)
+		return
+	}
+	b.resp.Accepted++
+}
+
+// reject учитывает отклоненную запись
+func (b *bulkIngester) reject(index, line int, deviceID, reason string, err error) {
+	metrics.MetricsRejected.WithLabelValues(b.source, reason).Inc()
+	b.resp.Rejected++
+	if len(b.resp.Errors) >= maxReportedErrors {
+		b.resp.ErrorsTruncated = true
+		return
+	}
+	b.resp.Errors = append(b.resp.Errors, models.BatchItemError{
+		Index:    index,
+		Line:     line,
+		DeviceID: deviceID,
+		Error:    err.Error(),
+	})
+}
+
+// forward пересылает накопленные метрики владельцу.
+// При ошибке пересылки каждая запись отклоняется со своей ошибкой.
+func (b *bulkIngester) forward(owner cluster.Member) {
+	items := b.remote[owner]
+	delete(b.remote, owner)
+
+	batch := make([]models.Metric, len(items))
+	for i, item := range items {
+		batch[i] = item.metric
+	}
+	if err := b.h.ingest.Forward(b.r.Context(), owner, batch); err != nil {
+		for _, item := range items {
+			b.reject(item.index, item.line, item.metric.DeviceID, "forward_failed", err)
+		}
+		return
+	}
+	b.resp.Forwarded += len(batch)
+	b.resp.Accepted += len(batch)
+}
+
+// finish пересылает остаток метрик чужих устройств и возвращает итог
+func (b *bulkIngester) finish() models.BatchResponse {
+	for owner := range b.remote {
+		b.forward(owner)
+	}
+	return b.resp
+}
+
+// ingestBatch принимает разобранную пачку тем же путем, что и потоковая загрузка:
+// проверка и дедупликация каждой записи, пересылка чужих устройств владельцам
+// и ожидание места в очереди анализа не дольше batchQueueWait.
+// busy означает, что ничего не принято из-за заполненной очереди и клиенту стоит повторить позже.
+func (h *Handler) ingestBatch(r *http.Request, source string, batch []models.Metric) (resp models.BatchResponse, busy bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), batchQueueWait)
+	defer cancel()
+
+	b := newBulkIngester(h, r.WithContext(ctx), source)
+	for _, metric := range batch {
+		b.add(0, metric, nil)
+	}
+	resp = b.finish()
+
+	busy = resp.Accepted+resp.Duplicates == 0 && resp.Rejected > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded)
+	return resp, busy
+}
+
+// itemError ошибка проверки записи пачки с причиной для metrics_rejected_total
+type itemError struct {
+	models.BatchItemError
+	reason string
+}
+
+// validateBatch проверяет все записи пачки, не передавая их на анализ
+func (h *Handler) validateBatch(batch []models.Metric) []itemError {
+	var errs []itemError
+	for i := range batch {
+		if err := h.ingest.Validate(&batch[i]); err != nil {
+			errs = append(errs, itemError{
+				BatchItemError: models.BatchItemError{
+					Index:    i,
+					DeviceID: batch[i].DeviceID,
+					Error:    err.Error(),
+				},
+				reason: ingest.Reason(err),
+			})
+		}
+	}
+	return errs
+}
+
+// rejectedBatch ответ на пачку, отклоненную целиком
+func rejectedBatch(total int, errs []itemError) models.BatchResponse {
+	resp := models.BatchResponse{
+		Status:   "rejected",
+		Total:    total,
+		Rejected: total,
+	}
+	for _, e := range errs {
+		if len(resp.Errors) >= maxReportedErrors {
+			resp.ErrorsTruncated = true
+			break
+		}
+		resp.Errors = append(resp.Errors, e.BatchItemError)
+	}
+	return resp
+}
+
+// readNDJSON читает записи NDJSON из тела запроса
+func (b *bulkIngester) readNDJSON(body io.Reader) error {
+	return ingest.ReadNDJSON(b.r.Context(), body, b.add)
+}
+
+// readCSV читает записи CSV из тела запроса
+func (b *bulkIngester) readCSV(body io.Reader) error {
+	return ingest.ReadCSV(b.r.Context(), body, b.add)
+}
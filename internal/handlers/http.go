@@ -2,29 +2,72 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
 	"time"
 
+	"highload-final/internal/alerting"
 	"highload-final/internal/analytics"
+	"highload-final/internal/backfill"
 	"highload-final/internal/cache"
+	"highload-final/internal/cluster"
+	"highload-final/internal/ingest"
 	"highload-final/internal/metrics"
 	"highload-final/internal/models"
+	"highload-final/internal/otlp"
+	"highload-final/internal/remotewrite"
+	"highload-final/internal/stream"
 )
 
 // Handler обработчик HTTP запросов
 type Handler struct {
 	analyzer *analytics.Analyzer
 	cache    *cache.RedisCache
+	ingest   *ingest.Pipeline
+	// anomalies хранилище аномалий и разметки, по умолчанию cache
+	anomalies anomalyStore
+	cluster   *cluster.Node
+	silencer  *alerting.Silencer
+	broker    *stream.Broker
+
+	remoteWrite *remotewrite.Mapper
+	otlp        *otlp.Mapper
+	backfill    *backfill.Runner
+
+	allowedOrigins []string
+	websockets     wsConns
+	maxBatchBody   int64
 }
 
 // NewHandler создает новый обработчик
-func NewHandler(analyzer *analytics.Analyzer, cache *cache.RedisCache) *Handler {
+func NewHandler(analyzer *analytics.Analyzer, cache *cache.RedisCache, pipeline *ingest.Pipeline) *Handler {
 	return &Handler{
-		analyzer: analyzer,
-		cache:    cache,
+		analyzer:  analyzer,
+		cache:     cache,
+		ingest:    pipeline,
+		anomalies: cache,
+
+		maxBatchBody: 256 << 20,
 	}
 }
 
+// SetCluster включает пересылку метрик владельцам устройств
+func (h *Handler) SetCluster(node *cluster.Node) {
+	h.cluster = node
+}
+
+// remoteOwner возвращает владельца устройства, если это другая реплика.
+// Запросы, уже пересланные другой репликой, всегда обрабатываются локально.
+func (h *Handler) remoteOwner(r *http.Request, deviceID string) (cluster.Member, bool) {
+	if h.cluster == nil || h.cluster.Forwarded(r) {
+		return cluster.Member{}, false
+	}
+	owner, local := h.cluster.Owner(deviceID)
+	return owner, !local
+}
+
 // SubmitMetric обрабатывает POST /metrics
 func (h *Handler) SubmitMetric(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
@@ -46,36 +89,60 @@ func (h *Handler) SubmitMetric(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Устанавливаем timestamp если не указан
-	if metric.Timestamp.IsZero() {
-		metric.Timestamp = time.Now()
+	if metric.MessageID == "" {
+		metric.MessageID = r.Header.Get("Idempotency-Key")
 	}
 
 	// Валидация
-	if metric.DeviceID == "" {
+	if err := h.ingest.Validate(&metric); err != nil {
+		metrics.MetricsRejected.WithLabelValues("http", ingest.Reason(err)).Inc()
 		metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "400").Inc()
-		http.Error(w, "device_id is required", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Сохраняем в Redis (асинхронно, не блокируем ответ)
-	go func() {
-		if err := h.cache.StoreMetric(metric.DeviceID, metric.Timestamp, metric); err == nil {
-			metrics.RedisOperations.WithLabelValues("store_metric", "success").Inc()
-		} else {
-			metrics.RedisOperations.WithLabelValues("store_metric", "error").Inc()
+	// Устройство принадлежит другой реплике - пересылаем
+	if owner, remote := h.remoteOwner(r, metric.DeviceID); remote {
+		body, _ := json.Marshal(metric)
+		if err := h.cluster.Forward(r.Context(), owner, "/metrics", body); err != nil {
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "502").Inc()
+			http.Error(w, "Failed to forward metric to owner", http.StatusBadGateway)
+			return
 		}
-	}()
 
-	// Отправляем на анализ
-	h.analyzer.AddMetric(analytics.MetricData{
-		DeviceID:  metric.DeviceID,
-		Timestamp: metric.Timestamp,
-		CPU:       metric.CPU,
-		RPS:       metric.RPS,
-	})
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "200").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":    "forwarded",
+			"device_id": metric.DeviceID,
+			"owner":     owner.ID,
+		})
+		return
+	}
+
+	// Сохраняем в Redis и отправляем на анализ
+	err := h.ingest.Ingest(r.Context(), metric)
+	if errors.Is(err, ingest.ErrDuplicate) {
+		// Повтор уже принятой метрики: клиенту ответ как на успешную отправку
+		metrics.MetricsDuplicates.WithLabelValues("http").Inc()
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "200").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":     "duplicate",
+			"device_id":  metric.DeviceID,
+			"message_id": metric.MessageID,
+		})
+		return
+	}
+	if err != nil {
+		metrics.MetricsRejected.WithLabelValues("http", ingest.Reason(err)).Inc()
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "503").Inc()
+		http.Error(w, "Analysis queue is full", http.StatusServiceUnavailable)
+		return
+	}
 
-	metrics.MetricsReceived.Inc()
 	metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics", "200").Inc()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -102,8 +169,19 @@ func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем последние аномалии из кэша
-	anomalyKeys, err := h.cache.GetRecentAnomalies(deviceID, 10)
+	anomalyKeys, err := h.cache.GetRecentAnomalies(r.Context(), deviceID, 10)
+	if r.Context().Err() != nil {
+		// Клиент закрыл соединение, отвечать некому
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/analytics", "499").Inc()
+		return
+	}
+	if errors.Is(err, cache.ErrUnavailable) {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/analytics", "503").Inc()
+		http.Error(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
+		metrics.RedisOperations.WithLabelValues("get_anomalies", "error").Inc()
 		metrics.RequestsTotal.WithLabelValues(r.Method, "/analytics", "500").Inc()
 		http.Error(w, "Failed to retrieve analytics", http.StatusInternalServerError)
 		return
@@ -120,24 +198,22 @@ func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HealthCheck обрабатывает GET /health
+// HealthCheck обрабатывает GET /health.
+// Без Redis сервис продолжает анализ в памяти, поэтому деградированный режим
+// не считается отказом и возвращает 200, чтобы поды не перезапускались.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	// Проверяем Redis
-	redisOK := h.cache.Ping() == nil
+	redisState := h.cache.State()
 
 	status := "healthy"
-	httpStatus := http.StatusOK
-
-	if !redisOK {
+	if !redisState.Connected {
 		status = "degraded"
-		httpStatus = http.StatusServiceUnavailable
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(httpStatus)
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    status,
-		"redis":     redisOK,
+		"redis":     redisState,
 		"timestamp": time.Now(),
 	})
 }
@@ -153,14 +229,22 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	analyzerStats := h.analyzer.GetStats()
 	redisStats := h.cache.GetStats()
 
-	metrics.RequestsTotal.WithLabelValues(r.Method, "/stats", "200").Inc()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"analyzer":  analyzerStats,
 		"redis":     redisStats,
 		"timestamp": time.Now(),
-	})
+	}
+	if h.cluster != nil {
+		response["cluster"] = map[string]interface{}{
+			"node_id": h.cluster.NodeID(),
+			"members": h.cluster.Members(),
+		}
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/stats", "200").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // BatchSubmitMetrics обрабатывает POST /metrics/batch
@@ -177,45 +261,129 @@ func (h *Handler) BatchSubmitMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var batchMetrics []models.Metric
-	if err := json.NewDecoder(r.Body).Decode(&batchMetrics); err != nil {
+	// Большие загрузки читаются дольше общего таймаута сервера
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(bulkTimeout))
+	rc.SetWriteDeadline(time.Now().Add(bulkTimeout))
+
+	body, err := h.batchBody(w, r)
+	if err != nil {
 		metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "400").Inc()
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		http.Error(w, "Invalid gzip body", http.StatusBadRequest)
 		return
 	}
+	defer body.Close()
+
+	// NDJSON и CSV разбираются потоково, по одной записи
+	var resp models.BatchResponse
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	atomic := r.URL.Query().Get("atomic") == "true"
+	switch contentType {
+	case "application/x-ndjson", "application/jsonl", "text/csv":
+		if atomic {
+			// Потоковые записи уходят на анализ до конца чтения тела
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "400").Inc()
+			http.Error(w, "atomic mode is supported only for JSON arrays", http.StatusBadRequest)
+			return
+		}
+		bulk := newBulkIngester(h, r, "http")
+		if contentType == "text/csv" {
+			err = bulk.readCSV(body)
+		} else {
+			err = bulk.readNDJSON(body)
+		}
+		resp = bulk.finish()
+
+	default:
+		var batchMetrics []models.Metric
+		if err := json.NewDecoder(body).Decode(&batchMetrics); err != nil {
+			if isBodyTooLarge(err) {
+				metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "413").Inc()
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "400").Inc()
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
 
-	accepted := 0
-	for _, metric := range batchMetrics {
-		if metric.DeviceID == "" {
-			continue
+		// В режиме atomic пачка принимается только целиком
+		if atomic {
+			if errs := h.validateBatch(batchMetrics); len(errs) > 0 {
+				for _, e := range errs {
+					metrics.MetricsRejected.WithLabelValues("http", e.reason).Inc()
+				}
+				resp = rejectedBatch(len(batchMetrics), errs)
+				metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "422").Inc()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
 		}
 
-		if metric.Timestamp.IsZero() {
-			metric.Timestamp = time.Now()
+		bulk := newBulkIngester(h, r, "http")
+		for _, metric := range batchMetrics {
+			bulk.add(0, metric, nil)
 		}
+		resp = bulk.finish()
+	}
 
-		// Асинхронное сохранение в Redis
-		go h.cache.StoreMetric(metric.DeviceID, metric.Timestamp, metric)
+	status := http.StatusOK
+	if err != nil {
+		// Записи, принятые до ошибки, остаются в анализе
+		resp.Status = "aborted"
+		resp.Error = err.Error()
+		status = http.StatusBadRequest
+		if isBodyTooLarge(err) {
+			resp.Error = errBodyTooLarge.Error()
+			status = http.StatusRequestEntityTooLarge
+		}
+	}
 
-		// Отправляем на анализ
-		h.analyzer.AddMetric(analytics.MetricData{
-			DeviceID:  metric.DeviceID,
-			Timestamp: metric.Timestamp,
-			CPU:       metric.CPU,
-			RPS:       metric.RPS,
-		})
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", strconv.Itoa(status)).Inc()
 
-		metrics.MetricsReceived.Inc()
-		accepted++
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ClusterHandoff обрабатывает POST /cluster/handoff
+func (h *Handler) ClusterHandoff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		metrics.RequestsTotal.WithLabelValues(r.Method, cluster.HandoffPath, "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Окна принимаются только от реплик с общим секретом
+	if h.cluster == nil || !h.cluster.Authenticated(r) {
+		metrics.RequestsTotal.WithLabelValues(r.Method, cluster.HandoffPath, "401").Inc()
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var snapshots []analytics.WindowSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshots); err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, cluster.HandoffPath, "400").Inc()
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.DeviceID == "" {
+			continue
+		}
+		h.analyzer.ImportWindow(snapshot)
 	}
 
-	metrics.RequestsTotal.WithLabelValues(r.Method, "/metrics/batch", "200").Inc()
+	metrics.ClusterHandoffWindows.WithLabelValues("in", "success").Add(float64(len(snapshots)))
+	metrics.RequestsTotal.WithLabelValues(r.Method, cluster.HandoffPath, "200").Inc()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":   "accepted",
-		"total":    len(batchMetrics),
-		"accepted": accepted,
+		"imported": len(snapshots),
 	})
 }
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/otlp"
+)
+
+// otlpMaxBody ограничение тела запроса OTLP после распаковки
+const otlpMaxBody = 16 << 20
+
+// SetOTLP включает прием метрик OTLP/HTTP
+func (h *Handler) SetOTLP(mapper *otlp.Mapper) {
+	h.otlp = mapper
+}
+
+// OTLPMetrics обрабатывает POST /v1/metrics (OTLP/HTTP, protobuf и JSON)
+func (h *Handler) OTLPMetrics(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/v1/metrics").Observe(duration)
+	}()
+
+	if r.Method != http.MethodPost {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var (
+		unmarshal func([]byte, proto.Message) error
+		marshal   func(proto.Message) ([]byte, error)
+	)
+	switch contentType {
+	case "application/x-protobuf":
+		unmarshal, marshal = proto.Unmarshal, proto.Marshal
+	case "application/json":
+		unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal
+		marshal = protojson.Marshal
+	default:
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "415").Inc()
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "400").Inc()
+			http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, otlpMaxBody+1))
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "400").Inc()
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(data) > otlpMaxBody {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "413").Inc()
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if err := unmarshal(data, &req); err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "400").Inc()
+		http.Error(w, "Invalid OTLP payload", http.StatusBadRequest)
+		return
+	}
+
+	batch, unmapped := h.otlp.Map(&req)
+	result, busy := h.ingestBatch(r, "otlp", batch)
+
+	// Ответ 503 клиенты OTLP повторяют позже
+	if busy {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "503").Inc()
+		http.Error(w, "Analysis queue is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	var resp colmetricspb.ExportMetricsServiceResponse
+	if rejected := unmapped + int64(result.Rejected); rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "some data points have no device attribute, an unsupported type or failed validation",
+		}
+	}
+	out, err := marshal(&resp)
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "500").Inc()
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/v1/metrics", "200").Inc()
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/remotewrite"
+)
+
+const (
+	// remoteWriteMaxBody ограничение сжатого тела запроса remote_write
+	remoteWriteMaxBody = 10 << 20
+	// remoteWriteMaxDecoded ограничение тела после распаковки
+	remoteWriteMaxDecoded = 64 << 20
+)
+
+// SetRemoteWrite включает прием Prometheus remote_write
+func (h *Handler) SetRemoteWrite(mapper *remotewrite.Mapper) {
+	h.remoteWrite = mapper
+}
+
+// RemoteWrite обрабатывает POST /api/v1/write.
+// Принимает snappy-сжатый prometheus.WriteRequest и передает сопоставленные ряды в анализ.
+func (h *Handler) RemoteWrite(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/api/v1/write").Observe(duration)
+	}()
+
+	if r.Method != http.MethodPost {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, remoteWriteMaxBody))
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "400").Inc()
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	// 4xx ответы Prometheus не повторяет, поэтому некорректные данные отклоняем именно так
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil || size > remoteWriteMaxDecoded {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "400").Inc()
+		http.Error(w, "Invalid snappy payload", http.StatusBadRequest)
+		return
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "400").Inc()
+		http.Error(w, "Invalid snappy payload", http.StatusBadRequest)
+		return
+	}
+
+	series, err := remotewrite.Decode(data)
+	if err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "400").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch, _ := h.remoteWrite.Map(series)
+	// Если не принято ничего из-за перегрузки, просим Prometheus повторить позже
+	if _, busy := h.ingestBatch(r, "remote_write", batch); busy {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "503").Inc()
+		http.Error(w, "Analysis queue is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/api/v1/write", "204").Inc()
+	w.WriteHeader(http.StatusNoContent)
+}
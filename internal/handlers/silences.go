@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-final/internal/alerting"
+	"highload-final/internal/cache"
+	"highload-final/internal/metrics"
+)
+
+// SetSilencer подключает управление silences
+func (h *Handler) SetSilencer(silencer *alerting.Silencer) {
+	h.silencer = silencer
+}
+
+// Silences обрабатывает GET/POST/DELETE /silences
+func (h *Handler) Silences(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		metrics.RequestDuration.WithLabelValues(r.Method, "/silences").Observe(duration)
+	}()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listSilences(w, r)
+	case http.MethodPost:
+		h.createSilence(w, r)
+	case http.MethodDelete:
+		h.deleteSilence(w, r)
+	default:
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listSilences возвращает действующие и запланированные silences
+func (h *Handler) listSilences(w http.ResponseWriter, r *http.Request) {
+	silences := h.silencer.List()
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "200").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":    len(silences),
+		"silences": silences,
+	})
+}
+
+// createSilence создает silence
+func (h *Handler) createSilence(w http.ResponseWriter, r *http.Request) {
+	var silence alerting.Silence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "400").Inc()
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.silencer.Create(r.Context(), silence)
+	if err != nil {
+		status := storeErrorStatus(err)
+		if errors.Is(err, alerting.ErrInvalidSilence) {
+			status = http.StatusBadRequest
+		}
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", strconv.Itoa(status)).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "201").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// deleteSilence удаляет silence по параметру id
+func (h *Handler) deleteSilence(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "400").Inc()
+		http.Error(w, "id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.silencer.Delete(r.Context(), id)
+	if err != nil {
+		status := storeErrorStatus(err)
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", strconv.Itoa(status)).Inc()
+		http.Error(w, "Failed to delete silence", status)
+		return
+	}
+	if !deleted {
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "404").Inc()
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/silences", "200").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "deleted",
+		"id":     id,
+	})
+}
+
+// storeErrorStatus возвращает HTTP статус для ошибки хранилища
+func storeErrorStatus(err error) int {
+	if errors.Is(err, cache.ErrUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/stream"
+)
+
+// sseHeartbeat интервал комментариев, поддерживающих соединение через прокси
+const sseHeartbeat = 15 * time.Second
+
+// SetBroker подключает брокер потоковой выдачи результатов
+func (h *Handler) SetBroker(broker *stream.Broker) {
+	h.broker = broker
+}
+
+// StreamAnomalies обрабатывает GET /stream/anomalies.
+// Параметры device_id и anomaly_type объединяются по ИЛИ.
+func (h *Handler) StreamAnomalies(w http.ResponseWriter, r *http.Request) {
+	h.serveSSE(w, r, "/stream/anomalies", stream.Filter{
+		DeviceIDs:     r.URL.Query()["device_id"],
+		AnomalyTypes:  r.URL.Query()["anomaly_type"],
+		AnomaliesOnly: true,
+	})
+}
+
+// StreamResults обрабатывает GET /stream/results
+func (h *Handler) StreamResults(w http.ResponseWriter, r *http.Request) {
+	h.serveSSE(w, r, "/stream/results", stream.Filter{
+		DeviceIDs: r.URL.Query()["device_id"],
+	})
+}
+
+// serveSSE отправляет события брокера клиенту в формате Server-Sent Events
+func (h *Handler) serveSSE(w http.ResponseWriter, r *http.Request, endpoint string, filter stream.Filter) {
+	if r.Method != http.MethodGet {
+		metrics.RequestsTotal.WithLabelValues(r.Method, endpoint, "405").Inc()
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Поток живет дольше WriteTimeout сервера, поэтому снимаем дедлайн записи
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		metrics.RequestsTotal.WithLabelValues(r.Method, endpoint, "500").Inc()
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastEventID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastEventID, _ = strconv.ParseUint(v, 10, 64)
+	}
+
+	sub := h.broker.Subscribe(filter, lastEventID)
+	defer sub.Close()
+
+	metrics.RequestsTotal.WithLabelValues(r.Method, endpoint, "200").Inc()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Подписчик отключен брокером; клиент переподключится с Last-Event-ID
+				return
+			}
+			data, err := json.Marshal(event.Data())
+			if err != nil {
+				continue
+			}
+			eventType := "result"
+			if event.Result.IsAnomaly {
+				eventType = "anomaly"
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, eventType, data); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
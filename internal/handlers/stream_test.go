@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/stream"
+)
+
+func TestStreamResultsClosedWithBroker(t *testing.T) {
+	broker := stream.NewBroker(10, 10)
+	h := &Handler{broker: broker}
+	server := httptest.NewServer(http.HandlerFunc(h.StreamResults))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	broker.Publish(analytics.AnalysisResult{DeviceID: "d1"})
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// Дожидаемся первого события, затем останавливаем брокер
+	for line := range lines {
+		if strings.HasPrefix(line, "event: result") {
+			break
+		}
+	}
+	broker.Close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream is still open after the broker was closed")
+		}
+	}
+}
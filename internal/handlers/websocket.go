@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+	"highload-final/internal/stream"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsMaxMessage   = 4096
+)
+
+// SetAllowedOrigins задает origin, с которых разрешено подключение по WebSocket.
+// Пустой список разрешает только запросы с того же хоста.
+func (h *Handler) SetAllowedOrigins(origins []string) {
+	h.allowedOrigins = origins
+}
+
+// wsConns активные WebSocket-соединения.
+// Shutdown сервера не отслеживает перехваченные соединения, поэтому их закрывает CloseWebSockets.
+type wsConns struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+// add регистрирует соединение
+func (c *wsConns) add(conn *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = make(map[*websocket.Conn]struct{})
+	}
+	c.conns[conn] = struct{}{}
+}
+
+// remove снимает соединение с учета
+func (c *wsConns) remove(conn *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, conn)
+}
+
+// CloseWebSockets отправляет клиентам кадр закрытия и закрывает соединения.
+// Вызывается при остановке сервера.
+func (h *Handler) CloseWebSockets() {
+	h.websockets.mu.Lock()
+	defer h.websockets.mu.Unlock()
+
+	for conn := range h.websockets.conns {
+		writeGoingAway(conn)
+		conn.Close()
+	}
+	h.websockets.conns = nil
+}
+
+// writeGoingAway отправляет клиенту кадр закрытия при остановке сервера
+func writeGoingAway(conn *websocket.Conn) error {
+	return conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+		time.Now().Add(wsWriteTimeout))
+}
+
+// wsSubscription состояние подписки одного WebSocket-клиента
+type wsSubscription struct {
+	active       bool
+	deviceIDs    []string
+	anomalyTypes []string
+}
+
+// apply применяет команду клиента к состоянию подписки
+func (s *wsSubscription) apply(cmd models.StreamCommand) bool {
+	switch cmd.Action {
+	case models.StreamSubscribe:
+		s.active = true
+		s.deviceIDs = appendUnique(s.deviceIDs, cmd.DeviceIDs)
+		s.anomalyTypes = appendUnique(s.anomalyTypes, cmd.AnomalyTypes)
+	case models.StreamUnsubscribe:
+		// Отписка без списков отключает все подписки
+		if len(cmd.DeviceIDs) == 0 && len(cmd.AnomalyTypes) == 0 {
+			*s = wsSubscription{}
+			return true
+		}
+		s.deviceIDs = slices.DeleteFunc(s.deviceIDs, func(id string) bool {
+			return slices.Contains(cmd.DeviceIDs, id)
+		})
+		s.anomalyTypes = slices.DeleteFunc(s.anomalyTypes, func(t string) bool {
+			return slices.Contains(cmd.AnomalyTypes, t)
+		})
+		if len(s.deviceIDs) == 0 && len(s.anomalyTypes) == 0 {
+			s.active = false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// filter возвращает фильтр брокера для текущего состояния
+func (s *wsSubscription) filter() stream.Filter {
+	return stream.Filter{
+		DeviceIDs:    slices.Clone(s.deviceIDs),
+		AnomalyTypes: slices.Clone(s.anomalyTypes),
+	}
+}
+
+// message возвращает сообщение с текущим состоянием подписки
+func (s *wsSubscription) message() models.StreamMessage {
+	return models.StreamMessage{
+		Type:         "subscriptions",
+		Active:       s.active,
+		DeviceIDs:    s.deviceIDs,
+		AnomalyTypes: s.anomalyTypes,
+	}
+}
+
+// appendUnique добавляет значения, которых еще нет в списке
+func appendUnique(list, values []string) []string {
+	for _, v := range values {
+		if v != "" && !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// StreamWebSocket обрабатывает GET /ws/results.
+// Клиент управляет подпиской командами subscribe/unsubscribe
+// со списками device_ids и anomaly_types; клиент получает результаты подписанных устройств
+// и аномалии подписанных типов. subscribe без списков подписывает на все результаты.
+func (h *Handler) StreamWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+	}
+	if len(h.allowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(h.allowedOrigins, origin)
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже отправил ответ с ошибкой
+		metrics.RequestsTotal.WithLabelValues(r.Method, "/ws/results", "400").Inc()
+		return
+	}
+	defer conn.Close()
+	metrics.RequestsTotal.WithLabelValues(r.Method, "/ws/results", "101").Inc()
+
+	h.websockets.add(conn)
+	defer h.websockets.remove(conn)
+
+	// Команды читаются в отдельной goroutine, запись выполняется только из этой
+	commands := make(chan models.StreamCommand)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		readErr <- readStreamCommands(conn, commands, done)
+	}()
+
+	var (
+		state wsSubscription
+		sub   *stream.Subscription
+	)
+	defer func() {
+		if sub != nil {
+			sub.Close()
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var events <-chan stream.Event
+		if sub != nil {
+			events = sub.Events()
+		}
+
+		select {
+		case err := <-readErr:
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			return
+
+		case cmd := <-commands:
+			if !state.apply(cmd) {
+				msg := models.StreamMessage{Type: "error", Error: "action must be subscribe or unsubscribe"}
+				if writeStreamMessage(conn, msg) != nil {
+					return
+				}
+				continue
+			}
+			switch {
+			case !state.active && sub != nil:
+				sub.Close()
+				sub = nil
+			case state.active && sub == nil:
+				sub = h.broker.Subscribe(state.filter(), 0)
+			case state.active:
+				sub.SetFilter(state.filter())
+			}
+			if writeStreamMessage(conn, state.message()) != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok && !sub.Dropped() {
+				// Брокер остановлен вместе с сервером
+				writeGoingAway(conn)
+				return
+			}
+			if !ok {
+				// Брокер отключил медленного клиента
+				writeStreamMessage(conn, models.StreamMessage{Type: "error", Error: "subscriber too slow"})
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			data := event.Data()
+			if writeStreamMessage(conn, models.StreamMessage{Type: "result", ID: event.ID, Data: &data}) != nil {
+				return
+			}
+
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readStreamCommands читает команды клиента до закрытия соединения
+func readStreamCommands(conn *websocket.Conn, commands chan<- models.StreamCommand, done <-chan struct{}) error {
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+
+		// Некорректный JSON обрабатывается как неизвестное действие
+		var cmd models.StreamCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			cmd = models.StreamCommand{}
+		}
+		select {
+		case commands <- cmd:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// writeStreamMessage отправляет сообщение клиенту
+func writeStreamMessage(conn *websocket.Conn, msg models.StreamMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(msg)
+}
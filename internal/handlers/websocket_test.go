@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"highload-final/internal/models"
+	"highload-final/internal/stream"
+)
+
+func TestStreamWebSocketShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		shutdown func(h *Handler)
+	}{
+		{"connections closed", func(h *Handler) { h.CloseWebSockets() }},
+		{"broker closed", func(h *Handler) { h.broker.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{broker: stream.NewBroker(10, 10)}
+			server := httptest.NewServer(http.HandlerFunc(h.StreamWebSocket))
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			if err := conn.WriteJSON(models.StreamCommand{Action: models.StreamSubscribe}); err != nil {
+				t.Fatal(err)
+			}
+			var msg models.StreamMessage
+			if err := conn.ReadJSON(&msg); err != nil || msg.Type != "subscriptions" {
+				t.Fatalf("subscribe reply = %+v, %v", msg, err)
+			}
+
+			tt.shutdown(h)
+
+			_, _, err = conn.ReadMessage()
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Errorf("read error = %v, want close frame %d", err, websocket.CloseGoingAway)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-final/internal/models"
+)
+
+// RecordFunc получает очередную запись файла метрик; line - номер строки,
+// parseErr - ошибка разбора самой записи
+type RecordFunc func(line int, metric models.Metric, parseErr error)
+
+// Форматы файлов метрик
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// FormatFromPath определяет формат файла метрик по расширению
+func FormatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatNDJSON
+}
+
+// ReadHistory читает выгрузку метрик, проверяет записи и сортирует их по времени.
+// Ограничения возраста и расхождения часов к истории не применяются.
+// Некорректные записи пропускаются и передаются в onError.
+func ReadHistory(r io.Reader, format string, onError func(line int, err error)) ([]models.Metric, error) {
+	rules := DefaultRules()
+	rules.MaxAge = 0
+	rules.MaxClockSkew = math.MaxInt64
+
+	var batch []models.Metric
+	collect := func(line int, metric models.Metric, err error) {
+		if err == nil {
+			err = rules.Validate(&metric)
+		}
+		if err != nil {
+			onError(line, err)
+			return
+		}
+		batch = append(batch, metric)
+	}
+
+	var err error
+	switch format {
+	case FormatNDJSON:
+		err = ReadNDJSON(context.Background(), r, collect)
+	case FormatCSV:
+		err = ReadCSV(context.Background(), r, collect)
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].Timestamp.Before(batch[j].Timestamp)
+	})
+	return batch, nil
+}
+
+// ReadNDJSON читает по одному JSON объекту на строку и передает каждую запись в fn.
+// Ошибка разбора отдельной строки передается в fn и не прерывает чтение.
+func ReadNDJSON(ctx context.Context, body io.Reader, fn RecordFunc) error {
+	reader := bufio.NewReaderSize(body, 64*1024)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// Оборванную строку не разбираем
+			return err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var metric models.Metric
+			parseErr := json.Unmarshal(data, &metric)
+			fn(line, metric, parseErr)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+}
+
+// ReadCSV читает CSV с заголовком и передает каждую запись в fn. Обязательная колонка device_id; timestamp
+// в RFC 3339 или Unix секундах; cpu, rps, memory - числа; остальные колонки становятся метками.
+func ReadCSV(ctx context.Context, body io.Reader, fn RecordFunc) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("invalid CSV header: %w", err)
+	}
+	columns := make([]string, len(header))
+	hasDevice := false
+	for i, name := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(name))
+		hasDevice = hasDevice || columns[i] == "device_id"
+	}
+	if !hasDevice {
+		return errors.New("CSV header must contain device_id column")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return err
+		}
+		if parseErr != nil {
+			// При ошибке разбора FieldPos недоступен, строка берется из ошибки
+			fn(parseErr.StartLine, models.Metric{}, parseErr.Err)
+		} else {
+			line, _ := reader.FieldPos(0)
+			metric, err := parseCSVRecord(columns, record)
+			fn(line, metric, err)
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+}
+
+// parseCSVRecord преобразует запись CSV в метрику
+func parseCSVRecord(columns, record []string) (models.Metric, error) {
+	var metric models.Metric
+	if len(record) != len(columns) {
+		return metric, fmt.Errorf("expected %d fields, got %d", len(columns), len(record))
+	}
+
+	for i, column := range columns {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "device_id":
+			metric.DeviceID = value
+		case "timestamp":
+			metric.Timestamp, err = parseCSVTimestamp(value)
+		case "cpu":
+			metric.CPU, err = strconv.ParseFloat(value, 64)
+		case "rps":
+			metric.RPS, err = strconv.ParseFloat(value, 64)
+		case "memory":
+			metric.Memory, err = strconv.ParseFloat(value, 64)
+		default:
+			if metric.Tags == nil {
+				metric.Tags = make(map[string]string)
+			}
+			metric.Tags[column] = value
+		}
+		if err != nil {
+			return metric, fmt.Errorf("invalid %s %q", column, value)
+		}
+	}
+	return metric, nil
+}
+
+// parseCSVTimestamp разбирает время в RFC 3339 или Unix секундах
+func parseCSVTimestamp(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		sec := int64(seconds)
+		return time.Unix(sec, int64((seconds-float64(sec))*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,190 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-final/internal/models"
+)
+
+// record запись, переданная в RecordFunc
+type record struct {
+	line   int
+	metric models.Metric
+	err    bool
+}
+
+// collect возвращает RecordFunc, сохраняющую записи в records
+func collect(records *[]record) RecordFunc {
+	return func(line int, metric models.Metric, parseErr error) {
+		*records = append(*records, record{line: line, metric: metric, err: parseErr != nil})
+	}
+}
+
+func TestReadNDJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []record
+	}{
+		{name: "empty", body: ""},
+		{
+			name: "records",
+			body: `{"device_id":"d1","cpu":10,"rps":5,"timestamp":"2024-01-01T00:00:00Z"}` + "\n" +
+				`{"device_id":"d2","memory":512,"message_id":"m1","tags":{"rack":"r1"}}` + "\n",
+			want: []record{
+				{line: 1, metric: models.Metric{DeviceID: "d1", CPU: 10, RPS: 5, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+				{line: 2, metric: models.Metric{DeviceID: "d2", Memory: 512, MessageID: "m1", Tags: map[string]string{"rack": "r1"}}},
+			},
+		},
+		{
+			name: "blank lines are skipped but counted",
+			body: "\n" + `{"device_id":"d1"}` + "\n  \n" + `{"device_id":"d2"}`,
+			want: []record{
+				{line: 2, metric: models.Metric{DeviceID: "d1"}},
+				{line: 4, metric: models.Metric{DeviceID: "d2"}},
+			},
+		},
+		{
+			name: "invalid line does not stop reading",
+			body: `{"device_id":"d1"}` + "\n" + `{"device_id":` + "\n" + `{"device_id":"d3","cpu":"high"}` + "\n" + `{"device_id":"d4"}` + "\n",
+			want: []record{
+				{line: 1, metric: models.Metric{DeviceID: "d1"}},
+				{line: 2, err: true},
+				{line: 3, metric: models.Metric{DeviceID: "d3"}, err: true},
+				{line: 4, metric: models.Metric{DeviceID: "d4"}},
+			},
+		},
+		{
+			name: "crlf line endings",
+			body: `{"device_id":"d1"}` + "\r\n" + `{"device_id":"d2"}` + "\r\n",
+			want: []record{
+				{line: 1, metric: models.Metric{DeviceID: "d1"}},
+				{line: 2, metric: models.Metric{DeviceID: "d2"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []record
+			if err := ReadNDJSON(context.Background(), strings.NewReader(tt.body), collect(&got)); err != nil {
+				t.Fatalf("ReadNDJSON() = %v", err)
+			}
+			compareRecords(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []record
+		wantErr bool
+	}{
+		{name: "empty", body: ""},
+		{name: "missing device_id column", body: "cpu,rps\n1,2\n", wantErr: true},
+		{
+			name: "records",
+			body: "Device_ID, timestamp ,cpu,rps,memory,rack\n" +
+				"d1,2024-01-01T00:00:00Z,10,5,512,r1\n" +
+				"d2,1704067200.5,1.5,,,\n",
+			want: []record{
+				{line: 2, metric: models.Metric{DeviceID: "d1", CPU: 10, RPS: 5, Memory: 512, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Tags: map[string]string{"rack": "r1"}}},
+				{line: 3, metric: models.Metric{DeviceID: "d2", CPU: 1.5, Timestamp: time.Unix(1704067200, int64(time.Second/2))}},
+			},
+		},
+		{
+			name: "invalid records do not stop reading",
+			body: "device_id,cpu,timestamp\n" +
+				"d1,abc,\n" +
+				"d2,1\n" +
+				"d3,1,yesterday\n" +
+				"d4,2,\n",
+			want: []record{
+				{line: 2, metric: models.Metric{DeviceID: "d1"}, err: true},
+				{line: 3, err: true},
+				{line: 4, metric: models.Metric{DeviceID: "d3", CPU: 1}, err: true},
+				{line: 5, metric: models.Metric{DeviceID: "d4", CPU: 2}},
+			},
+		},
+		{
+			name: "quoting error is reported with its line",
+			body: "device_id,cpu\n" +
+				"d1\"x,1\n" +
+				"d2,2\n" +
+				"\"d3,3\n",
+			want: []record{
+				{line: 2, err: true},
+				{line: 3, metric: models.Metric{DeviceID: "d2", CPU: 2}},
+				{line: 4, err: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []record
+			err := ReadCSV(context.Background(), strings.NewReader(tt.body), collect(&got))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCSV() = %v, want error %v", err, tt.wantErr)
+			}
+			compareRecords(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	readers := map[string]func(context.Context, string, RecordFunc) error{
+		FormatNDJSON: func(ctx context.Context, body string, fn RecordFunc) error {
+			return ReadNDJSON(ctx, strings.NewReader(body), fn)
+		},
+		FormatCSV: func(ctx context.Context, body string, fn RecordFunc) error {
+			return ReadCSV(ctx, strings.NewReader(body), fn)
+		},
+	}
+	bodies := map[string]string{
+		FormatNDJSON: `{"device_id":"d1"}` + "\n" + `{"device_id":"d2"}` + "\n",
+		FormatCSV:    "device_id\nd1\nd2\n",
+	}
+	for format, read := range readers {
+		var got []record
+		if err := read(ctx, bodies[format], collect(&got)); err != context.Canceled {
+			t.Errorf("%s: error = %v, want context.Canceled", format, err)
+		}
+		// Запись, прочитанная до проверки контекста, уже передана
+		if len(got) != 1 {
+			t.Errorf("%s: got %d records, want 1", format, len(got))
+		}
+	}
+}
+
+// compareRecords сравнивает прочитанные записи с ожидаемыми
+func compareRecords(t *testing.T, got, want []record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.line != w.line || g.err != w.err {
+			t.Errorf("record %d: line %d, error %v; want line %d, error %v", i, g.line, g.err, w.line, w.err)
+		}
+		if g.metric.DeviceID != w.metric.DeviceID || g.metric.CPU != w.metric.CPU || g.metric.RPS != w.metric.RPS ||
+			g.metric.Memory != w.metric.Memory || g.metric.MessageID != w.metric.MessageID || !g.metric.Timestamp.Equal(w.metric.Timestamp) {
+			t.Errorf("record %d: metric %+v, want %+v", i, g.metric, w.metric)
+		}
+		if len(g.metric.Tags) != len(w.metric.Tags) {
+			t.Errorf("record %d: tags %v, want %v", i, g.metric.Tags, w.metric.Tags)
+		}
+		for k, v := range w.metric.Tags {
+			if g.metric.Tags[k] != v {
+				t.Errorf("record %d: tag %s = %q, want %q", i, k, g.metric.Tags[k], v)
+			}
+		}
+	}
+}
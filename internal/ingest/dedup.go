@@ -0,0 +1,158 @@
+package ingest
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"highload-final/internal/cache"
+	"highload-final/internal/models"
+)
+
+// ErrDuplicate метрика с таким message_id уже принята
+var ErrDuplicate = errors.New("duplicate message")
+
+// Хранилища идентификаторов принятых сообщений
+const (
+	DedupRedis  = "redis"
+	DedupMemory = "memory"
+	DedupNone   = "none"
+)
+
+// Deduplicator запоминает идентификаторы принятых сообщений устройств
+type Deduplicator interface {
+	// Mark отмечает сообщение; возвращает false, если оно уже было отмечено
+	Mark(ctx context.Context, deviceID, messageID string) (bool, error)
+	// Unmark снимает отметку, если сообщение в итоге не принято
+	Unmark(ctx context.Context, deviceID, messageID string)
+}
+
+// SetDeduplicator включает отбрасывание повторов по message_id
+func (p *Pipeline) SetDeduplicator(d Deduplicator) {
+	p.dedup = d
+}
+
+// mark отмечает сообщение метрики; повтор возвращает ErrDuplicate
+func (p *Pipeline) mark(ctx context.Context, metric models.Metric) error {
+	if p.dedup == nil || metric.MessageID == "" {
+		return nil
+	}
+	marked, err := p.dedup.Mark(ctx, metric.DeviceID, metric.MessageID)
+	if err != nil {
+		// Недоступность хранилища не должна останавливать прием
+		log.Printf("Deduplication unavailable for %s: %v\n", metric.DeviceID, err)
+		return nil
+	}
+	if !marked {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// unmark снимает отметку метрики, не принятой на анализ
+func (p *Pipeline) unmark(ctx context.Context, metric models.Metric) {
+	if p.dedup == nil || metric.MessageID == "" {
+		return
+	}
+	p.dedup.Unmark(context.WithoutCancel(ctx), metric.DeviceID, metric.MessageID)
+}
+
+// RedisDeduplicator хранит идентификаторы в Redis, общем для всех реплик.
+// При недоступности Redis используется локальный LRU.
+type RedisDeduplicator struct {
+	cache    *cache.RedisCache
+	ttl      time.Duration
+	fallback *MemoryDeduplicator
+}
+
+// NewRedisDeduplicator создает дедупликатор на Redis с окном ttl
+func NewRedisDeduplicator(cache *cache.RedisCache, ttl time.Duration, fallbackSize int) *RedisDeduplicator {
+	return &RedisDeduplicator{
+		cache:    cache,
+		ttl:      ttl,
+		fallback: NewMemoryDeduplicator(fallbackSize, ttl),
+	}
+}
+
+// Mark отмечает сообщение в Redis
+func (d *RedisDeduplicator) Mark(ctx context.Context, deviceID, messageID string) (bool, error) {
+	marked, err := d.cache.MarkMessage(ctx, deviceID, messageID, d.ttl)
+	if err != nil {
+		return d.fallback.Mark(ctx, deviceID, messageID)
+	}
+	return marked, nil
+}
+
+// Unmark снимает отметку в Redis и в локальном LRU
+func (d *RedisDeduplicator) Unmark(ctx context.Context, deviceID, messageID string) {
+	d.fallback.Unmark(ctx, deviceID, messageID)
+	if err := d.cache.UnmarkMessage(ctx, deviceID, messageID); err != nil {
+		log.Printf("Failed to unmark message %s of %s: %v\n", messageID, deviceID, err)
+	}
+}
+
+// MemoryDeduplicator LRU идентификаторов сообщений в памяти реплики
+type MemoryDeduplicator struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDeduplicator создает LRU на size идентификаторов с окном ttl.
+// size должен быть положительным: при size <= 0 вытесняется каждая отметка.
+func NewMemoryDeduplicator(size int, ttl time.Duration) *MemoryDeduplicator {
+	return &MemoryDeduplicator{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Mark отмечает сообщение; самые давние отметки вытесняются при переполнении
+func (d *MemoryDeduplicator) Mark(_ context.Context, deviceID, messageID string) (bool, error) {
+	key := deviceID + "/" + messageID
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.entries[key]; ok {
+		if now.Before(elem.Value.(*dedupEntry).expires) {
+			return false, nil
+		}
+		d.order.Remove(elem)
+		delete(d.entries, key)
+	}
+
+	d.entries[key] = d.order.PushFront(&dedupEntry{key: key, expires: now.Add(d.ttl)})
+	for d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return true, nil
+}
+
+// Unmark снимает отметку
+func (d *MemoryDeduplicator) Unmark(_ context.Context, deviceID, messageID string) {
+	key := deviceID + "/" + messageID
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.entries[key]; ok {
+		d.order.Remove(elem)
+		delete(d.entries, key)
+	}
+}
@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/models"
+)
+
+func TestMemoryDeduplicator(t *testing.T) {
+	// step отметка или снятие отметки сообщения
+	type step struct {
+		unmark  bool
+		device  string
+		message string
+		sleep   time.Duration
+		want    bool
+	}
+
+	tests := []struct {
+		name  string
+		size  int
+		ttl   time.Duration
+		steps []step
+	}{
+		{
+			name: "repeat is duplicate",
+			size: 10,
+			ttl:  time.Minute,
+			steps: []step{
+				{device: "d1", message: "m1", want: true},
+				{device: "d1", message: "m1", want: false},
+				{device: "d1", message: "m2", want: true},
+			},
+		},
+		{
+			name: "message ids are scoped by device",
+			size: 10,
+			ttl:  time.Minute,
+			steps: []step{
+				{device: "d1", message: "m1", want: true},
+				{device: "d2", message: "m1", want: true},
+			},
+		},
+		{
+			name: "unmark allows redelivery",
+			size: 10,
+			ttl:  time.Minute,
+			steps: []step{
+				{device: "d1", message: "m1", want: true},
+				{unmark: true, device: "d1", message: "m1"},
+				{device: "d1", message: "m1", want: true},
+				{device: "d1", message: "m1", want: false},
+			},
+		},
+		{
+			name: "expired mark is renewed",
+			size: 10,
+			ttl:  10 * time.Millisecond,
+			steps: []step{
+				{device: "d1", message: "m1", want: true},
+				{device: "d1", message: "m1", sleep: 20 * time.Millisecond, want: true},
+				{device: "d1", message: "m1", want: false},
+			},
+		},
+		{
+			name: "oldest mark is evicted",
+			size: 2,
+			ttl:  time.Minute,
+			steps: []step{
+				{device: "d1", message: "m1", want: true},
+				{device: "d1", message: "m2", want: true},
+				{device: "d1", message: "m3", want: true},
+				{device: "d1", message: "m3", want: false},
+				{device: "d1", message: "m2", want: false},
+				{device: "d1", message: "m1", want: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := NewMemoryDeduplicator(tt.size, tt.ttl)
+
+			for i, s := range tt.steps {
+				time.Sleep(s.sleep)
+				if s.unmark {
+					d.Unmark(ctx, s.device, s.message)
+					continue
+				}
+				marked, err := d.Mark(ctx, s.device, s.message)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if marked != s.want {
+					t.Errorf("step %d: Mark(%s, %s) = %v, want %v", i, s.device, s.message, marked, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineDedup(t *testing.T) {
+	ctx := context.Background()
+	metric := models.Metric{DeviceID: "d1", MessageID: "m1"}
+
+	// Анализатор не запущен, поэтому заполненная очередь отклоняет метрику до записи в Redis
+	analyzer := analytics.NewAnalyzer(10, 2)
+	for analyzer.AddMetric(analytics.MetricData{DeviceID: "filler"}) {
+	}
+	p := NewPipeline(analyzer, nil)
+	dedup := NewMemoryDeduplicator(10, time.Minute)
+	p.SetDeduplicator(dedup)
+
+	// Отклоненная метрика снимает отметку, и повторная доставка не считается дублем
+	if err := p.Ingest(ctx, metric); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Ingest() = %v, want ErrQueueFull", err)
+	}
+	if marked, _ := dedup.Mark(ctx, metric.DeviceID, metric.MessageID); !marked {
+		t.Fatal("message of a rejected metric must be unmarked")
+	}
+
+	// Уже отмеченное сообщение отклоняется как дубль
+	err := p.Ingest(ctx, metric)
+	if !errors.Is(err, ErrDuplicate) || Reason(err) != "duplicate" {
+		t.Fatalf("Ingest() = %v, want ErrDuplicate", err)
+	}
+
+	// Без message_id повторы не отслеживаются
+	if err := p.Ingest(ctx, models.Metric{DeviceID: "d1"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Ingest() without message_id = %v, want ErrQueueFull", err)
+	}
+}
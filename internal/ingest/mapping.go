@@ -0,0 +1,241 @@
+package ingest
+
+import (
+	"container/list"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// Поля models.Metric, в которые отображаются внешние ряды
+const (
+	FieldCPU    = "cpu"
+	FieldRPS    = "rps"
+	FieldMemory = "memory"
+)
+
+// FieldMapping отображение внешнего ряда (Prometheus, OTLP) в поле метрики
+type FieldMapping struct {
+	Field  string
+	Series string
+	// Scale множитель значения, например 100 для долей CPU
+	Scale float64
+}
+
+// ParseFieldMappings разбирает строку вида "cpu=instance:cpu:ratio*100,rps=job:requests:rate1m".
+// Допустимые поля: cpu, rps и memory.
+func ParseFieldMappings(s string) ([]FieldMapping, error) {
+	var mappings []FieldMapping
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field, series, ok := strings.Cut(item, "=")
+		if !ok || series == "" {
+			return nil, fmt.Errorf("invalid field mapping %q", item)
+		}
+		if field != FieldCPU && field != FieldRPS && field != FieldMemory {
+			return nil, fmt.Errorf("unknown metric field %q in mapping", field)
+		}
+
+		m := FieldMapping{Field: field, Series: series, Scale: 1}
+		if name, scale, ok := strings.Cut(series, "*"); ok {
+			factor, err := strconv.ParseFloat(scale, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scale in field mapping %q: %w", item, err)
+			}
+			m.Series, m.Scale = name, factor
+		}
+		mappings = append(mappings, m)
+	}
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("field mapping is empty")
+	}
+	return mappings, nil
+}
+
+// Point значение одного поля метрики устройства в момент времени
+type Point struct {
+	DeviceID  string
+	Timestamp time.Time
+	Field     string
+	Value     float64
+	// Tags метки устройства; непустые метки заменяют ранее известные
+	Tags map[string]string
+}
+
+// Параметры ожидания недостающих полей
+const (
+	mergerPendingSize = 10000
+	mergerPendingTTL  = time.Minute
+)
+
+// Merger собирает значения полей в метрики устройств.
+// Метрика выпускается, только когда для момента времени известны все сопоставленные поля.
+// Значения одного момента могут прийти в разных запросах (Prometheus распределяет ряды
+// по шардам), поэтому неполная точка ждет недостающих полей не дольше mergerPendingTTL.
+// Значения не переносятся на другие моменты времени, чтобы не создавать несуществующих измерений.
+type Merger struct {
+	source  string
+	fields  []string
+	mu      sync.Mutex
+	order   *list.List
+	pending map[pointKey]*list.Element
+}
+
+// NewMerger создает объединитель значений сопоставленных полей.
+// source используется в метрике отклоненных значений.
+func NewMerger(source string, mappings []FieldMapping) *Merger {
+	var fields []string
+	for _, m := range mappings {
+		if !slices.Contains(fields, m.Field) {
+			fields = append(fields, m.Field)
+		}
+	}
+	return &Merger{
+		source:  source,
+		fields:  fields,
+		order:   list.New(),
+		pending: make(map[pointKey]*list.Element),
+	}
+}
+
+// pointKey метрика устройства в момент времени
+type pointKey struct {
+	deviceID  string
+	timestamp int64
+}
+
+// pointFields известные поля метрики устройства в момент времени
+type pointFields struct {
+	key     pointKey
+	values  map[string]float64
+	tags    map[string]string
+	expires time.Time
+}
+
+// add дополняет поля значениями другой части той же точки
+func (f *pointFields) add(other *pointFields) {
+	for field, value := range other.values {
+		f.values[field] = value
+	}
+	if other.tags != nil {
+		f.tags = other.tags
+	}
+}
+
+// complete сообщает, известны ли все поля
+func (f *pointFields) complete(fields []string) bool {
+	for _, field := range fields {
+		if _, ok := f.values[field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// metric возвращает метрику устройства
+func (f *pointFields) metric() models.Metric {
+	return models.Metric{
+		DeviceID:  f.key.deviceID,
+		Timestamp: time.Unix(0, f.key.timestamp),
+		CPU:       f.values[FieldCPU],
+		RPS:       f.values[FieldRPS],
+		Memory:    f.values[FieldMemory],
+		Tags:      f.tags,
+	}
+}
+
+// Merge возвращает полные метрики, упорядоченные по времени.
+// Неполные точки запоминаются до прихода недостающих полей.
+func (m *Merger) Merge(points []Point) []models.Metric {
+	now := time.Now()
+
+	grouped := make(map[pointKey]*pointFields)
+	for _, p := range points {
+		key := pointKey{deviceID: p.DeviceID, timestamp: p.Timestamp.UnixNano()}
+		f := grouped[key]
+		if f == nil {
+			f = &pointFields{key: key, values: make(map[string]float64)}
+			grouped[key] = f
+		}
+		f.values[p.Field] = p.Value
+		if len(p.Tags) > 0 {
+			f.tags = p.Tags
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(now)
+
+	var complete []*pointFields
+	for key, f := range grouped {
+		// Дополненная точка сохраняет место в очереди, чтобы срок ожидания не продлевался
+		elem, waiting := m.pending[key]
+		if waiting {
+			pending := elem.Value.(*pointFields)
+			pending.add(f)
+			f = pending
+		}
+		switch {
+		case f.complete(m.fields):
+			if waiting {
+				m.order.Remove(elem)
+				delete(m.pending, key)
+			}
+			complete = append(complete, f)
+		case !waiting:
+			f.expires = now.Add(mergerPendingTTL)
+			m.pending[key] = m.order.PushFront(f)
+		}
+	}
+	for m.order.Len() > mergerPendingSize {
+		m.drop(m.order.Back())
+	}
+
+	sort.Slice(complete, func(i, j int) bool {
+		if complete[i].key.timestamp != complete[j].key.timestamp {
+			return complete[i].key.timestamp < complete[j].key.timestamp
+		}
+		return complete[i].key.deviceID < complete[j].key.deviceID
+	})
+	result := make([]models.Metric, 0, len(complete))
+	for _, f := range complete {
+		result = append(result, f.metric())
+	}
+	return result
+}
+
+// Pending возвращает количество неполных точек, ожидающих недостающих полей
+func (m *Merger) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// expire отбрасывает неполные точки, не дождавшиеся недостающих полей; вызывается под m.mu
+func (m *Merger) expire(now time.Time) {
+	for elem := m.order.Back(); elem != nil; elem = m.order.Back() {
+		if now.Before(elem.Value.(*pointFields).expires) {
+			return
+		}
+		m.drop(elem)
+	}
+}
+
+// drop отбрасывает неполную точку; вызывается под m.mu
+func (m *Merger) drop(elem *list.Element) {
+	f := m.order.Remove(elem).(*pointFields)
+	delete(m.pending, f.key)
+	metrics.MetricsRejected.WithLabelValues(m.source, "incomplete").Inc()
+}
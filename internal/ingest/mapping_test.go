@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergerExpiresIncompletePoints(t *testing.T) {
+	m := NewMerger("test", []FieldMapping{{Field: FieldCPU}, {Field: FieldRPS}})
+	at := time.Unix(1700000000, 0)
+
+	m.Merge([]Point{{DeviceID: "d1", Timestamp: at, Field: FieldCPU, Value: 10}})
+	m.mu.Lock()
+	m.expire(time.Now().Add(mergerPendingTTL))
+	m.mu.Unlock()
+
+	// Поле пришло после истечения ожидания: точка не собирается из устаревшей части
+	if merged := m.Merge([]Point{{DeviceID: "d1", Timestamp: at, Field: FieldRPS, Value: 5}}); len(merged) != 0 {
+		t.Errorf("merged = %+v, want nothing", merged)
+	}
+	if pending := m.Pending(); pending != 1 {
+		t.Errorf("pending = %d, want 1", pending)
+	}
+}
+
+func TestMergerPendingLimit(t *testing.T) {
+	m := NewMerger("test", []FieldMapping{{Field: FieldCPU}, {Field: FieldRPS}})
+	at := time.Unix(1700000000, 0)
+
+	points := make([]Point, 0, mergerPendingSize+10)
+	for i := 0; i < mergerPendingSize+10; i++ {
+		points = append(points, Point{DeviceID: "d1", Timestamp: at.Add(time.Duration(i) * time.Second), Field: FieldCPU, Value: 1})
+	}
+	m.Merge(points)
+
+	if pending := m.Pending(); pending != mergerPendingSize {
+		t.Errorf("pending = %d, want %d", pending, mergerPendingSize)
+	}
+}
+
+func TestParseFieldMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []FieldMapping
+		wantErr bool
+	}{
+		{"cpu and rps", "cpu=instance:cpu:ratio*100, rps=job:requests:rate1m", []FieldMapping{
+			{Field: FieldCPU, Series: "instance:cpu:ratio", Scale: 100},
+			{Field: FieldRPS, Series: "job:requests:rate1m", Scale: 1},
+		}, false},
+		{"memory", "memory=process.memory.usage", []FieldMapping{
+			{Field: FieldMemory, Series: "process.memory.usage", Scale: 1},
+		}, false},
+		{"unknown field", "disk=node_disk_io", nil, true},
+		{"missing series", "cpu=", nil, true},
+		{"invalid scale", "cpu=cpu_ratio*x", nil, true},
+		{"empty", " , ", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFieldMappings(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFieldMappings() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseFieldMappings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/cluster"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// ErrQueueFull очередь анализа заполнена, метрика не принята
+var ErrQueueFull = errors.New("analysis queue is full")
+
+// Pipeline общий путь приема метрик для всех транспортов:
+// валидация, сохранение в Redis и передача в анализатор
+type Pipeline struct {
+	analyzer *analytics.Analyzer
+	cache    *cache.RedisCache
+	cluster  *cluster.Node
+	rules    Rules
+	dedup    Deduplicator
+}
+
+// NewPipeline создает конвейер приема метрик
+func NewPipeline(analyzer *analytics.Analyzer, cache *cache.RedisCache) *Pipeline {
+	return &Pipeline{
+		analyzer: analyzer,
+		cache:    cache,
+		rules:    DefaultRules(),
+	}
+}
+
+// SetCluster включает определение владельца устройства
+func (p *Pipeline) SetCluster(node *cluster.Node) {
+	p.cluster = node
+}
+
+// Cluster возвращает узел кластера или nil, если кластер выключен
+func (p *Pipeline) Cluster() *cluster.Node {
+	return p.cluster
+}
+
+// RemoteOwner возвращает владельца устройства, если это другая реплика
+func (p *Pipeline) RemoteOwner(deviceID string) (cluster.Member, bool) {
+	if p.cluster == nil {
+		return cluster.Member{}, false
+	}
+	owner, local := p.cluster.Owner(deviceID)
+	return owner, !local
+}
+
+// Forward пересылает пачку метрик реплике-владельцу
+func (p *Pipeline) Forward(ctx context.Context, owner cluster.Member, batch []models.Metric) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return p.cluster.Forward(ctx, owner, "/metrics/batch", body)
+}
+
+// Ingest отправляет провалидированную метрику на анализ и сохраняет ее.
+// Метрика сохраняется только после постановки в очередь анализа, чтобы
+// повторная доставка отклоненной метрики (например, MQTT QoS 1) не дублировала запись.
+// Запись в Redis асинхронная и переживает завершение запроса,
+// поэтому отмену контекста не наследует.
+// Повтор сообщения с уже принятым message_id возвращает ErrDuplicate.
+func (p *Pipeline) Ingest(ctx context.Context, metric models.Metric) error {
+	if err := p.mark(ctx, metric); err != nil {
+		return err
+	}
+	if !p.analyzer.AddMetric(analysisData(metric)) {
+		p.unmark(ctx, metric)
+		return ErrQueueFull
+	}
+	p.store(ctx, metric)
+	return nil
+}
+
+// IngestWait как Ingest, но при заполненной очереди ждет освобождения места
+// до отмены контекста. Используется потоковой массовой загрузкой.
+func (p *Pipeline) IngestWait(ctx context.Context, metric models.Metric) error {
+	if err := p.mark(ctx, metric); err != nil {
+		return err
+	}
+	if err := p.analyzer.AddMetricWait(ctx, analysisData(metric)); err != nil {
+		p.unmark(ctx, metric)
+		return err
+	}
+	p.store(ctx, metric)
+	return nil
+}
+
+// analysisData преобразует метрику в данные для анализатора
+func analysisData(metric models.Metric) analytics.MetricData {
+	return analytics.MetricData{
+		DeviceID:  metric.DeviceID,
+		Timestamp: metric.Timestamp,
+		CPU:       metric.CPU,
+		RPS:       metric.RPS,
+		Tags:      metric.Tags,
+	}
+}
+
+// store асинхронно сохраняет принятую метрику
+func (p *Pipeline) store(ctx context.Context, metric models.Metric) {
+	storeCtx := context.WithoutCancel(ctx)
+	go func() {
+		err := p.cache.StoreMetric(storeCtx, metric.DeviceID, metric.Timestamp, metric)
+		metrics.RedisOperations.WithLabelValues("store_metric", cache.Status(err)).Inc()
+	}()
+
+	metrics.MetricsReceived.Inc()
+}
+
+// Reason возвращает причину отклонения метрики для metrics_rejected_total
+func Reason(err error) string {
+	var fieldErr *FieldError
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		return "queue_full"
+	case errors.Is(err, ErrDuplicate):
+		return "duplicate"
+	case errors.Is(err, ErrDeviceIDRequired):
+		return "missing_device_id"
+	case errors.As(err, &fieldErr):
+		return fieldErr.Reason
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.Is(err, analytics.ErrStopped):
+		return "stopped"
+	default:
+		return "invalid"
+	}
+}
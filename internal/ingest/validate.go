@@ -0,0 +1,181 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// ErrDeviceIDRequired метрика без идентификатора устройства
+var ErrDeviceIDRequired = errors.New("device_id is required")
+
+// Причины отклонения метрики
+const (
+	ReasonInvalidDeviceID  = "invalid_device_id"
+	ReasonInvalidMessageID = "invalid_message_id"
+	ReasonNotFinite        = "not_finite"
+	ReasonOutOfRange       = "out_of_range"
+	ReasonFutureTimestamp  = "future_timestamp"
+	ReasonStaleTimestamp   = "stale_timestamp"
+)
+
+// Режимы обработки значений вне допустимого диапазона
+const (
+	ModeReject = "reject"
+	ModeClamp  = "clamp"
+)
+
+// maxMessageIDLength ограничение длины message_id (с учетом суффикса Idempotency-Key)
+const maxMessageIDLength = 256
+
+// Range допустимый диапазон значения поля
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Rules правила проверки входящих метрик
+type Rules struct {
+	// Mode reject отклоняет метрику, clamp приводит значение к границе диапазона.
+	// NaN/Inf, некорректный device_id и устаревшее время отклоняются всегда.
+	Mode   string
+	CPU    Range
+	RPS    Range
+	Memory Range
+
+	// MaxClockSkew насколько время метрики может опережать часы сервера
+	MaxClockSkew time.Duration
+	// MaxAge максимальный возраст метрики, 0 - без ограничения
+	MaxAge time.Duration
+
+	// DeviceIDMaxLength максимальная длина device_id, 0 - без ограничения
+	DeviceIDMaxLength int
+	// DeviceIDPattern допустимые символы device_id, nil - любые
+	DeviceIDPattern *regexp.Regexp
+}
+
+// DefaultRules правила по умолчанию
+func DefaultRules() Rules {
+	return Rules{
+		Mode:              ModeReject,
+		CPU:               Range{Min: 0, Max: 100},
+		RPS:               Range{Min: 0, Max: math.Inf(1)},
+		Memory:            Range{Min: 0, Max: math.Inf(1)},
+		MaxClockSkew:      5 * time.Minute,
+		MaxAge:            24 * time.Hour,
+		DeviceIDMaxLength: 128,
+		DeviceIDPattern:   regexp.MustCompile(`^[A-Za-z0-9._:-]+$`),
+	}
+}
+
+// FieldError недопустимое значение поля метрики
+type FieldError struct {
+	Field  string
+	Reason string
+	Detail string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Detail
+}
+
+// SetRules задает правила проверки метрик
+func (p *Pipeline) SetRules(rules Rules) {
+	p.rules = rules
+}
+
+// Rules возвращает правила проверки метрик
+func (p *Pipeline) Rules() Rules {
+	return p.rules
+}
+
+// Validate проверяет метрику по правилам конвейера и заполняет значения по умолчанию.
+// Общие правила для всех способов приема.
+func (p *Pipeline) Validate(metric *models.Metric) error {
+	return p.rules.Validate(metric)
+}
+
+// Validate проверяет метрику и заполняет значения по умолчанию.
+// В режиме clamp исправляет значения вне диапазона и время из будущего.
+func (rules *Rules) Validate(metric *models.Metric) error {
+	if metric.DeviceID == "" {
+		return ErrDeviceIDRequired
+	}
+	if rules.DeviceIDMaxLength > 0 && len(metric.DeviceID) > rules.DeviceIDMaxLength {
+		return &FieldError{Field: "device_id", Reason: ReasonInvalidDeviceID,
+			Detail: fmt.Sprintf("length exceeds %d characters", rules.DeviceIDMaxLength)}
+	}
+	if rules.DeviceIDPattern != nil && !rules.DeviceIDPattern.MatchString(metric.DeviceID) {
+		return &FieldError{Field: "device_id", Reason: ReasonInvalidDeviceID,
+			Detail: "contains unsupported characters"}
+	}
+
+	if len(metric.MessageID) > maxMessageIDLength {
+		return &FieldError{Field: "message_id", Reason: ReasonInvalidMessageID,
+			Detail: fmt.Sprintf("length exceeds %d characters", maxMessageIDLength)}
+	}
+
+	fields := []struct {
+		name  string
+		value *float64
+		rng   Range
+	}{
+		{"cpu", &metric.CPU, rules.CPU},
+		{"rps", &metric.RPS, rules.RPS},
+		{"memory", &metric.Memory, rules.Memory},
+	}
+	for _, f := range fields {
+		if err := rules.checkValue(f.name, f.value, f.rng); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	// Устанавливаем timestamp если не указан
+	if metric.Timestamp.IsZero() {
+		metric.Timestamp = now
+	}
+	if metric.Timestamp.After(now.Add(rules.MaxClockSkew)) {
+		if rules.Mode == ModeClamp {
+			metrics.MetricsClamped.WithLabelValues("timestamp").Inc()
+			metric.Timestamp = now
+		} else {
+			return &FieldError{Field: "timestamp", Reason: ReasonFutureTimestamp,
+				Detail: fmt.Sprintf("%s is ahead of server time by more than %s",
+					metric.Timestamp.Format(time.RFC3339), rules.MaxClockSkew)}
+		}
+	}
+	if rules.MaxAge > 0 && metric.Timestamp.Before(now.Add(-rules.MaxAge)) {
+		return &FieldError{Field: "timestamp", Reason: ReasonStaleTimestamp,
+			Detail: fmt.Sprintf("%s is older than %s", metric.Timestamp.Format(time.RFC3339), rules.MaxAge)}
+	}
+	return nil
+}
+
+// checkValue проверяет значение поля и в режиме clamp приводит его к диапазону
+func (rules *Rules) checkValue(field string, value *float64, rng Range) error {
+	v := *value
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return &FieldError{Field: field, Reason: ReasonNotFinite, Detail: "value must be a finite number"}
+	}
+	if v >= rng.Min && v <= rng.Max {
+		return nil
+	}
+
+	if rules.Mode == ModeClamp {
+		metrics.MetricsClamped.WithLabelValues(field).Inc()
+		*value = math.Max(rng.Min, math.Min(v, rng.Max))
+		return nil
+	}
+	if v < rng.Min {
+		return &FieldError{Field: field, Reason: ReasonOutOfRange,
+			Detail: fmt.Sprintf("value %g is below minimum %g", v, rng.Min)}
+	}
+	return &FieldError{Field: field, Reason: ReasonOutOfRange,
+		Detail: fmt.Sprintf("value %g exceeds maximum %g", v, rng.Max)}
+}
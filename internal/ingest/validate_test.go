@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-final/internal/models"
+)
+
+func TestRulesValidate(t *testing.T) {
+	now := time.Now()
+	clamp := func(r *Rules) { r.Mode = ModeClamp }
+
+	tests := []struct {
+		name   string
+		rules  func(r *Rules)
+		metric models.Metric
+		// wantErr ожидаемая причина отклонения, пусто - метрика принята
+		wantErr string
+		check   func(t *testing.T, m models.Metric)
+	}{
+		{name: "valid", metric: models.Metric{DeviceID: "web-1.eu:a_b", CPU: 50, RPS: 10, Memory: 1024, Timestamp: now}},
+		{name: "missing device", metric: models.Metric{CPU: 1}, wantErr: "missing_device_id"},
+		{name: "device too long", metric: models.Metric{DeviceID: strings.Repeat("a", 129)}, wantErr: ReasonInvalidDeviceID},
+		{name: "device at limit", metric: models.Metric{DeviceID: strings.Repeat("a", 128)}},
+		{
+			name:   "zero max length is unlimited",
+			rules:  func(r *Rules) { r.DeviceIDMaxLength = 0 },
+			metric: models.Metric{DeviceID: strings.Repeat("a", 1000)},
+		},
+		{
+			name:   "negative max length is unlimited",
+			rules:  func(r *Rules) { r.DeviceIDMaxLength = -1 },
+			metric: models.Metric{DeviceID: strings.Repeat("a", 1000)},
+		},
+		{name: "device with space", metric: models.Metric{DeviceID: "web 1"}, wantErr: ReasonInvalidDeviceID},
+		{
+			name:   "nil pattern allows any characters",
+			rules:  func(r *Rules) { r.DeviceIDPattern = nil },
+			metric: models.Metric{DeviceID: "web 1/α"},
+		},
+		{name: "message id too long", metric: models.Metric{DeviceID: "d", MessageID: strings.Repeat("m", 257)}, wantErr: ReasonInvalidMessageID},
+		{name: "NaN", metric: models.Metric{DeviceID: "d", CPU: math.NaN()}, wantErr: ReasonNotFinite},
+		{name: "Inf rejected in clamp mode", rules: clamp, metric: models.Metric{DeviceID: "d", RPS: math.Inf(1)}, wantErr: ReasonNotFinite},
+		{name: "cpu above max", metric: models.Metric{DeviceID: "d", CPU: 150}, wantErr: ReasonOutOfRange},
+		{name: "negative rps", metric: models.Metric{DeviceID: "d", RPS: -1}, wantErr: ReasonOutOfRange},
+		{name: "negative memory", metric: models.Metric{DeviceID: "d", Memory: -1}, wantErr: ReasonOutOfRange},
+		{
+			name:   "clamp cpu",
+			rules:  clamp,
+			metric: models.Metric{DeviceID: "d", CPU: 150, RPS: -5},
+			check: func(t *testing.T, m models.Metric) {
+				if m.CPU != 100 || m.RPS != 0 {
+					t.Errorf("cpu = %g, rps = %g, want 100 and 0", m.CPU, m.RPS)
+				}
+			},
+		},
+		{
+			name:   "zero timestamp is set to now",
+			metric: models.Metric{DeviceID: "d"},
+			check: func(t *testing.T, m models.Metric) {
+				if m.Timestamp.Before(now) || m.Timestamp.After(time.Now()) {
+					t.Errorf("timestamp = %s, want now", m.Timestamp)
+				}
+			},
+		},
+		{name: "within clock skew", metric: models.Metric{DeviceID: "d", Timestamp: now.Add(time.Minute)}},
+		{name: "future timestamp", metric: models.Metric{DeviceID: "d", Timestamp: now.Add(time.Hour)}, wantErr: ReasonFutureTimestamp},
+		{
+			name:   "clamp future timestamp",
+			rules:  clamp,
+			metric: models.Metric{DeviceID: "d", Timestamp: now.Add(time.Hour)},
+			check: func(t *testing.T, m models.Metric) {
+				if m.Timestamp.After(time.Now()) {
+					t.Errorf("timestamp = %s, want clamped to now", m.Timestamp)
+				}
+			},
+		},
+		{name: "stale timestamp", metric: models.Metric{DeviceID: "d", Timestamp: now.Add(-25 * time.Hour)}, wantErr: ReasonStaleTimestamp},
+		{name: "stale rejected in clamp mode", rules: clamp, metric: models.Metric{DeviceID: "d", Timestamp: now.Add(-25 * time.Hour)}, wantErr: ReasonStaleTimestamp},
+		{
+			name:   "zero max age is unlimited",
+			rules:  func(r *Rules) { r.MaxAge = 0 },
+			metric: models.Metric{DeviceID: "d", Timestamp: now.Add(-24 * 365 * time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			if tt.rules != nil {
+				tt.rules(&rules)
+			}
+			metric := tt.metric
+
+			err := rules.Validate(&metric)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("Validate() = nil, want %s", tt.wantErr)
+				}
+				if reason := Reason(err); reason != tt.wantErr {
+					t.Fatalf("Validate() = %v (reason %s), want reason %s", err, reason, tt.wantErr)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, metric)
+			}
+		})
+	}
+}
+
+func TestFieldErrorDetails(t *testing.T) {
+	rules := DefaultRules()
+	metric := models.Metric{DeviceID: "d", CPU: 101}
+
+	var fieldErr *FieldError
+	if err := rules.Validate(&metric); !errors.As(err, &fieldErr) {
+		t.Fatalf("Validate() = %v, want *FieldError", err)
+	}
+	if fieldErr.Field != "cpu" || fieldErr.Error() != "cpu: value 101 exceeds maximum 100" {
+		t.Errorf("error = %q (field %s)", fieldErr.Error(), fieldErr.Field)
+	}
+}
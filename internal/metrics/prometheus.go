@@ -33,6 +33,33 @@ var (
 		},
 	)
 
+	// MetricsRejected метрики, отклоненные при приеме
+	MetricsRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metrics_rejected_total",
+			Help: "Total number of metrics rejected on ingestion",
+		},
+		[]string{"source", "reason"},
+	)
+
+	// MetricsDuplicates повторно отправленные метрики, отброшенные по message_id
+	MetricsDuplicates = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metrics_duplicates_total",
+			Help: "Total number of duplicate metrics dropped by message ID",
+		},
+		[]string{"source"},
+	)
+
+	// MetricsClamped значения, приведенные к допустимому диапазону при приеме
+	MetricsClamped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metrics_clamped_total",
+			Help: "Total number of metric values clamped to the allowed range on ingestion",
+		},
+		[]string{"field"},
+	)
+
 	// AnomaliesDetected обнаруженные аномалии
 	AnomaliesDetected = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -42,6 +69,24 @@ var (
 		[]string{"type", "device_id"},
 	)
 
+	// AnomaliesSuppressed аномалии, заглушенные silences
+	AnomaliesSuppressed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomalies_suppressed_total",
+			Help: "Total number of anomalies suppressed by silences",
+		},
+		[]string{"type", "device_id"},
+	)
+
+	// AnomalyLabels изменения статуса аномалий операторами
+	AnomalyLabels = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomaly_labels_total",
+			Help: "Total number of anomaly status updates by operators",
+		},
+		[]string{"status"},
+	)
+
 	// AnalysisLatency задержка анализа
 	AnalysisLatency = promauto.NewHistogram(
 		prometheus.HistogramOpts{
@@ -102,4 +147,217 @@ var (
 		},
 		[]string{"cache_type"},
 	)
+
+	// ClusterMembers количество реплик в кластере
+	ClusterMembers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cluster_members",
+			Help: "Number of live replicas in the consistent-hash ring",
+		},
+	)
+
+	// ClusterForwarded метрики, пересланные владельцу устройства
+	ClusterForwarded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cluster_forwarded_requests_total",
+			Help: "Total number of requests forwarded to device owners",
+		},
+		[]string{"status"},
+	)
+
+	// ClusterHandoffWindows окна устройств, переданные между репликами
+	ClusterHandoffWindows = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cluster_handoff_windows_total",
+			Help: "Total number of device windows handed off between replicas",
+		},
+		[]string{"direction", "status"},
+	)
+
+	// RedisConnected состояние подключения к Redis (1 - подключен)
+	RedisConnected = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_connected",
+			Help: "Whether the service is currently connected to Redis",
+		},
+	)
+
+	// RedisSpoolSize количество записей, ожидающих восстановления Redis
+	RedisSpoolSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_spool_size",
+			Help: "Number of writes buffered locally while Redis is unavailable",
+		},
+	)
+
+	// RedisSpoolDropped записи, вытесненные из переполненного буфера
+	RedisSpoolDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "redis_spool_dropped_total",
+			Help: "Total number of buffered writes dropped because the spool was full",
+		},
+	)
+
+	// RedisBreakerState состояние circuit breaker Redis (0 - closed, 1 - open, 2 - half-open)
+	RedisBreakerState = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_circuit_breaker_state",
+			Help: "Redis circuit breaker state (0 - closed, 1 - open, 2 - half-open)",
+		},
+	)
+
+	// RedisBreakerTransitions переходы circuit breaker по целевому состоянию
+	RedisBreakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_circuit_breaker_transitions_total",
+			Help: "Total number of Redis circuit breaker state transitions",
+		},
+		[]string{"state"},
+	)
+
+	// RedisBreakerRejected операции, отклоненные разомкнутым circuit breaker
+	RedisBreakerRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_circuit_breaker_rejected_total",
+			Help: "Total number of Redis operations rejected by the open circuit breaker",
+		},
+		[]string{"operation"},
+	)
+
+	// AlertNotifications попытки доставки оповещений по получателям
+	AlertNotifications = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_notifications_total",
+			Help: "Total number of alert notification deliveries by receiver and status",
+		},
+		[]string{"receiver", "status"},
+	)
+
+	// AlertDeliveryDuration длительность одной попытки доставки оповещения
+	AlertDeliveryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alert_delivery_duration_seconds",
+			Help:    "Alert notification delivery attempt duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"receiver"},
+	)
+
+	// AlertsDropped оповещения, отброшенные из-за переполнения очереди
+	AlertsDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alerts_dropped_total",
+			Help: "Total number of alerts dropped because the notification queue was full",
+		},
+	)
+
+	// IncidentEvents события жизненного цикла инцидентов
+	IncidentEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomaly_incident_events_total",
+			Help: "Total number of anomaly incident lifecycle events",
+		},
+		[]string{"event"},
+	)
+
+	// OpenIncidents открытые инциденты
+	OpenIncidents = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "anomaly_incidents_open",
+			Help: "Number of currently open anomaly incidents",
+		},
+	)
+
+	// StreamSubscribers активные подписчики потока результатов
+	StreamSubscribers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "stream_subscribers",
+			Help: "Number of active analysis result stream subscribers",
+		},
+	)
+
+	// StreamDroppedSubscribers подписчики, отключенные из-за медленного чтения
+	StreamDroppedSubscribers = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "stream_dropped_subscribers_total",
+			Help: "Total number of stream subscribers dropped for being too slow",
+		},
+	)
+
+	// MQTTConnected состояние подключения к MQTT брокеру (1 - подключен)
+	MQTTConnected = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mqtt_connected",
+			Help: "Whether the MQTT subscriber is connected to the broker",
+		},
+	)
+
+	// MQTTMessages сообщения, полученные из MQTT
+	MQTTMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mqtt_messages_total",
+			Help: "Total number of MQTT messages by processing result",
+		},
+		[]string{"result"},
+	)
+
+	// UDPPackets полученные UDP пакеты с метриками
+	UDPPackets = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "udp_packets_total",
+			Help: "Total number of UDP metric packets received",
+		},
+	)
+
+	// UDPMalformedLines строки UDP пакетов, которые не удалось разобрать
+	UDPMalformedLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "udp_malformed_lines_total",
+			Help: "Total number of malformed StatsD/line protocol lines",
+		},
+		[]string{"format", "reason"},
+	)
+
+	// ResultSubscriberBuffered заполненность буферов подписчиков анализатора
+	ResultSubscriberBuffered = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "result_subscriber_buffered",
+			Help: "Number of analysis results buffered for each subscriber",
+		},
+		[]string{"subscriber"},
+	)
+
+	// ResultSubscriberDropped результаты, отброшенные для подписчиков анализатора
+	ResultSubscriberDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "result_subscriber_dropped_total",
+			Help: "Total number of analysis results dropped for each subscriber",
+		},
+		[]string{"subscriber"},
+	)
+
+	// LateSamplesReordered опоздавшие метрики, вставленные в окно по времени
+	LateSamplesReordered = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "late_samples_reordered_total",
+			Help: "Total number of late samples inserted into the window in timestamp order",
+		},
+	)
+
+	// LateSamplesDropped метрики, опоздавшие больше допустимого и отброшенные
+	LateSamplesDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "late_samples_dropped_total",
+			Help: "Total number of samples dropped for exceeding the allowed lateness",
+		},
+	)
+
+	// BackfillMetrics метрики, проанализированные заданиями загрузки истории
+	BackfillMetrics = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backfill_metrics_total",
+			Help: "Total number of historical metrics replayed by backfill jobs",
+		},
+		[]string{"status"},
+	)
 )
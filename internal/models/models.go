@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Metric представляет метрику от IoT устройства
 type Metric struct {
@@ -9,18 +12,99 @@ type Metric struct {
 	CPU       float64   `json:"cpu"`
 	RPS       float64   `json:"rps"`
 	Memory    float64   `json:"memory,omitempty"`
+	// Tags произвольные метки устройства (площадка, стойка и т.п.)
+	Tags map[string]string `json:"tags,omitempty"`
+	// MessageID идентификатор отправки для отбрасывания повторов
+	MessageID string `json:"message_id,omitempty"`
 }
 
 // AnalyticsResult результат анализа метрик
 type AnalyticsResult struct {
-	DeviceID      string    `json:"device_id"`
-	Timestamp     time.Time `json:"timestamp"`
-	RollingAvgCPU float64   `json:"rolling_avg_cpu"`
-	RollingAvgRPS float64   `json:"rolling_avg_rps"`
-	IsAnomaly     bool      `json:"is_anomaly"`
-	AnomalyScore  float64   `json:"anomaly_score"`
-	AnomalyType   string    `json:"anomaly_type,omitempty"`
-	StandardDev   float64   `json:"standard_dev"`
+	DeviceID      string            `json:"device_id"`
+	Timestamp     time.Time         `json:"timestamp"`
+	RollingAvgCPU float64           `json:"rolling_avg_cpu"`
+	RollingAvgRPS float64           `json:"rolling_avg_rps"`
+	IsAnomaly     bool              `json:"is_anomaly"`
+	AnomalyScore  float64           `json:"anomaly_score"`
+	AnomalyType   string            `json:"anomaly_type,omitempty"`
+	StandardDev   float64           `json:"standard_dev"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// Статусы разметки аномалий
+const (
+	AnomalyAcknowledged  = "acknowledged"
+	AnomalyFalsePositive = "false_positive"
+	AnomalyConfirmed     = "confirmed"
+)
+
+// AnomalyStatusUpdate запрос на изменение статуса аномалии
+type AnomalyStatusUpdate struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Note   string `json:"note,omitempty"`
+	Author string `json:"author"`
+}
+
+// BatchItemError ошибка отдельной записи пакетной загрузки
+type BatchItemError struct {
+	// Index порядковый номер записи, начиная с 0
+	Index int `json:"index"`
+	// Line номер строки для NDJSON и CSV, начиная с 1
+	Line     int    `json:"line,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	Error    string `json:"error"`
+}
+
+// BatchResponse результат пакетной загрузки метрик
+type BatchResponse struct {
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	Accepted  int    `json:"accepted"`
+	Forwarded int    `json:"forwarded"`
+	Rejected  int    `json:"rejected"`
+	// Duplicates записи с уже принятым message_id, не попавшие в анализ повторно
+	Duplicates int `json:"duplicates,omitempty"`
+	// Errors ошибки отдельных записей; список ограничен, остальные только учитываются в Rejected
+	Errors          []BatchItemError `json:"errors,omitempty"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+	// Error причина прерывания загрузки; принятые до нее записи остаются принятыми
+	Error string `json:"error,omitempty"`
+}
+
+// Действия клиента WebSocket-подписки
+const (
+	StreamSubscribe   = "subscribe"
+	StreamUnsubscribe = "unsubscribe"
+)
+
+// StreamCommand команда клиента WebSocket-подписки
+type StreamCommand struct {
+	Action       string   `json:"action"`
+	DeviceIDs    []string `json:"device_ids,omitempty"`
+	AnomalyTypes []string `json:"anomaly_types,omitempty"`
+}
+
+// StreamMessage сообщение сервера WebSocket-подписки
+type StreamMessage struct {
+	// Type тип сообщения: result, subscriptions или error
+	Type         string           `json:"type"`
+	ID           uint64           `json:"id,omitempty"`
+	Data         *AnalyticsResult `json:"data,omitempty"`
+	Active       bool             `json:"active,omitempty"`
+	DeviceIDs    []string         `json:"device_ids,omitempty"`
+	AnomalyTypes []string         `json:"anomaly_types,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// AnomalyLabel разметка аномалии оператором вместе с копией самой аномалии
+type AnomalyLabel struct {
+	Key       string          `json:"key"`
+	Status    string          `json:"status"`
+	Note      string          `json:"note,omitempty"`
+	Author    string          `json:"author"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Anomaly   json.RawMessage `json:"anomaly"`
 }
 
 // Config конфигурация приложения
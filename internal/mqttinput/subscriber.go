@@ -0,0 +1,229 @@
+package mqttinput
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"highload-final/internal/ingest"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// DeviceIDPlaceholder место идентификатора устройства в шаблоне топика
+const DeviceIDPlaceholder = "{device_id}"
+
+// Config параметры MQTT подписчика
+type Config struct {
+	// Broker адрес брокера, например tcp://mosquitto:1883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Topic шаблон топика с {device_id}, например devices/{device_id}/metrics
+	Topic string
+	QoS   byte
+	// ForwardTimeout ограничивает пересылку метрик чужих устройств владельцу
+	ForwardTimeout time.Duration
+	// IngestTimeout сколько ждать места в очереди анализа перед сбросом соединения
+	IngestTimeout time.Duration
+}
+
+// Subscriber принимает метрики из MQTT и передает их в общий конвейер приема.
+// Сообщения QoS 1 подтверждаются только после постановки метрики в очередь анализа.
+// Неподтвержденное сообщение занимает окно inflight брокера и само по себе
+// повторно не доставляется, поэтому при заполненной очереди подписчик ждет
+// до IngestTimeout, а затем разрывает соединение: после переподключения
+// брокер доставит неподтвержденные сообщения постоянной сессии заново.
+type Subscriber struct {
+	config      Config
+	pipeline    *ingest.Pipeline
+	client      mqtt.Client
+	filter      string
+	deviceLevel int
+
+	reconnecting atomic.Bool
+	stopped      atomic.Bool
+}
+
+// NewSubscriber создает подписчика
+func NewSubscriber(config Config, pipeline *ingest.Pipeline) (*Subscriber, error) {
+	filter, deviceLevel, err := parseTopic(config.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if config.QoS > 1 {
+		return nil, fmt.Errorf("unsupported MQTT QoS %d", config.QoS)
+	}
+	if config.ForwardTimeout <= 0 {
+		config.ForwardTimeout = 5 * time.Second
+	}
+	if config.IngestTimeout <= 0 {
+		config.IngestTimeout = 5 * time.Second
+	}
+
+	s := &Subscriber{
+		config:      config,
+		pipeline:    pipeline,
+		filter:      filter,
+		deviceLevel: deviceLevel,
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		// Постоянная сессия нужна, чтобы неподтвержденные сообщения доставлялись после переподключения
+		SetCleanSession(false).
+		SetAutoAckDisabled(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetOnConnectHandler(s.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			metrics.MQTTConnected.Set(0)
+			log.Printf("MQTT connection lost: %v\n", err)
+		})
+	s.client = mqtt.NewClient(opts)
+
+	return s, nil
+}
+
+// Start подключается к брокеру; подписка восстанавливается при каждом переподключении
+func (s *Subscriber) Start() {
+	// С SetConnectRetry токен завершится только после успешного подключения,
+	// поэтому не ждем его и не блокируем запуск сервиса
+	s.client.Connect()
+}
+
+// Stop отключается от брокера
+func (s *Subscriber) Stop() {
+	s.stopped.Store(true)
+	s.client.Disconnect(250)
+	metrics.MQTTConnected.Set(0)
+}
+
+// onConnect подписывается на топик после (пере)подключения
+func (s *Subscriber) onConnect(client mqtt.Client) {
+	metrics.MQTTConnected.Set(1)
+	token := client.Subscribe(s.filter, s.config.QoS, s.handleMessage)
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Printf("MQTT subscribe to %s failed: %v\n", s.filter, token.Error())
+			return
+		}
+		log.Printf("MQTT subscribed to %s (QoS %d)\n", s.filter, s.config.QoS)
+	}()
+}
+
+// handleMessage разбирает сообщение и подтверждает его при успешном приеме
+func (s *Subscriber) handleMessage(_ mqtt.Client, msg mqtt.Message) {
+	metric, err := s.parse(msg.Topic(), msg.Payload())
+	if err != nil {
+		// Повторная доставка некорректного сообщения ничего не изменит
+		metrics.MetricsRejected.WithLabelValues("mqtt", ingest.Reason(err)).Inc()
+		metrics.MQTTMessages.WithLabelValues("invalid").Inc()
+		msg.Ack()
+		return
+	}
+
+	if owner, remote := s.pipeline.RemoteOwner(metric.DeviceID); remote {
+		body, _ := json.Marshal(metric)
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.ForwardTimeout)
+		defer cancel()
+		if err := s.pipeline.Cluster().Forward(ctx, owner, "/metrics", body); err != nil {
+			metrics.MQTTMessages.WithLabelValues("forward_failed").Inc()
+			s.redeliver(err)
+			return
+		}
+		metrics.MQTTMessages.WithLabelValues("forwarded").Inc()
+		msg.Ack()
+		return
+	}
+
+	// Ждем места в очереди анализа: пока сообщение не подтверждено, оно занимает окно inflight
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.IngestTimeout)
+	defer cancel()
+	err = s.pipeline.IngestWait(ctx, metric)
+	if errors.Is(err, ingest.ErrDuplicate) {
+		// Повтор уже принятого сообщения подтверждаем, чтобы брокер перестал его доставлять
+		metrics.MetricsDuplicates.WithLabelValues("mqtt").Inc()
+		metrics.MQTTMessages.WithLabelValues("duplicate").Inc()
+		msg.Ack()
+		return
+	}
+	if err != nil {
+		metrics.MetricsRejected.WithLabelValues("mqtt", ingest.Reason(err)).Inc()
+		metrics.MQTTMessages.WithLabelValues("rejected").Inc()
+		s.redeliver(err)
+		return
+	}
+
+	metrics.MQTTMessages.WithLabelValues("accepted").Inc()
+	msg.Ack()
+}
+
+// redeliver разрывает соединение с брокером и подключается заново, не подтверждая сообщение.
+// Брокер повторяет неподтвержденные сообщения только при переподключении постоянной сессии,
+// а без этого они заняли бы окно inflight и подписка остановилась бы.
+func (s *Subscriber) redeliver(cause error) {
+	if s.stopped.Load() || !s.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("MQTT message not accepted: %v, reconnecting for redelivery\n", cause)
+	// Disconnect ждет завершения обработчиков, поэтому вызывается вне обработчика сообщения
+	go func() {
+		defer s.reconnecting.Store(false)
+		s.client.Disconnect(250)
+		metrics.MQTTConnected.Set(0)
+		if s.stopped.Load() {
+			return
+		}
+		s.client.Connect()
+	}()
+}
+
+// parse преобразует сообщение в метрику; идентификатор устройства берется из топика
+func (s *Subscriber) parse(topic string, payload []byte) (models.Metric, error) {
+	var metric models.Metric
+	if err := json.Unmarshal(payload, &metric); err != nil {
+		return metric, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	levels := strings.Split(topic, "/")
+	if s.deviceLevel < len(levels) {
+		metric.DeviceID = levels[s.deviceLevel]
+	}
+
+	if err := s.pipeline.Validate(&metric); err != nil {
+		return metric, err
+	}
+	return metric, nil
+}
+
+// parseTopic превращает шаблон топика в фильтр подписки и номер уровня с идентификатором устройства
+func parseTopic(topic string) (string, int, error) {
+	levels := strings.Split(topic, "/")
+	deviceLevel := -1
+	for i, level := range levels {
+		if level == DeviceIDPlaceholder {
+			if deviceLevel >= 0 {
+				return "", 0, errors.New("MQTT topic must contain a single " + DeviceIDPlaceholder)
+			}
+			deviceLevel = i
+			levels[i] = "+"
+		}
+	}
+	if deviceLevel < 0 {
+		return "", 0, fmt.Errorf("MQTT topic %q must contain %s", topic, DeviceIDPlaceholder)
+	}
+	return strings.Join(levels, "/"), deviceLevel, nil
+}
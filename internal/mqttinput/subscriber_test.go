@@ -0,0 +1,189 @@
+package mqttinput
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/cache"
+	"highload-final/internal/ingest"
+)
+
+// startBroker запускает MQTT брокер в процессе и возвращает его адрес
+func startBroker(t *testing.T) (*server.Server, string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	broker := server.New(&server.Options{InlineClient: true})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	go broker.Serve()
+	t.Cleanup(func() { broker.Close() })
+	return broker, "tcp://" + addr
+}
+
+// newPipeline создает конвейер с анализатором и кэшем без Redis
+func newPipeline(t *testing.T, analyzer *analytics.Analyzer) *ingest.Pipeline {
+	t.Helper()
+
+	redis, err := cache.NewRedisCache(cache.Options{
+		Mode:                cache.ModeSingle,
+		Addrs:               []string{"127.0.0.1:1"},
+		TTL:                 time.Minute,
+		ReconnectMinBackoff: time.Hour,
+		ReconnectMaxBackoff: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redis.Close() })
+
+	pipeline := ingest.NewPipeline(analyzer, redis)
+	pipeline.SetDeduplicator(ingest.NewMemoryDeduplicator(100, time.Minute))
+	return pipeline
+}
+
+// startSubscriber подключает подписчика к брокеру и ждет подписки
+func startSubscriber(t *testing.T, broker *server.Server, url string, config Config, pipeline *ingest.Pipeline) *Subscriber {
+	t.Helper()
+
+	config.Broker = url
+	config.ClientID = "test-" + t.Name()
+	config.Topic = "devices/" + DeviceIDPlaceholder + "/metrics"
+	config.QoS = 1
+	s, err := NewSubscriber(config, pipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	waitFor(t, 5*time.Second, func() bool {
+		cl, ok := broker.Clients.Get(config.ClientID)
+		return ok && len(cl.State.Subscriptions.GetAll()) > 0
+	})
+	return s
+}
+
+// waitFor ждет выполнения условия
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receive ждет результат анализа устройства
+func receive(t *testing.T, results <-chan analytics.AnalysisResult, timeout time.Duration) analytics.AnalysisResult {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(timeout):
+		t.Fatal("no analysis result")
+		return analytics.AnalysisResult{}
+	}
+}
+
+func TestSubscriberAcceptsAndAcks(t *testing.T) {
+	broker, url := startBroker(t)
+	analyzer := analytics.NewAnalyzer(10, 2)
+	analyzer.Start(1)
+	t.Cleanup(analyzer.Stop)
+
+	results, unsubscribe := analyzer.Subscribe(func(r analytics.AnalysisResult) bool {
+		return r.DeviceID == "sensor-1"
+	}, analytics.SubscribeOptions{BufferSize: 10})
+	defer unsubscribe()
+
+	s := startSubscriber(t, broker, url, Config{}, newPipeline(t, analyzer))
+
+	if err := broker.Publish("devices/sensor-1/metrics", []byte(`{"cpu":42,"rps":100}`), false, 1); err != nil {
+		t.Fatal(err)
+	}
+	result := receive(t, results, 5*time.Second)
+	if result.RollingAvgCPU != 42 {
+		t.Errorf("rolling avg cpu = %g, want 42", result.RollingAvgCPU)
+	}
+
+	// Подтвержденное сообщение освобождает окно inflight брокера
+	waitFor(t, 5*time.Second, func() bool {
+		cl, ok := broker.Clients.Get(s.config.ClientID)
+		return ok && cl.State.Inflight.Len() == 0
+	})
+}
+
+func TestSubscriberAcksInvalidPayload(t *testing.T) {
+	broker, url := startBroker(t)
+	analyzer := analytics.NewAnalyzer(10, 2)
+	analyzer.Start(1)
+	t.Cleanup(analyzer.Stop)
+
+	s := startSubscriber(t, broker, url, Config{}, newPipeline(t, analyzer))
+
+	for _, payload := range []string{`not json`, `{"cpu":-5}`} {
+		if err := broker.Publish("devices/sensor-1/metrics", []byte(payload), false, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Повторная доставка некорректного сообщения бесполезна, оно подтверждается сразу
+	waitFor(t, 5*time.Second, func() bool {
+		cl, ok := broker.Clients.Get(s.config.ClientID)
+		return ok && cl.State.Inflight.Len() == 0
+	})
+}
+
+func TestSubscriberRedeliversWhenQueueFull(t *testing.T) {
+	broker, url := startBroker(t)
+	analyzer := analytics.NewAnalyzer(10, 2)
+	t.Cleanup(analyzer.Stop)
+
+	results, unsubscribe := analyzer.Subscribe(func(r analytics.AnalysisResult) bool {
+		return r.DeviceID == "sensor-2"
+	}, analytics.SubscribeOptions{BufferSize: 10})
+	defer unsubscribe()
+
+	// Анализатор не запущен: заполняем очередь, чтобы сообщение нельзя было принять
+	for analyzer.AddMetric(analytics.MetricData{DeviceID: "filler", Timestamp: time.Now()}) {
+	}
+
+	startSubscriber(t, broker, url, Config{IngestTimeout: 50 * time.Millisecond}, newPipeline(t, analyzer))
+
+	if err := broker.Publish("devices/sensor-2/metrics", []byte(`{"cpu":7,"rps":1}`), false, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-results:
+		t.Fatal("message accepted while queue is full")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// После освобождения очереди брокер доставляет неподтвержденное сообщение заново
+	analyzer.Start(1)
+	result := receive(t, results, 10*time.Second)
+	if result.RollingAvgCPU != 7 {
+		t.Errorf("rolling avg cpu = %g, want 7", result.RollingAvgCPU)
+	}
+}
@@ -0,0 +1,283 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// Config параметры отображения OTLP метрик
+type Config struct {
+	// DeviceAttributes атрибуты ресурса, проверяемые по порядку для получения device_id
+	DeviceAttributes []string
+	Mappings         []ingest.FieldMapping
+}
+
+// Хранение состояния кумулятивных рядов
+const (
+	// cumulativeTTL сколько хранится состояние ряда, от которого нет новых точек
+	cumulativeTTL = 10 * time.Minute
+	// cumulativeSweepInterval как часто удаляются устаревшие ряды
+	cumulativeSweepInterval = time.Minute
+)
+
+// cumulativeState предыдущее значение монотонной кумулятивной суммы
+type cumulativeState struct {
+	start int64
+	time  int64
+	value float64
+	// updated время сервера при последней точке ряда
+	updated time.Time
+}
+
+// aggregate значения одного поля устройства в момент времени
+type aggregate struct {
+	sum   float64
+	count int
+	// mean для gauge берется среднее по наборам атрибутов, для сумм - общая сумма
+	mean bool
+}
+
+// Mapper отображает OTLP метрики в метрики устройств.
+// Gauge передаются как есть (среднее по наборам атрибутов), монотонные суммы
+// и количество измерений гистограмм (например, http.server.request.duration)
+// переводятся в скорость в секунду и суммируются по наборам атрибутов.
+type Mapper struct {
+	config     Config
+	byName     map[string]ingest.FieldMapping
+	merger     *ingest.Merger
+	cumulative map[string]cumulativeState
+	lastSweep  time.Time
+	mu         sync.Mutex
+}
+
+// NewMapper создает отображение
+func NewMapper(config Config) *Mapper {
+	if len(config.DeviceAttributes) == 0 {
+		config.DeviceAttributes = []string{"host.name", "service.instance.id"}
+	}
+	byName := make(map[string]ingest.FieldMapping, len(config.Mappings))
+	for _, m := range config.Mappings {
+		byName[m.Series] = m
+	}
+	return &Mapper{
+		config:     config,
+		byName:     byName,
+		merger:     ingest.NewMerger("otlp", config.Mappings),
+		cumulative: make(map[string]cumulativeState),
+	}
+}
+
+// pointKey поле устройства в момент времени
+type pointKey struct {
+	deviceID string
+	time     int64
+	field    string
+}
+
+// Map возвращает метрики, упорядоченные по времени, и количество точек сопоставленных
+// метрик, которые не удалось использовать (нет device_id, неподдерживаемый тип)
+func (m *Mapper) Map(req *colmetricspb.ExportMetricsServiceRequest) ([]models.Metric, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= cumulativeSweepInterval {
+		m.expire(now)
+	}
+
+	var rejected int64
+	aggregates := make(map[pointKey]*aggregate)
+	add := func(key pointKey, value float64, mean bool) {
+		agg := aggregates[key]
+		if agg == nil {
+			agg = &aggregate{mean: mean}
+			aggregates[key] = agg
+		}
+		agg.sum += value
+		agg.count++
+	}
+
+	for _, rm := range req.GetResourceMetrics() {
+		deviceID := m.deviceID(rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				mapping, ok := m.byName[metric.GetName()]
+				if !ok {
+					continue
+				}
+
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					if deviceID == "" {
+						rejected += int64(len(data.Gauge.GetDataPoints()))
+						continue
+					}
+					for _, dp := range data.Gauge.GetDataPoints() {
+						value, ok := pointValue(dp)
+						if !ok {
+							continue
+						}
+						key := pointKey{deviceID: deviceID, time: int64(dp.GetTimeUnixNano()), field: mapping.Field}
+						add(key, value*mapping.Scale, true)
+					}
+
+				case *metricspb.Metric_Sum:
+					if deviceID == "" {
+						rejected += int64(len(data.Sum.GetDataPoints()))
+						continue
+					}
+					for _, dp := range data.Sum.GetDataPoints() {
+						value, ok := pointValue(dp)
+						if !ok {
+							continue
+						}
+						if data.Sum.GetIsMonotonic() {
+							key := seriesKey(deviceID, metric.GetName(), dp.GetAttributes())
+							value, ok = m.rate(key, data.Sum.GetAggregationTemporality(), dp.GetStartTimeUnixNano(), dp.GetTimeUnixNano(), value, now)
+							if !ok {
+								continue
+							}
+						}
+						key := pointKey{deviceID: deviceID, time: int64(dp.GetTimeUnixNano()), field: mapping.Field}
+						add(key, value*mapping.Scale, false)
+					}
+
+				case *metricspb.Metric_Histogram:
+					if deviceID == "" {
+						rejected += int64(len(data.Histogram.GetDataPoints()))
+						continue
+					}
+					for _, dp := range data.Histogram.GetDataPoints() {
+						if dp.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+							continue
+						}
+						key := seriesKey(deviceID, metric.GetName(), dp.GetAttributes())
+						value, ok := m.rate(key, data.Histogram.GetAggregationTemporality(), dp.GetStartTimeUnixNano(), dp.GetTimeUnixNano(), float64(dp.GetCount()), now)
+						if !ok {
+							continue
+						}
+						pk := pointKey{deviceID: deviceID, time: int64(dp.GetTimeUnixNano()), field: mapping.Field}
+						add(pk, value*mapping.Scale, false)
+					}
+
+				default:
+					rejected += int64(dataPointCount(metric))
+				}
+			}
+		}
+	}
+
+	points := make([]ingest.Point, 0, len(aggregates))
+	for key, agg := range aggregates {
+		value := agg.sum
+		if agg.mean {
+			value /= float64(agg.count)
+		}
+		points = append(points, ingest.Point{
+			DeviceID:  key.deviceID,
+			Timestamp: time.Unix(0, key.time),
+			Field:     key.field,
+			Value:     value,
+		})
+	}
+	return m.merger.Merge(points), rejected
+}
+
+// deviceID возвращает первый найденный атрибут ресурса из настроенного списка
+func (m *Mapper) deviceID(attrs []*commonpb.KeyValue) string {
+	for _, name := range m.config.DeviceAttributes {
+		for _, kv := range attrs {
+			if kv.GetKey() == name && kv.GetValue().GetStringValue() != "" {
+				return kv.GetValue().GetStringValue()
+			}
+		}
+	}
+	return ""
+}
+
+// rate переводит значение монотонного счетчика в скорость в секунду.
+// Для кумулятивных счетчиков нужна предыдущая точка того же ряда, поэтому первая точка
+// ряда и точка после сброса счетчика только запоминаются.
+func (m *Mapper) rate(key string, temporality metricspb.AggregationTemporality, startNano, timeNano uint64, value float64, received time.Time) (float64, bool) {
+	start, now := int64(startNano), int64(timeNano)
+
+	if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		if now <= start {
+			return 0, false
+		}
+		return value / time.Duration(now-start).Seconds(), true
+	}
+
+	prev, seen := m.cumulative[key]
+	if seen && now <= prev.time {
+		// Повтор или точка из прошлого
+		return 0, false
+	}
+	m.cumulative[key] = cumulativeState{start: start, time: now, value: value, updated: received}
+
+	if !seen || prev.start != start || value < prev.value {
+		return 0, false
+	}
+	return (value - prev.value) / time.Duration(now-prev.time).Seconds(), true
+}
+
+// expire удаляет состояние рядов, от которых давно нет точек (остановленные
+// экземпляры, исчезнувшие наборы атрибутов); вызывается под m.mu
+func (m *Mapper) expire(now time.Time) {
+	for key, state := range m.cumulative {
+		if now.Sub(state.updated) >= cumulativeTTL {
+			delete(m.cumulative, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// pointValue возвращает значение точки; точки без значения и NaN пропускаются
+func pointValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	if dp.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+		return 0, false
+	}
+
+	var value float64
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(v.AsInt)
+	default:
+		return 0, false
+	}
+	return value, !math.IsNaN(value)
+}
+
+// seriesKey возвращает ключ ряда: устройство, метрика и набор атрибутов точки
+func seriesKey(deviceID, name string, attrs []*commonpb.KeyValue) string {
+	parts := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		parts = append(parts, kv.GetKey()+"="+kv.GetValue().String())
+	}
+	sort.Strings(parts)
+	return deviceID + "\x00" + name + "\x00" + strings.Join(parts, ",")
+}
+
+// dataPointCount количество точек метрики неподдерживаемого типа
+func dataPointCount(metric *metricspb.Metric) int {
+	switch data := metric.GetData().(type) {
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"highload-final/internal/ingest"
+)
+
+const (
+	cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+)
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// nanos время через n секунд от base
+func nanos(n int) uint64 {
+	return uint64(base.Add(time.Duration(n) * time.Second).UnixNano())
+}
+
+func newTestMapper() *Mapper {
+	return NewMapper(Config{Mappings: []ingest.FieldMapping{
+		{Field: ingest.FieldCPU, Series: "system.cpu.utilization", Scale: 100},
+		{Field: ingest.FieldRPS, Series: "http.server.requests", Scale: 1},
+	}})
+}
+
+func attr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func point(at uint64, value float64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		StartTimeUnixNano: nanos(0),
+		TimeUnixNano:      at,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+		Attributes:        attrs,
+	}
+}
+
+func gauge(name string, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}}}
+}
+
+func sum(name string, temporality metricspb.AggregationTemporality, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		DataPoints:             points,
+		AggregationTemporality: temporality,
+		IsMonotonic:            true,
+	}}}
+}
+
+// request запрос с метриками одного ресурса
+func request(resource []*commonpb.KeyValue, metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: resource},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func TestMapperGauge(t *testing.T) {
+	m := newTestMapper()
+
+	batch, rejected := m.Map(request(
+		[]*commonpb.KeyValue{attr("service.instance.id", "i-1"), attr("host.name", "web-1")},
+		// Gauge усредняется по наборам атрибутов
+		gauge("system.cpu.utilization", point(nanos(10), 0.2, attr("cpu", "0")), point(nanos(10), 0.4, attr("cpu", "1"))),
+		sum("http.server.requests", delta, point(nanos(10), 50)),
+		gauge("unmapped", point(nanos(10), 1)),
+	))
+
+	if rejected != 0 {
+		t.Errorf("rejected = %d, want 0", rejected)
+	}
+	if len(batch) != 1 {
+		t.Fatalf("batch = %+v, want one metric", batch)
+	}
+	metric := batch[0]
+	// host.name проверяется раньше service.instance.id
+	if metric.DeviceID != "web-1" || metric.CPU != 30 || metric.RPS != 5 || !metric.Timestamp.Equal(base.Add(10*time.Second)) {
+		t.Errorf("metric = %+v, want web-1 with cpu 30 and rps 5", metric)
+	}
+}
+
+func TestMapperRejected(t *testing.T) {
+	m := newTestMapper()
+
+	summary := &metricspb.Metric{Name: "http.server.requests", Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+		DataPoints: []*metricspb.SummaryDataPoint{{TimeUnixNano: nanos(10)}},
+	}}}
+	tests := []struct {
+		name string
+		req  *colmetricspb.ExportMetricsServiceRequest
+		want int64
+	}{
+		{"no device attribute", request([]*commonpb.KeyValue{attr("service.name", "api")}, gauge("system.cpu.utilization", point(nanos(10), 0.2), point(nanos(20), 0.3))), 2},
+		{"unsupported type", request([]*commonpb.KeyValue{attr("host.name", "web-1")}, summary), 1},
+		{"unmapped metric is ignored", request(nil, gauge("unmapped", point(nanos(10), 1))), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, rejected := m.Map(tt.req)
+			if len(batch) != 0 || rejected != tt.want {
+				t.Errorf("Map() = %+v, %d; want no metrics and %d rejected", batch, rejected, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapperCumulativeRate(t *testing.T) {
+	m := newTestMapper()
+	resource := []*commonpb.KeyValue{attr("host.name", "web-1")}
+	// export отправляет CPU и накопленное число запросов в момент n
+	export := func(n int, requests float64) []float64 {
+		batch, _ := m.Map(request(resource,
+			gauge("system.cpu.utilization", point(nanos(n), 0.5)),
+			sum("http.server.requests", cumulative, point(nanos(n), requests)),
+		))
+		var rps []float64
+		for _, metric := range batch {
+			rps = append(rps, metric.RPS)
+		}
+		return rps
+	}
+
+	// Первая точка ряда только запоминается
+	if rps := export(10, 100); len(rps) != 0 {
+		t.Errorf("first cumulative point produced %v", rps)
+	}
+	if rps := export(20, 300); len(rps) != 1 || rps[0] != 20 {
+		t.Errorf("rps = %v, want [20]", rps)
+	}
+	// Сброс счетчика: значение меньше предыдущего
+	if rps := export(30, 50); len(rps) != 0 {
+		t.Errorf("counter reset produced %v", rps)
+	}
+	if rps := export(40, 150); len(rps) != 1 || rps[0] != 10 {
+		t.Errorf("rps = %v, want [10]", rps)
+	}
+	// Повтор точки
+	if rps := export(40, 150); len(rps) != 0 {
+		t.Errorf("repeated point produced %v", rps)
+	}
+}
+
+func TestMapperHistogramCount(t *testing.T) {
+	m := newTestMapper()
+	m.byName["http.server.request.duration"] = ingest.FieldMapping{Field: ingest.FieldRPS, Series: "http.server.request.duration", Scale: 1}
+
+	histogram := &metricspb.Metric{Name: "http.server.request.duration", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+		AggregationTemporality: delta,
+		DataPoints: []*metricspb.HistogramDataPoint{
+			{StartTimeUnixNano: nanos(0), TimeUnixNano: nanos(10), Count: 40, Attributes: []*commonpb.KeyValue{attr("route", "/a")}},
+			{StartTimeUnixNano: nanos(0), TimeUnixNano: nanos(10), Count: 60, Attributes: []*commonpb.KeyValue{attr("route", "/b")}},
+			{StartTimeUnixNano: nanos(0), TimeUnixNano: nanos(10), Count: 999, Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)},
+		},
+	}}}
+	batch, _ := m.Map(request([]*commonpb.KeyValue{attr("host.name", "web-1")},
+		gauge("system.cpu.utilization", point(nanos(10), 0.5)),
+		histogram,
+	))
+
+	// Скорость суммируется по наборам атрибутов
+	if len(batch) != 1 || batch[0].RPS != 10 {
+		t.Errorf("batch = %+v, want rps 10", batch)
+	}
+}
+
+func TestMapperExpiresCumulativeState(t *testing.T) {
+	m := newTestMapper()
+	now := time.Now()
+	m.cumulative["stale"] = cumulativeState{updated: now.Add(-cumulativeTTL)}
+	m.cumulative["fresh"] = cumulativeState{updated: now.Add(-time.Second)}
+
+	m.expire(now)
+
+	if _, ok := m.cumulative["stale"]; ok {
+		t.Error("stale series state was not removed")
+	}
+	if _, ok := m.cumulative["fresh"]; !ok {
+		t.Error("fresh series state was removed")
+	}
+
+	// Состояние ряда, от которого нет точек, удаляется при очередном запросе
+	m.cumulative["stale"] = cumulativeState{updated: now.Add(-cumulativeTTL)}
+	m.lastSweep = now.Add(-cumulativeSweepInterval)
+	m.Map(request(nil))
+	if _, ok := m.cumulative["stale"]; ok {
+		t.Error("Map did not sweep stale series state")
+	}
+}
@@ -0,0 +1,168 @@
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label метка временного ряда
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample значение ряда; Timestamp в миллисекундах Unix
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries временной ряд из запроса remote_write
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Get возвращает значение метки
+func (ts TimeSeries) Get(name string) string {
+	for _, l := range ts.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// ErrMalformed тело запроса не является корректным WriteRequest
+var ErrMalformed = errors.New("malformed remote write request")
+
+// Номера полей prometheus.WriteRequest и вложенных сообщений
+const (
+	fieldTimeSeries = 1
+
+	fieldLabels  = 1
+	fieldSamples = 2
+
+	fieldLabelName  = 1
+	fieldLabelValue = 2
+
+	fieldSampleValue     = 1
+	fieldSampleTimestamp = 2
+)
+
+// Decode разбирает несжатый prometheus.WriteRequest.
+// Поля, не относящиеся к рядам и значениям (метаданные, exemplars, гистограммы), пропускаются.
+func Decode(data []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := walk(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != fieldTimeSeries || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walk(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case fieldLabels:
+			l, err := decodeLabel(v)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case fieldSamples:
+			s, err := decodeSample(v)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(data []byte) (Label, error) {
+	var l Label
+	err := walk(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case fieldLabelName:
+			l.Name = string(v)
+		case fieldLabelValue:
+			l.Value = string(v)
+		}
+		return nil
+	})
+	return l, err
+}
+
+func decodeSample(data []byte) (Sample, error) {
+	var s Sample
+	err := walk(data, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) error {
+		switch {
+		case num == fieldSampleValue && typ == protowire.Fixed64Type:
+			s.Value = math.Float64frombits(n)
+		case num == fieldSampleTimestamp && typ == protowire.VarintType:
+			s.Timestamp = int64(n)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// walk перебирает поля сообщения. Для BytesType передается содержимое,
+// для varint и fixed-типов - числовое значение.
+func walk(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var (
+			v   []byte
+			val uint64
+		)
+		switch typ {
+		case protowire.VarintType:
+			val, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			val, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(data)
+			val = uint64(v32)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, v, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
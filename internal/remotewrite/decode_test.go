@@ -0,0 +1,91 @@
+package remotewrite
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeSeries кодирует ряды как prometheus.WriteRequest
+func encodeSeries(series ...TimeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var body []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, fieldLabelName, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, fieldLabelValue, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+			body = protowire.AppendTag(body, fieldLabels, protowire.BytesType)
+			body = protowire.AppendBytes(body, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, fieldSampleValue, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, fieldSampleTimestamp, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			body = protowire.AppendTag(body, fieldSamples, protowire.BytesType)
+			body = protowire.AppendBytes(body, sample)
+		}
+		req = protowire.AppendTag(req, fieldTimeSeries, protowire.BytesType)
+		req = protowire.AppendBytes(req, body)
+	}
+	return req
+}
+
+func TestDecode(t *testing.T) {
+	series := []TimeSeries{
+		{
+			Labels:  []Label{{"__name__", "cpu_usage"}, {"instance", "web-1"}},
+			Samples: []Sample{{Value: 0.5, Timestamp: 1700000000000}, {Value: 0.75, Timestamp: 1700000015000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "rps"}, {"instance", "web-2"}},
+			Samples: []Sample{{Value: 120, Timestamp: 1700000000000}},
+		},
+	}
+
+	data := encodeSeries(series...)
+	// Метаданные запроса пропускаются
+	data = protowire.AppendTag(data, 3, protowire.BytesType)
+	data = protowire.AppendString(data, "metadata")
+
+	got, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, series) {
+		t.Errorf("Decode() = %+v, want %+v", got, series)
+	}
+	if name := got[0].Get("__name__"); name != "cpu_usage" {
+		t.Errorf("Get(__name__) = %q", name)
+	}
+	if missing := got[0].Get("job"); missing != "" {
+		t.Errorf("Get(job) = %q, want empty", missing)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	valid := encodeSeries(TimeSeries{Labels: []Label{{"__name__", "cpu_usage"}}})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", valid[:len(valid)-1]},
+		{"invalid tag", []byte{0x00}},
+		{"truncated length", []byte{0x0a, 0x05, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, ErrMalformed) {
+				t.Errorf("Decode() error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package remotewrite
+
+import (
+	"math"
+	"time"
+
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// Config параметры отображения рядов в метрики
+type Config struct {
+	// DeviceLabel метка, значение которой становится device_id (обычно instance)
+	DeviceLabel string
+	Mappings    []ingest.FieldMapping
+}
+
+// Mapper отображает ряды remote_write в метрики устройств
+type Mapper struct {
+	config   Config
+	bySeries map[string]ingest.FieldMapping
+	merger   *ingest.Merger
+}
+
+// NewMapper создает отображение
+func NewMapper(config Config) *Mapper {
+	if config.DeviceLabel == "" {
+		config.DeviceLabel = "instance"
+	}
+	bySeries := make(map[string]ingest.FieldMapping, len(config.Mappings))
+	for _, m := range config.Mappings {
+		bySeries[m.Series] = m
+	}
+	return &Mapper{
+		config:   config,
+		bySeries: bySeries,
+		merger:   ingest.NewMerger("remote_write", config.Mappings),
+	}
+}
+
+// Map возвращает метрики, упорядоченные по времени, и количество отображенных значений.
+// Ряды без сопоставления и маркеры устаревания (NaN) пропускаются.
+func (m *Mapper) Map(series []TimeSeries) ([]models.Metric, int) {
+	var points []ingest.Point
+	for _, ts := range series {
+		mapping, ok := m.bySeries[ts.Get("__name__")]
+		if !ok {
+			continue
+		}
+		deviceID := ts.Get(m.config.DeviceLabel)
+		if deviceID == "" {
+			continue
+		}
+
+		for _, sample := range ts.Samples {
+			if math.IsNaN(sample.Value) {
+				continue
+			}
+			points = append(points, ingest.Point{
+				DeviceID:  deviceID,
+				Timestamp: time.UnixMilli(sample.Timestamp),
+				Field:     mapping.Field,
+				Value:     sample.Value * mapping.Scale,
+			})
+		}
+	}
+	return m.merger.Merge(points), len(points)
+}
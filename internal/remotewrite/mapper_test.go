@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"highload-final/internal/ingest"
+)
+
+func newTestMapper() *Mapper {
+	return NewMapper(Config{Mappings: []ingest.FieldMapping{
+		{Field: ingest.FieldCPU, Series: "cpu_ratio", Scale: 100},
+		{Field: ingest.FieldRPS, Series: "requests_rate", Scale: 1},
+	}})
+}
+
+// series возвращает ряд метрики устройства с одним значением
+func series(name, instance string, value float64, ts int64) TimeSeries {
+	return TimeSeries{
+		Labels:  []Label{{"__name__", name}, {"instance", instance}},
+		Samples: []Sample{{Value: value, Timestamp: ts}},
+	}
+}
+
+func TestMapperMap(t *testing.T) {
+	m := newTestMapper()
+
+	batch, mapped := m.Map([]TimeSeries{
+		series("cpu_ratio", "web-1", 0.5, 1000),
+		series("requests_rate", "web-1", 120, 1000),
+		series("requests_rate", "web-2", 80, 1000),
+		series("unmapped", "web-1", 1, 1000),
+		series("cpu_ratio", "", 0.5, 1000),
+		series("cpu_ratio", "web-1", math.NaN(), 2000),
+	})
+
+	if mapped != 3 {
+		t.Errorf("mapped = %d, want 3", mapped)
+	}
+	if len(batch) != 1 {
+		t.Fatalf("batch = %+v, want only the complete metric of web-1", batch)
+	}
+	metric := batch[0]
+	if metric.DeviceID != "web-1" || metric.CPU != 50 || metric.RPS != 120 || !metric.Timestamp.Equal(time.UnixMilli(1000)) {
+		t.Errorf("metric = %+v", metric)
+	}
+	// Точка web-2 без CPU ждет недостающего поля
+	if pending := m.merger.Pending(); pending != 1 {
+		t.Errorf("pending = %d, want 1", pending)
+	}
+}
+
+func TestMapperDoesNotCarryValuesForward(t *testing.T) {
+	m := newTestMapper()
+
+	// Ряды одного момента пришли в разных запросах
+	if batch, _ := m.Map([]TimeSeries{series("cpu_ratio", "web-1", 0.5, 1000)}); len(batch) != 0 {
+		t.Fatalf("incomplete metric emitted: %+v", batch)
+	}
+	batch, _ := m.Map([]TimeSeries{
+		series("requests_rate", "web-1", 120, 1000),
+		// Следующий момент известен только по CPU
+		series("cpu_ratio", "web-1", 0.7, 2000),
+	})
+	if len(batch) != 1 || batch[0].CPU != 50 || batch[0].RPS != 120 || !batch[0].Timestamp.Equal(time.UnixMilli(1000)) {
+		t.Fatalf("batch = %+v, want one metric at 1000 assembled from both requests", batch)
+	}
+
+	batch, _ = m.Map([]TimeSeries{series("requests_rate", "web-1", 90, 2000)})
+	if len(batch) != 1 || batch[0].CPU != 70 || batch[0].RPS != 90 {
+		t.Errorf("batch = %+v, want cpu 70 and rps 90 at 2000", batch)
+	}
+	if pending := m.merger.Pending(); pending != 0 {
+		t.Errorf("pending = %d, want 0", pending)
+	}
+}
+
+func TestMapperOrdersByTime(t *testing.T) {
+	m := newTestMapper()
+
+	batch, _ := m.Map([]TimeSeries{
+		{
+			Labels:  []Label{{"__name__", "cpu_ratio"}, {"instance", "web-1"}},
+			Samples: []Sample{{Value: 0.2, Timestamp: 2000}, {Value: 0.1, Timestamp: 1000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "requests_rate"}, {"instance", "web-1"}},
+			Samples: []Sample{{Value: 20, Timestamp: 2000}, {Value: 10, Timestamp: 1000}},
+		},
+	})
+
+	if len(batch) != 2 || batch[0].RPS != 10 || batch[1].RPS != 20 {
+		t.Errorf("batch = %+v, want two metrics ordered by time", batch)
+	}
+}
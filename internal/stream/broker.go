@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"slices"
+	"sync"
+
+	"highload-final/internal/analytics"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// Event результат анализа с порядковым номером для возобновления подписки
+type Event struct {
+	ID     uint64
+	Result analytics.AnalysisResult
+}
+
+// Data возвращает результат в формате API
+func (e Event) Data() models.AnalyticsResult {
+	r := e.Result
+	return models.AnalyticsResult{
+		DeviceID:      r.DeviceID,
+		Timestamp:     r.Timestamp,
+		RollingAvgCPU: r.RollingAvgCPU,
+		RollingAvgRPS: r.RollingAvgRPS,
+		IsAnomaly:     r.IsAnomaly,
+		AnomalyScore:  r.AnomalyScore,
+		AnomalyType:   r.AnomalyType,
+		StandardDev:   r.StandardDev,
+		Tags:          r.Tags,
+	}
+}
+
+// Filter условия отбора событий для подписчика.
+// Списки устройств и типов объединяются по ИЛИ: подписка на устройство и тип
+// получает все результаты устройства и аномалии этого типа на любых устройствах.
+// Пустые оба списка означают все результаты.
+type Filter struct {
+	DeviceIDs []string
+	// AnomalyTypes отбирает аномалии указанных типов
+	AnomalyTypes []string
+	// AnomaliesOnly отбирает только аномалии
+	AnomaliesOnly bool
+}
+
+// Match проверяет, подходит ли результат под фильтр
+func (f Filter) Match(result analytics.AnalysisResult) bool {
+	if f.AnomaliesOnly && !result.IsAnomaly {
+		return false
+	}
+	if len(f.DeviceIDs) == 0 && len(f.AnomalyTypes) == 0 {
+		return true
+	}
+	if slices.Contains(f.DeviceIDs, result.DeviceID) {
+		return true
+	}
+	return result.IsAnomaly && slices.Contains(f.AnomalyTypes, result.AnomalyType)
+}
+
+// Subscription подписка на события брокера
+type Subscription struct {
+	events  chan Event
+	filter  Filter
+	broker  *Broker
+	dropped bool
+}
+
+// Events возвращает канал событий; канал закрывается при отписке
+// или если подписчик не успевал читать события
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped сообщает, была ли подписка закрыта из-за медленного чтения
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.RLock()
+	defer s.broker.mu.RUnlock()
+	return s.dropped
+}
+
+// SetFilter заменяет фильтр подписки; действует для следующих событий
+func (s *Subscription) SetFilter(filter Filter) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.filter = filter
+}
+
+// Close отменяет подписку
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s, false)
+}
+
+// Broker рассылает результаты анализа подписчикам и хранит последние события
+// для возобновления подписки по Last-Event-ID
+type Broker struct {
+	subscribers map[*Subscription]struct{}
+	history     []Event
+	historyHead int
+	historyLen  int
+	bufferSize  int
+	nextID      uint64
+	closed      bool
+	mu          sync.RWMutex
+}
+
+// NewBroker создает брокер.
+// Отрицательные размеры считаются нулевыми: без буфера и без истории для переподключения.
+func NewBroker(bufferSize, historySize int) *Broker {
+	bufferSize = max(bufferSize, 0)
+	historySize = max(historySize, 0)
+	return &Broker{
+		subscribers: make(map[*Subscription]struct{}),
+		history:     make([]Event, historySize),
+		bufferSize:  bufferSize,
+		nextID:      1,
+	}
+}
+
+// Publish рассылает результат подписчикам.
+// Подписчики с заполненным буфером отключаются, чтобы не задерживать остальных.
+func (b *Broker) Publish(result analytics.AnalysisResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{ID: b.nextID, Result: result}
+	b.nextID++
+
+	// История хранится в кольцевом буфере
+	if size := len(b.history); size > 0 {
+		b.history[(b.historyHead+b.historyLen)%size] = event
+		if b.historyLen < size {
+			b.historyLen++
+		} else {
+			b.historyHead = (b.historyHead + 1) % size
+		}
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(result) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			b.removeLocked(sub, true)
+		}
+	}
+}
+
+// Subscribe создает подписку. Если lastEventID больше нуля, подписчик сначала
+// получает сохраненные события с большим номером.
+func (b *Broker) Subscribe(filter Filter, lastEventID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	if lastEventID > 0 {
+		for i := 0; i < b.historyLen; i++ {
+			event := b.history[(b.historyHead+i)%len(b.history)]
+			if event.ID > lastEventID && filter.Match(event.Result) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		events: make(chan Event, b.bufferSize+len(replay)),
+		filter: filter,
+		broker: b,
+	}
+	// После остановки брокера подписка сразу закрыта
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	for _, event := range replay {
+		sub.events <- event
+	}
+
+	b.subscribers[sub] = struct{}{}
+	metrics.StreamSubscribers.Set(float64(len(b.subscribers)))
+
+	return sub
+}
+
+// Close отключает всех подписчиков и закрывает новые подписки.
+// Вызывается при остановке сервера, чтобы долгие потоки не задерживали Shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.removeLocked(sub, false)
+	}
+}
+
+// unsubscribe удаляет подписчика
+func (b *Broker) unsubscribe(sub *Subscription, dropped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(sub, dropped)
+}
+
+// removeLocked удаляет подписчика и закрывает его канал; вызывается под b.mu
+func (b *Broker) removeLocked(sub *Subscription, dropped bool) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(b.subscribers, sub)
+	sub.dropped = dropped
+	close(sub.events)
+
+	if dropped {
+		metrics.StreamDroppedSubscribers.Inc()
+	}
+	metrics.StreamSubscribers.Set(float64(len(b.subscribers)))
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"testing"
+
+	"highload-final/internal/analytics"
+)
+
+func TestFilterMatch(t *testing.T) {
+	normal := analytics.AnalysisResult{DeviceID: "d1"}
+	spike := analytics.AnalysisResult{DeviceID: "d1", IsAnomaly: true, AnomalyType: "CPU_SPIKE"}
+	otherSpike := analytics.AnalysisResult{DeviceID: "d2", IsAnomaly: true, AnomalyType: "CPU_SPIKE"}
+	otherDrop := analytics.AnalysisResult{DeviceID: "d2", IsAnomaly: true, AnomalyType: "RPS_DROP"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		result analytics.AnalysisResult
+		want   bool
+	}{
+		{"empty filter matches all", Filter{}, normal, true},
+		{"anomalies only skips normal", Filter{AnomaliesOnly: true}, normal, false},
+		{"anomalies only", Filter{AnomaliesOnly: true}, otherDrop, true},
+		{"device", Filter{DeviceIDs: []string{"d1"}}, normal, true},
+		{"other device", Filter{DeviceIDs: []string{"d1"}}, otherDrop, false},
+		{"type", Filter{AnomalyTypes: []string{"CPU_SPIKE"}}, otherSpike, true},
+		{"other type", Filter{AnomalyTypes: []string{"CPU_SPIKE"}}, otherDrop, false},
+		{"type skips normal", Filter{AnomalyTypes: []string{""}}, normal, false},
+		// Устройства и типы объединяются по ИЛИ
+		{"device or type: device", Filter{DeviceIDs: []string{"d1"}, AnomalyTypes: []string{"RPS_DROP"}}, normal, true},
+		{"device or type: type", Filter{DeviceIDs: []string{"d1"}, AnomalyTypes: []string{"RPS_DROP"}}, otherDrop, true},
+		{"device or type: neither", Filter{DeviceIDs: []string{"d1"}, AnomalyTypes: []string{"RPS_DROP"}}, otherSpike, false},
+		{"anomalies only with device", Filter{DeviceIDs: []string{"d1"}, AnomaliesOnly: true}, spike, true},
+		{"anomalies only with device skips normal", Filter{DeviceIDs: []string{"d1"}, AnomaliesOnly: true}, normal, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.result); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBrokerNegativeSizes(t *testing.T) {
+	b := NewBroker(-1, -1)
+	b.Publish(analytics.AnalysisResult{DeviceID: "d1"})
+
+	// Без истории переподключение ничего не воспроизводит
+	sub := b.Subscribe(Filter{}, 1)
+	defer sub.Close()
+	select {
+	case event := <-sub.Events():
+		t.Errorf("unexpected replayed event %+v", event)
+	default:
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(10, 10)
+	sub := b.Subscribe(Filter{}, 0)
+	b.Close()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("subscription is still open after Close")
+	}
+	if sub.Dropped() {
+		t.Error("subscription closed by Close must not be reported as dropped")
+	}
+	// Повторная отписка после остановки безопасна
+	sub.Close()
+
+	late := b.Subscribe(Filter{}, 0)
+	b.Publish(analytics.AnalysisResult{DeviceID: "d1"})
+	if _, ok := <-late.Events(); ok {
+		t.Error("subscription created after Close is open")
+	}
+}
@@ -0,0 +1,99 @@
+package udpinput
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"highload-final/internal/ingest"
+	"highload-final/internal/models"
+)
+
+// gauges собирает значения полей в метрики устройств.
+// Gauge StatsD сохраняет значение до следующего изменения, а поля CPU и RPS обычно
+// приходят отдельными строками, поэтому недостающее поле дополняется последним
+// известным значением устройства.
+type gauges struct {
+	last map[string]models.Metric
+	mu   sync.Mutex
+}
+
+// newGauges создает объединитель значений
+func newGauges() *gauges {
+	return &gauges{
+		last: make(map[string]models.Metric),
+	}
+}
+
+// gaugeKey метрика устройства в момент времени
+type gaugeKey struct {
+	deviceID  string
+	timestamp int64
+}
+
+// Merge возвращает метрики, упорядоченные по времени
+func (g *gauges) Merge(points []ingest.Point) []models.Metric {
+	type fields struct {
+		cpu, rps, memory          float64
+		hasCPU, hasRPS, hasMemory bool
+		tags                      map[string]string
+	}
+
+	grouped := make(map[gaugeKey]*fields)
+	for _, p := range points {
+		key := gaugeKey{deviceID: p.DeviceID, timestamp: p.Timestamp.UnixNano()}
+		f := grouped[key]
+		if f == nil {
+			f = &fields{}
+			grouped[key] = f
+		}
+		switch p.Field {
+		case ingest.FieldCPU:
+			f.cpu, f.hasCPU = p.Value, true
+		case ingest.FieldRPS:
+			f.rps, f.hasRPS = p.Value, true
+		case ingest.FieldMemory:
+			f.memory, f.hasMemory = p.Value, true
+		}
+		if len(p.Tags) > 0 {
+			f.tags = p.Tags
+		}
+	}
+
+	keys := make([]gaugeKey, 0, len(grouped))
+	for key := range grouped {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].timestamp != keys[j].timestamp {
+			return keys[i].timestamp < keys[j].timestamp
+		}
+		return keys[i].deviceID < keys[j].deviceID
+	})
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	result := make([]models.Metric, 0, len(keys))
+	for _, key := range keys {
+		f := grouped[key]
+		metric := g.last[key.deviceID]
+		metric.DeviceID = key.deviceID
+		metric.Timestamp = time.Unix(0, key.timestamp)
+		if f.hasCPU {
+			metric.CPU = f.cpu
+		}
+		if f.hasRPS {
+			metric.RPS = f.rps
+		}
+		if f.hasMemory {
+			metric.Memory = f.memory
+		}
+		if f.tags != nil {
+			metric.Tags = f.tags
+		}
+		g.last[key.deviceID] = metric
+		result = append(result, metric)
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package udpinput
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-final/internal/cluster"
+	"highload-final/internal/ingest"
+	"highload-final/internal/metrics"
+	"highload-final/internal/models"
+)
+
+// maxPacketSize максимальный размер UDP датаграммы
+const maxPacketSize = 64 * 1024
+
+// Config параметры UDP приемника
+type Config struct {
+	Addr string
+	// Format statsd, influx или auto (определяется по каждой строке)
+	Format string
+	// DeviceTag метка line protocol с идентификатором устройства
+	DeviceTag string
+	// ForwardTimeout ограничивает пересылку метрик чужих устройств владельцу
+	ForwardTimeout time.Duration
+	// ForwardQueueSize сколько пачек чужих устройств может ждать пересылки
+	ForwardQueueSize int
+}
+
+// forwardBatch метрики чужих устройств для пересылки владельцу
+type forwardBatch struct {
+	owner   cluster.Member
+	metrics []models.Metric
+}
+
+// Listener принимает метрики StatsD и InfluxDB line protocol по UDP.
+// Строки одного пакета объединяются по устройствам и передаются на анализ пачкой.
+// Метрики чужих устройств пересылаются отдельной goroutine, чтобы медленная
+// реплика-владелец не останавливала чтение сокета.
+type Listener struct {
+	config   Config
+	pipeline *ingest.Pipeline
+	merger   *gauges
+	conn     net.PacketConn
+	forwards chan forwardBatch
+	wg       sync.WaitGroup
+	fwdWg    sync.WaitGroup
+}
+
+// NewListener создает приемник
+func NewListener(config Config, pipeline *ingest.Pipeline) *Listener {
+	if config.Format == "" {
+		config.Format = FormatAuto
+	}
+	if config.DeviceTag == "" {
+		config.DeviceTag = "device_id"
+	}
+	if config.ForwardTimeout <= 0 {
+		config.ForwardTimeout = 5 * time.Second
+	}
+	if config.ForwardQueueSize <= 0 {
+		config.ForwardQueueSize = 64
+	}
+	return &Listener{
+		config:   config,
+		pipeline: pipeline,
+		merger:   newGauges(),
+		forwards: make(chan forwardBatch, config.ForwardQueueSize),
+	}
+}
+
+// Start открывает UDP сокет и запускает чтение пакетов
+func (l *Listener) Start() error {
+	conn, err := net.ListenPacket("udp", l.config.Addr)
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+
+	l.fwdWg.Add(1)
+	go l.forwardLoop()
+	l.wg.Add(1)
+	go l.serve()
+	return nil
+}
+
+// Stop закрывает сокет и дожидается обработки последнего пакета и пересылок из очереди
+func (l *Listener) Stop() {
+	if l.conn == nil {
+		return
+	}
+	l.conn.Close()
+	l.wg.Wait()
+	close(l.forwards)
+	l.fwdWg.Wait()
+}
+
+// serve читает пакеты до закрытия сокета
+func (l *Listener) serve() {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("UDP read error: %v\n", err)
+			continue
+		}
+		metrics.UDPPackets.Inc()
+		l.handlePacket(string(buf[:n]), time.Now())
+	}
+}
+
+// handlePacket разбирает строки пакета и передает метрики на анализ
+func (l *Listener) handlePacket(packet string, now time.Time) {
+	var points []ingest.Point
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		format := l.config.Format
+		if format == FormatAuto {
+			format = DetectFormat(line)
+		}
+
+		var (
+			parsed Line
+			err    error
+		)
+		switch format {
+		case FormatStatsD:
+			parsed, err = ParseStatsD(line, now)
+		default:
+			parsed, err = ParseInflux(line, l.config.DeviceTag, now)
+		}
+		if err != nil {
+			metrics.UDPMalformedLines.WithLabelValues(format, Reason(err)).Inc()
+			continue
+		}
+		points = append(points, parsed.Points()...)
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	remote := make(map[cluster.Member][]models.Metric)
+	for _, metric := range l.merger.Merge(points) {
+		if err := l.pipeline.Validate(&metric); err != nil {
+			metrics.MetricsRejected.WithLabelValues("udp", ingest.Reason(err)).Inc()
+			continue
+		}
+		if owner, isRemote := l.pipeline.RemoteOwner(metric.DeviceID); isRemote {
+			remote[owner] = append(remote[owner], metric)
+			continue
+		}
+		if err := l.pipeline.Ingest(ctx, metric); err != nil {
+			metrics.MetricsRejected.WithLabelValues("udp", ingest.Reason(err)).Inc()
+		}
+	}
+
+	for owner, batch := range remote {
+		select {
+		case l.forwards <- forwardBatch{owner: owner, metrics: batch}:
+		default:
+			// Очередь пересылки заполнена: UDP не подразумевает повторной отправки
+			metrics.MetricsRejected.WithLabelValues("udp", "queue_full").Add(float64(len(batch)))
+		}
+	}
+}
+
+// forwardLoop пересылает пачки чужих устройств владельцам до закрытия очереди
+func (l *Listener) forwardLoop() {
+	defer l.fwdWg.Done()
+
+	for batch := range l.forwards {
+		ctx, cancel := context.WithTimeout(context.Background(), l.config.ForwardTimeout)
+		if err := l.pipeline.Forward(ctx, batch.owner, batch.metrics); err != nil {
+			metrics.MetricsRejected.WithLabelValues("udp", "forward_failed").Add(float64(len(batch.metrics)))
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,298 @@
+package udpinput
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-final/internal/ingest"
+)
+
+// Форматы строк UDP пакета
+const (
+	FormatStatsD = "statsd"
+	FormatInflux = "influx"
+	FormatAuto   = "auto"
+)
+
+// Ошибки разбора строк; используются как причины в udp_malformed_lines_total
+var (
+	ErrSyntax      = errors.New("syntax")
+	ErrValue       = errors.New("value")
+	ErrUnsupported = errors.New("unsupported")
+	ErrNoDevice    = errors.New("no_device")
+)
+
+// Line разобранная строка: значения полей устройства и метки
+type Line struct {
+	DeviceID  string
+	Timestamp time.Time
+	Fields    map[string]float64
+	Tags      map[string]string
+}
+
+// Points возвращает значения полей метрики устройства
+func (l Line) Points() []ingest.Point {
+	points := make([]ingest.Point, 0, len(l.Fields))
+	for field, value := range l.Fields {
+		points = append(points, ingest.Point{
+			DeviceID:  l.DeviceID,
+			Timestamp: l.Timestamp,
+			Field:     field,
+			Value:     value,
+			Tags:      l.Tags,
+		})
+	}
+	return points
+}
+
+// DetectFormat определяет формат строки: у StatsD значение отделено ':' и тип '|'
+func DetectFormat(line string) string {
+	colon := strings.IndexByte(line, ':')
+	pipe := strings.IndexByte(line, '|')
+	if colon > 0 && pipe > colon && !strings.ContainsAny(line[:colon], " =") {
+		return FormatStatsD
+	}
+	return FormatInflux
+}
+
+// ParseStatsD разбирает gauge в формате StatsD: "<device_id>.<field>:<value>|g[|@rate][|#k:v,...]".
+// Последний сегмент имени - поле (cpu, rps, memory), остальное - идентификатор устройства.
+func ParseStatsD(line string, now time.Time) (Line, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Line{}, fmt.Errorf("%w: missing ':'", ErrSyntax)
+	}
+
+	sections := strings.Split(rest, "|")
+	if len(sections) < 2 {
+		return Line{}, fmt.Errorf("%w: missing metric type", ErrSyntax)
+	}
+	if sections[1] != "g" {
+		return Line{}, fmt.Errorf("%w: metric type %q, only gauges are accepted", ErrUnsupported, sections[1])
+	}
+	// Относительные gauge ("+5", "-5") требуют состояния и не поддерживаются
+	if strings.HasPrefix(sections[0], "+") || strings.HasPrefix(sections[0], "-") {
+		return Line{}, fmt.Errorf("%w: relative gauge", ErrUnsupported)
+	}
+	value, err := strconv.ParseFloat(sections[0], 64)
+	if err != nil {
+		return Line{}, fmt.Errorf("%w: %q", ErrValue, sections[0])
+	}
+
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 || dot == len(name)-1 {
+		return Line{}, fmt.Errorf("%w: name %q must be <device_id>.<field>", ErrNoDevice, name)
+	}
+	field := name[dot+1:]
+	if !knownField(field) {
+		return Line{}, fmt.Errorf("%w: field %q", ErrUnsupported, field)
+	}
+
+	parsed := Line{
+		DeviceID:  name[:dot],
+		Timestamp: now,
+		Fields:    map[string]float64{field: value},
+	}
+
+	// Расширение DogStatsD: метки после "|#"
+	for _, section := range sections[2:] {
+		if !strings.HasPrefix(section, "#") {
+			continue
+		}
+		for _, tag := range strings.Split(section[1:], ",") {
+			k, v, _ := strings.Cut(tag, ":")
+			if k == "" {
+				continue
+			}
+			if parsed.Tags == nil {
+				parsed.Tags = make(map[string]string)
+			}
+			parsed.Tags[k] = v
+		}
+	}
+	return parsed, nil
+}
+
+// ParseInflux разбирает строку InfluxDB line protocol:
+// "<measurement>[,tag=v...] field=value[,field=value...] [timestamp_ns]".
+// Идентификатор устройства берется из метки deviceTag.
+func ParseInflux(line, deviceTag string, now time.Time) (Line, error) {
+	head, fieldsPart, tsPart, err := splitInflux(line)
+	if err != nil {
+		return Line{}, err
+	}
+
+	parsed := Line{Timestamp: now, Fields: make(map[string]float64)}
+
+	headParts := splitUnescaped(head, ',')
+	measurement, tags := headParts[0], headParts[1:]
+	if measurement == "" {
+		return Line{}, fmt.Errorf("%w: empty measurement", ErrSyntax)
+	}
+	for _, tag := range tags {
+		k, v, ok := cutUnescaped(tag, '=')
+		if !ok || k == "" || v == "" {
+			return Line{}, fmt.Errorf("%w: tag %q", ErrSyntax, tag)
+		}
+		k, v = unescape(k), unescape(v)
+		if k == deviceTag {
+			parsed.DeviceID = v
+			continue
+		}
+		if parsed.Tags == nil {
+			parsed.Tags = make(map[string]string)
+		}
+		parsed.Tags[k] = v
+	}
+	for _, field := range splitUnescaped(fieldsPart, ',') {
+		k, v, ok := cutUnescaped(field, '=')
+		if !ok || k == "" || v == "" {
+			return Line{}, fmt.Errorf("%w: field %q", ErrSyntax, field)
+		}
+		k = unescape(k)
+		if !knownField(k) {
+			// Прочие поля (в том числе строковые) не анализируются
+			continue
+		}
+		value, err := parseInfluxNumber(v)
+		if err != nil {
+			return Line{}, err
+		}
+		parsed.Fields[k] = value
+	}
+	if len(parsed.Fields) == 0 {
+		return Line{}, fmt.Errorf("%w: no cpu, rps or memory fields", ErrUnsupported)
+	}
+	if parsed.DeviceID == "" {
+		return Line{}, fmt.Errorf("%w: tag %q is missing", ErrNoDevice, deviceTag)
+	}
+
+	if tsPart != "" {
+		ns, err := strconv.ParseInt(tsPart, 10, 64)
+		if err != nil {
+			return Line{}, fmt.Errorf("%w: timestamp %q", ErrValue, tsPart)
+		}
+		parsed.Timestamp = time.Unix(0, ns)
+	}
+	return parsed, nil
+}
+
+// splitInflux делит строку на измерение с метками, поля и время по неэкранированным пробелам
+// вне строковых значений полей
+func splitInflux(line string) (head, fields, ts string, err error) {
+	var parts []string
+	start, inQuotes := 0, false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && len(parts) == 1:
+			inQuotes = !inQuotes
+		case c == ' ' && !inQuotes:
+			parts = append(parts, line[start:i])
+			start = i + 1
+		}
+	}
+	if inQuotes {
+		return "", "", "", fmt.Errorf("%w: unterminated string", ErrSyntax)
+	}
+	parts = append(parts, line[start:])
+
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], "", nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("%w: expected measurement, fields and optional timestamp", ErrSyntax)
+}
+
+// splitUnescaped делит строку по разделителю, пропуская экранированные символы
+// и разделители внутри строк в кавычках
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start, inQuotes := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutUnescaped делит строку по первому неэкранированному разделителю
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape убирает экранирование в именах и значениях меток
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseInfluxNumber разбирает числовое значение поля: float, integer (i) или unsigned (u)
+func parseInfluxNumber(v string) (float64, error) {
+	switch {
+	case strings.HasSuffix(v, "i"):
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrValue, v)
+		}
+		return float64(n), nil
+	case strings.HasSuffix(v, "u"):
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrValue, v)
+		}
+		return float64(n), nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrValue, v)
+	}
+	return n, nil
+}
+
+// knownField проверяет, что поле соответствует полю models.Metric
+func knownField(field string) bool {
+	return field == ingest.FieldCPU || field == ingest.FieldRPS || field == ingest.FieldMemory
+}
+
+// Reason возвращает причину ошибки разбора для метрик
+func Reason(err error) string {
+	for _, known := range []error{ErrSyntax, ErrValue, ErrUnsupported, ErrNoDevice} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	return "syntax"
+}
@@ -0,0 +1,105 @@
+package udpinput
+
+import (
+	"testing"
+	"time"
+)
+
+// checkLine проверяет инварианты успешно разобранной строки
+func checkLine(t *testing.T, line string, parsed Line) {
+	t.Helper()
+
+	if parsed.DeviceID == "" {
+		t.Fatalf("%q: parsed line has empty device_id", line)
+	}
+	if len(parsed.Fields) == 0 {
+		t.Fatalf("%q: parsed line has no fields", line)
+	}
+	for field := range parsed.Fields {
+		if !knownField(field) {
+			t.Fatalf("%q: parsed line has unknown field %q", line, field)
+		}
+	}
+	if len(parsed.Points()) != len(parsed.Fields) {
+		t.Fatalf("%q: %d points for %d fields", line, len(parsed.Points()), len(parsed.Fields))
+	}
+}
+
+func FuzzParseStatsD(f *testing.F) {
+	for _, seed := range []string{
+		"web-1.cpu:42.5|g",
+		"web-1.rps:100|g|@0.5|#env:prod,region:eu",
+		"rack.a.web-1.memory:2048|g",
+		"web-1.cpu:+5|g",
+		"web-1.cpu:5|c",
+		"web-1.disk:5|g",
+		"cpu:5|g",
+		"web-1.:5|g",
+		"web-1.cpu:abc|g",
+		"web-1.cpu:1e400|g",
+		"web-1.cpu:NaN|g|#",
+		":|",
+		"",
+	} {
+		f.Add(seed)
+	}
+	now := time.Now()
+	f.Fuzz(func(t *testing.T, line string) {
+		parsed, err := ParseStatsD(line, now)
+		if err != nil {
+			return
+		}
+		checkLine(t, line, parsed)
+	})
+}
+
+func FuzzParseInflux(f *testing.F) {
+	for _, seed := range []string{
+		"host,device_id=web-1 cpu=42.5,rps=100i",
+		"host,device_id=web-1,region=eu cpu=1 1700000000000000000",
+		"host,device_id=web-1 memory=2048u",
+		`host,device_id=web\ 1 cpu=1,note="a b,c=d"`,
+		"host,device_id=web-1 disk=5",
+		"host cpu=1",
+		"host,device_id= cpu=1",
+		"host,device_id=web-1 cpu=abc",
+		"host,device_id=web-1 cpu=1 notatime",
+		`host,device_id=web-1 note="unterminated`,
+		",device_id=web-1 cpu=1",
+		"host,device_id=web-1 cpu=",
+		"",
+	} {
+		f.Add(seed)
+	}
+	now := time.Now()
+	f.Fuzz(func(t *testing.T, line string) {
+		parsed, err := ParseInflux(line, "device_id", now)
+		if err != nil {
+			return
+		}
+		checkLine(t, line, parsed)
+	})
+}
+
+func TestMemoryFieldReachesMetric(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name  string
+		parse func() (Line, error)
+	}{
+		{"statsd", func() (Line, error) { return ParseStatsD("web-1.memory:2048|g", now) }},
+		{"influx", func() (Line, error) { return ParseInflux("host,device_id=web-1 memory=2048i", "device_id", now) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := tt.parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			merged := newGauges().Merge(parsed.Points())
+			if len(merged) != 1 || merged[0].DeviceID != "web-1" || merged[0].Memory != 2048 {
+				t.Errorf("merged = %+v, want web-1 with memory 2048", merged)
+			}
+		})
+	}
+}